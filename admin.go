@@ -0,0 +1,368 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Limits for the number of records returned by GET /investigations and GET /dead-letters.
+const (
+	defaultInvestigationLimit = 100
+	maxInvestigationLimit     = 1000
+)
+
+// investigationView is the API representation of an investigation, adding fields
+// derived from the stored record.
+type investigationView struct {
+	*Investigation
+	ResponseText string `json:"response_text"`
+	LatencyMS    int64  `json:"latency_ms"`
+}
+
+// newInvestigationView derives the response text and latency of an investigation.
+func newInvestigationView(inv *Investigation) investigationView {
+	v := investigationView{Investigation: inv}
+	if inv.Response != nil {
+		texts := make([]string, 0, len(inv.Response.Choices))
+		for _, c := range inv.Response.Choices {
+			texts = append(texts, c.Message.Content)
+		}
+		v.ResponseText = strings.Join(texts, "\n\n")
+	}
+	if !inv.CompletedAt.IsZero() {
+		v.LatencyMS = inv.CompletedAt.Sub(inv.StartedAt).Milliseconds()
+	}
+	return v
+}
+
+// investigationFilter selects investigations by query parameters.
+type investigationFilter struct {
+	fingerprint string
+	alertname   string
+	status      string
+	route       string
+	since       time.Time
+	limit       int
+}
+
+// parseInvestigationFilter reads the filter from the query string. since accepts an
+// RFC 3339 timestamp or a duration relative to now, such as 24h.
+func parseInvestigationFilter(r *http.Request) (investigationFilter, error) {
+	q := r.URL.Query()
+	f := investigationFilter{
+		fingerprint: q.Get("fingerprint"),
+		alertname:   q.Get("alertname"),
+		status:      q.Get("status"),
+		route:       q.Get("route"),
+	}
+
+	if v := q.Get("since"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil {
+			f.since = time.Now().Add(-d)
+		} else if f.since, err = time.Parse(time.RFC3339, v); err != nil {
+			return f, errors.New("invalid since parameter")
+		}
+	}
+	var err error
+	f.limit, err = parseLimit(q)
+	return f, err
+}
+
+// parseLimit reads the limit query parameter, capped at maxInvestigationLimit.
+func parseLimit(q url.Values) (int, error) {
+	v := q.Get("limit")
+	if v == "" {
+		return defaultInvestigationLimit, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n <= 0 {
+		return 0, errors.New("invalid limit parameter")
+	}
+	return min(n, maxInvestigationLimit), nil
+}
+
+// matches reports whether an investigation passes the filter.
+func (f investigationFilter) matches(inv *Investigation) bool {
+	if f.status != "" && inv.Status != f.status {
+		return false
+	}
+	if f.route != "" && inv.Route != f.route {
+		return false
+	}
+	if !f.since.IsZero() && inv.StartedAt.Before(f.since) {
+		return false
+	}
+	if f.fingerprint != "" && !payloadHasFingerprint(inv.Payload, f.fingerprint) {
+		return false
+	}
+	if f.alertname != "" && !payloadHasAlertname(inv.Payload, f.alertname) {
+		return false
+	}
+	return true
+}
+
+// payloadHasFingerprint reports whether any alert in the payload has the fingerprint.
+func payloadHasFingerprint(p *AlertmanagerPayload, fingerprint string) bool {
+	if p == nil {
+		return false
+	}
+	for _, a := range p.Alerts {
+		if alertFingerprint(a) == fingerprint {
+			return true
+		}
+	}
+	return false
+}
+
+// payloadHasAlertname reports whether the payload or any of its alerts has the alertname.
+func payloadHasAlertname(p *AlertmanagerPayload, alertname string) bool {
+	if p == nil {
+		return false
+	}
+	if p.CommonLabels["alertname"] == alertname {
+		return true
+	}
+	for _, a := range p.Alerts {
+		if a.Labels["alertname"] == alertname {
+			return true
+		}
+	}
+	return false
+}
+
+// listInvestigationsHandler returns the investigations matching the query, newest first.
+func listInvestigationsHandler(store *InvestigationStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		filter, err := parseInvestigationFilter(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		views := []investigationView{}
+		for _, inv := range store.List() {
+			if len(views) == filter.limit {
+				break
+			}
+			if filter.matches(inv) {
+				views = append(views, newInvestigationView(inv))
+			}
+		}
+		writeJSON(w, http.StatusOK, map[string]any{"investigations": views, "count": len(views)})
+	}
+}
+
+// getInvestigationHandler returns a single investigation by ID.
+func getInvestigationHandler(store *InvestigationStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		inv, ok := store.Get(r.PathValue("id"))
+		if !ok {
+			http.Error(w, "Not Found", http.StatusNotFound)
+			return
+		}
+		writeJSON(w, http.StatusOK, newInvestigationView(inv))
+	}
+}
+
+// requireToken wraps an admin handler with bearer token authentication, if a token is configured.
+func requireToken(token string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !checkAuth(w, r, token) {
+			return
+		}
+		next(w, r)
+	}
+}
+
+// writeJSON writes v as a JSON response with the given status code.
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		slog.Warn("failed to write response", "error", err)
+	}
+}
+
+// handleDeadLetters registers the dead-letter endpoints, all requiring the admin token.
+func handleDeadLetters(mux *http.ServeMux, queue *AlertQueue, store *DeadLetterStore, token string) {
+	mux.HandleFunc("GET /dead-letters", requireToken(token, listDeadLettersHandler(store)))
+	mux.HandleFunc("GET /dead-letters/{id}", requireToken(token, getDeadLetterHandler(store)))
+	mux.HandleFunc("DELETE /dead-letters", requireToken(token, purgeDeadLettersHandler(store)))
+	mux.HandleFunc("DELETE /dead-letters/{id}", requireToken(token, purgeDeadLetterHandler(store)))
+	mux.HandleFunc("POST /dead-letters/replay", requireToken(token, replayDeadLettersHandler(queue, store)))
+	mux.HandleFunc("POST /dead-letters/{id}/replay", requireToken(token, replayDeadLetterHandler(queue, store)))
+}
+
+// deadLetterFilter selects dead letters by query parameters.
+type deadLetterFilter struct {
+	route     string
+	alertname string
+	limit     int
+}
+
+// parseDeadLetterFilter reads the filter from the query string.
+func parseDeadLetterFilter(r *http.Request) (deadLetterFilter, error) {
+	q := r.URL.Query()
+	f := deadLetterFilter{route: q.Get("route"), alertname: q.Get("alertname")}
+	var err error
+	f.limit, err = parseLimit(q)
+	return f, err
+}
+
+// matches reports whether a dead letter passes the filter.
+func (f deadLetterFilter) matches(d *DeadLetter) bool {
+	if f.route != "" && !slices.ContainsFunc(d.Failures, func(rf RouteFailure) bool { return rf.Route == f.route }) {
+		return false
+	}
+	if f.alertname != "" && !payloadHasAlertname(d.Payload, f.alertname) {
+		return false
+	}
+	return true
+}
+
+// apply returns the first limit dead letters of list that match the filter.
+func (f deadLetterFilter) apply(list []*DeadLetter) []*DeadLetter {
+	selected := []*DeadLetter{}
+	for _, d := range list {
+		if len(selected) == f.limit {
+			break
+		}
+		if f.matches(d) {
+			selected = append(selected, d)
+		}
+	}
+	return selected
+}
+
+// listDeadLettersHandler returns the dead letters matching the query, newest first.
+func listDeadLettersHandler(store *DeadLetterStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		filter, err := parseDeadLetterFilter(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		list := filter.apply(store.List())
+		writeJSON(w, http.StatusOK, map[string]any{"dead_letters": list, "count": len(list)})
+	}
+}
+
+// getDeadLetterHandler returns a single dead letter by ID.
+func getDeadLetterHandler(store *DeadLetterStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		d, ok := store.Get(r.PathValue("id"))
+		if !ok {
+			http.Error(w, "Not Found", http.StatusNotFound)
+			return
+		}
+		writeJSON(w, http.StatusOK, d)
+	}
+}
+
+// replayDeadLetterHandler enqueues the payload of a dead letter again and removes it.
+// It responds with 503 and keeps the dead letter if the queue rejects the payload.
+func replayDeadLetterHandler(queue *AlertQueue, store *DeadLetterStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		d, ok := store.Get(r.PathValue("id"))
+		if !ok {
+			http.Error(w, "Not Found", http.StatusNotFound)
+			return
+		}
+		if !replayDeadLetter(queue, store, d) {
+			http.Error(w, "Service Unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		writeJSON(w, http.StatusAccepted, map[string]any{"replayed": 1})
+	}
+}
+
+// replayDeadLettersHandler replays the dead letters matching the query, oldest first,
+// until the queue rejects one. It responds with 503 if none could be replayed.
+func replayDeadLettersHandler(queue *AlertQueue, store *DeadLetterStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		filter, err := parseDeadLetterFilter(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		oldest := store.List()
+		slices.Reverse(oldest)
+		selected := filter.apply(oldest)
+
+		replayed := 0
+		for _, d := range selected {
+			if !replayDeadLetter(queue, store, d) {
+				break
+			}
+			replayed++
+		}
+		status := http.StatusAccepted
+		if replayed == 0 && len(selected) > 0 {
+			status = http.StatusServiceUnavailable
+		}
+		writeJSON(w, status, map[string]any{"replayed": replayed, "remaining": len(selected) - replayed})
+	}
+}
+
+// replayDeadLetter queues the payload of a dead letter for the routes it failed on and
+// then removes the dead letter, so that a crash in between duplicates the payload rather
+// than losing it. It returns false, keeping the dead letter, if the queue rejects the payload.
+func replayDeadLetter(queue *AlertQueue, store *DeadLetterStore, d *DeadLetter) bool {
+	routes := make([]string, 0, len(d.Failures))
+	for _, f := range d.Failures {
+		routes = append(routes, f.Route)
+	}
+	if !queue.Replay(d.Payload, routes) {
+		return false
+	}
+	metrics.deadLetters.Inc("replayed")
+	slog.Info("dead letter replayed", "id", d.ID, "alertname", d.Payload.CommonLabels["alertname"])
+	if _, err := store.Remove(d.ID); err != nil {
+		slog.Error("failed to remove replayed dead letter", "id", d.ID, "error", err)
+	}
+	return true
+}
+
+// purgeDeadLetterHandler deletes a single dead letter by ID.
+func purgeDeadLetterHandler(store *DeadLetterStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		removed, err := store.Remove(r.PathValue("id"))
+		if removed == 0 {
+			http.Error(w, "Not Found", http.StatusNotFound)
+			return
+		}
+		metrics.deadLetters.Inc("purged")
+		if err != nil {
+			slog.Error("failed to persist purged dead letters", "error", err)
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// purgeDeadLettersHandler deletes the dead letters matching the query.
+func purgeDeadLettersHandler(store *DeadLetterStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		filter, err := parseDeadLetterFilter(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		var ids []string
+		for _, d := range filter.apply(store.List()) {
+			ids = append(ids, d.ID)
+		}
+		removed, err := store.Remove(ids...)
+		metrics.deadLetters.Add(float64(removed), "purged")
+		if err != nil {
+			slog.Error("failed to persist purged dead letters", "error", err)
+		}
+		writeJSON(w, http.StatusOK, map[string]any{"purged": removed})
+	}
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func testInvestigationMux(t *testing.T) http.Handler {
+	t.Helper()
+
+	store, err := NewInvestigationStore("", 10)
+	if err != nil {
+		t.Fatalf("open store: %v", err)
+	}
+	now := time.Now().UTC()
+	investigations := []*Investigation{
+		{
+			ID:          "old",
+			Route:       "root",
+			Status:      investigationFailed,
+			StartedAt:   now.Add(-48 * time.Hour),
+			CompletedAt: now.Add(-48*time.Hour + 3*time.Second),
+			Attempts:    3,
+			Payload: &AlertmanagerPayload{
+				CommonLabels: map[string]string{"alertname": "DiskFull"},
+				Alerts:       []Alert{{Fingerprint: "fp-disk"}},
+			},
+			Error: "openclaw request failed after 3 attempts",
+		},
+		{
+			ID:          "new",
+			Route:       "database",
+			Status:      investigationSucceeded,
+			StartedAt:   now.Add(-time.Hour),
+			CompletedAt: now.Add(-time.Hour + 1500*time.Millisecond),
+			Attempts:    1,
+			Prompt:      "Investigate",
+			Payload: &AlertmanagerPayload{
+				CommonLabels: map[string]string{"alertname": "HighCPU"},
+				Alerts:       []Alert{{Fingerprint: "fp-cpu"}},
+			},
+			Response: &chatResponse{Choices: []chatChoice{{Message: chatMessage{Content: "CPU is fine now"}}}},
+		},
+	}
+	for _, inv := range investigations {
+		if err := store.Save(inv); err != nil {
+			t.Fatalf("save: %v", err)
+		}
+	}
+
+	client := NewOpenClawClient("http://localhost", "token", "model")
+	queue := NewAlertQueue(client)
+	t.Cleanup(queue.Stop)
+	return NewMux(queue, "", WithAdminToken("admin-token"), WithInvestigationAPI(store))
+}
+
+func TestListInvestigations(t *testing.T) {
+	t.Parallel()
+
+	mux := testInvestigationMux(t)
+
+	tests := []struct {
+		query   string
+		wantIDs []string
+	}{
+		{query: "", wantIDs: []string{"new", "old"}},
+		{query: "?fingerprint=fp-disk", wantIDs: []string{"old"}},
+		{query: "?alertname=HighCPU", wantIDs: []string{"new"}},
+		{query: "?since=24h", wantIDs: []string{"new"}},
+		{query: "?status=failed", wantIDs: []string{"old"}},
+		{query: "?route=database&alertname=DiskFull", wantIDs: []string{}},
+		{query: "?limit=1", wantIDs: []string{"new"}},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/investigations"+tt.query, nil)
+		req.Header.Set("Authorization", "Bearer admin-token")
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, req)
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: expected 200, got %d", tt.query, w.Code)
+		}
+		var resp struct {
+			Investigations []investigationView `json:"investigations"`
+			Count          int                 `json:"count"`
+		}
+		if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+			t.Fatalf("%s: decode: %v", tt.query, err)
+		}
+		if resp.Count != len(tt.wantIDs) || len(resp.Investigations) != len(tt.wantIDs) {
+			t.Fatalf("%s: expected %v, got %d investigations", tt.query, tt.wantIDs, resp.Count)
+		}
+		for i, id := range tt.wantIDs {
+			if resp.Investigations[i].ID != id {
+				t.Fatalf("%s: expected %v at %d, got %q", tt.query, id, i, resp.Investigations[i].ID)
+			}
+		}
+	}
+}
+
+func TestListInvestigations_InvalidQuery(t *testing.T) {
+	t.Parallel()
+
+	mux := testInvestigationMux(t)
+	for _, query := range []string{"?since=yesterday", "?limit=0", "?limit=x"} {
+		req := httptest.NewRequest(http.MethodGet, "/investigations"+query, nil)
+		req.Header.Set("Authorization", "Bearer admin-token")
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, req)
+		if w.Code != http.StatusBadRequest {
+			t.Fatalf("%s: expected 400, got %d", query, w.Code)
+		}
+	}
+}
+
+func TestGetInvestigation(t *testing.T) {
+	t.Parallel()
+
+	mux := testInvestigationMux(t)
+
+	req := httptest.NewRequest(http.MethodGet, "/investigations/new", nil)
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, req)
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 without token, got %d", w.Code)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/investigations/new", nil)
+	req.Header.Set("Authorization", "Bearer admin-token")
+	w = httptest.NewRecorder()
+	mux.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", w.Code)
+	}
+	var view map[string]any
+	if err := json.NewDecoder(w.Body).Decode(&view); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if view["response_text"] != "CPU is fine now" || view["latency_ms"] != float64(1500) {
+		t.Fatalf("unexpected investigation view: %v", view)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/investigations/missing", nil)
+	req.Header.Set("Authorization", "Bearer admin-token")
+	w = httptest.NewRecorder()
+	mux.ServeHTTP(w, req)
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("expected 404, got %d", w.Code)
+	}
+}
+
+func TestAdminAPIs_DisabledWithoutAdminToken(t *testing.T) {
+	t.Parallel()
+
+	investigations, err := NewInvestigationStore("", 10)
+	if err != nil {
+		t.Fatalf("open investigations: %v", err)
+	}
+	deadLetters, err := NewDeadLetterStore("", 10)
+	if err != nil {
+		t.Fatalf("open dead letters: %v", err)
+	}
+	queue := NewAlertQueue(NewOpenClawClient("http://localhost", "token", "model"))
+	defer queue.Stop()
+	mux := NewMux(queue, "", WithInvestigationAPI(investigations), WithDeadLetterAPI(deadLetters))
+
+	for _, tt := range []struct{ method, path string }{
+		{http.MethodGet, "/investigations"},
+		{http.MethodGet, "/investigations/abc"},
+		{http.MethodGet, "/dead-letters"},
+		{http.MethodDelete, "/dead-letters"},
+		{http.MethodPost, "/dead-letters/replay"},
+		{http.MethodPost, "/dead-letters/abc/replay"},
+	} {
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, httptest.NewRequest(tt.method, tt.path, nil))
+		if w.Code != http.StatusNotFound {
+			t.Errorf("%s %s: expected 404 without an admin token, got %d", tt.method, tt.path, w.Code)
+		}
+	}
+}
@@ -1,11 +1,39 @@
 // Package main implements alertstoopenclaw, a bridge service that forwards
-// Grafana Alertmanager webhooks to an OpenClaw instance.
+// Grafana and Prometheus Alertmanager webhooks to an OpenClaw instance.
 package main
 
-// AlertmanagerPayload represents the webhook JSON payload sent by Grafana Alertmanager.
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Payload sources reported by AlertmanagerPayload.Source.
+const (
+	payloadSourcePrometheus = "prometheus"
+	payloadSourceGrafana    = "grafana"
+)
+
+// supportedPayloadVersions is the major webhook payload version understood for each
+// source. Prometheus Alertmanager sends version "4"; Grafana unified alerting versions
+// its extended body independently and sends "1".
+var supportedPayloadVersions = map[string]string{
+	payloadSourcePrometheus: "4",
+	payloadSourceGrafana:    "1",
+}
+
+// errUnsupportedPayloadVersion is returned for payloads with an unknown major version.
+var errUnsupportedPayloadVersion = errors.New("unsupported webhook payload version")
+
+// AlertmanagerPayload represents the webhook JSON payload sent by Prometheus Alertmanager
+// (version 4) and by Grafana unified alerting (version 1), which extends it with the
+// fields below. The Grafana-only fields are empty for Prometheus payloads.
 type AlertmanagerPayload struct {
 	Version           string            `json:"version"`
 	GroupKey          string            `json:"groupKey"`
+	TruncatedAlerts   int               `json:"truncatedAlerts,omitempty"`
 	Status            string            `json:"status"`
 	Receiver          string            `json:"receiver"`
 	Alerts            []Alert           `json:"alerts"`
@@ -13,6 +41,18 @@ type AlertmanagerPayload struct {
 	CommonLabels      map[string]string `json:"commonLabels"`
 	CommonAnnotations map[string]string `json:"commonAnnotations"`
 	ExternalURL       string            `json:"externalURL"`
+
+	// Grafana unified alerting extensions.
+	OrgID   int64  `json:"orgId,omitempty"`
+	Title   string `json:"title,omitempty"`
+	State   string `json:"state,omitempty"`
+	Message string `json:"message,omitempty"`
+
+	// Origin names the non-Alertmanager source a payload was converted from, if any.
+	Origin string `json:"origin,omitempty"`
+	// Caller is the name of the webhook token the payload was received with. It is set
+	// by the handler, overriding any value in the request body.
+	Caller string `json:"caller,omitempty"`
 }
 
 // Alert represents a single alert within an Alertmanager webhook payload.
@@ -24,4 +64,68 @@ type Alert struct {
 	EndsAt       string            `json:"endsAt"`
 	GeneratorURL string            `json:"generatorURL"`
 	Fingerprint  string            `json:"fingerprint"`
+
+	// Grafana unified alerting extensions.
+	SilenceURL   string             `json:"silenceURL,omitempty"`
+	DashboardURL string             `json:"dashboardURL,omitempty"`
+	PanelURL     string             `json:"panelURL,omitempty"`
+	Values       map[string]float64 `json:"values,omitempty"`
+	ValueString  string             `json:"valueString,omitempty"`
+}
+
+// decodeAlertmanagerPayload decodes a webhook body and checks its version against the
+// versions supported for its source. A payload without a version is accepted; any other
+// major version is rejected with errUnsupportedPayloadVersion.
+func decodeAlertmanagerPayload(r io.Reader) (*AlertmanagerPayload, error) {
+	var payload AlertmanagerPayload
+	if err := json.NewDecoder(r).Decode(&payload); err != nil {
+		return nil, fmt.Errorf("decode payload: %w", err)
+	}
+	if payload.Version == "" {
+		return &payload, nil
+	}
+	source := payload.Source()
+	major, _, _ := strings.Cut(payload.Version, ".")
+	if want := supportedPayloadVersions[source]; major != want {
+		return nil, fmt.Errorf("%w %q for %s payloads (supported: %s)", errUnsupportedPayloadVersion,
+			payload.Version, source, want)
+	}
+	return &payload, nil
+}
+
+// Source reports where the payload came from: the vendor it was converted from, or
+// else Grafana unified alerting or Prometheus Alertmanager, based on the Grafana-only
+// fields it carries.
+func (p *AlertmanagerPayload) Source() string {
+	if p.Origin != "" {
+		return p.Origin
+	}
+	if p.OrgID != 0 || p.Title != "" || p.State != "" || p.Message != "" {
+		return payloadSourceGrafana
+	}
+	for _, a := range p.Alerts {
+		if a.SilenceURL != "" || a.DashboardURL != "" || a.PanelURL != "" || len(a.Values) > 0 || a.ValueString != "" {
+			return payloadSourceGrafana
+		}
+	}
+	return payloadSourcePrometheus
+}
+
+// sourceNames are the names of payload sources as written in prompts.
+var sourceNames = map[string]string{
+	payloadSourcePrometheus: "Prometheus Alertmanager",
+	payloadSourceGrafana:    "Grafana Alertmanager",
+	payloadSourcePagerDuty:  "PagerDuty",
+	payloadSourceOpsgenie:   "Opsgenie",
+	payloadSourceDatadog:    "Datadog",
+}
+
+// SourceName returns the name of the payload's source for use in prompts, such as
+// "Prometheus Alertmanager" or "Datadog". A generic source is called by its configured name.
+func (p *AlertmanagerPayload) SourceName() string {
+	source := p.Source()
+	if name, ok := sourceNames[source]; ok {
+		return name
+	}
+	return strings.TrimPrefix(source, "generic/")
 }
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+const grafanaPayload = `{
+  "receiver": "openclaw",
+  "status": "firing",
+  "orgId": 1,
+  "alerts": [{
+    "status": "firing",
+    "labels": {"alertname": "HighCPU", "grafana_folder": "Infra"},
+    "annotations": {"summary": "CPU usage above 90%"},
+    "startsAt": "2026-01-01T00:00:00Z",
+    "endsAt": "0001-01-01T00:00:00Z",
+    "generatorURL": "http://grafana:3000/alerting/grafana/abc/view",
+    "fingerprint": "5a2d1c6b0f3e4a7d",
+    "silenceURL": "http://grafana:3000/alerting/silence/new?alertmanager=grafana",
+    "dashboardURL": "http://grafana:3000/d/infra",
+    "panelURL": "http://grafana:3000/d/infra?viewPanel=2",
+    "values": {"A": 93.5, "B": 1},
+    "valueString": "[ var='A' labels={} value=93.5 ]"
+  }],
+  "groupLabels": {"alertname": "HighCPU"},
+  "commonLabels": {"alertname": "HighCPU"},
+  "commonAnnotations": {"summary": "CPU usage above 90%"},
+  "externalURL": "http://grafana:3000/",
+  "version": "1",
+  "groupKey": "{}:{alertname=\"HighCPU\"}",
+  "truncatedAlerts": 0,
+  "title": "[FIRING:1] HighCPU (Infra)",
+  "state": "alerting",
+  "message": "**Firing**\n\nValue: A=93.5"
+}`
+
+const prometheusPayload = `{
+  "version": "4",
+  "groupKey": "{}:{alertname=\"DiskFull\"}",
+  "truncatedAlerts": 3,
+  "status": "firing",
+  "receiver": "openclaw",
+  "groupLabels": {"alertname": "DiskFull"},
+  "commonLabels": {"alertname": "DiskFull", "severity": "critical"},
+  "commonAnnotations": {},
+  "externalURL": "http://alertmanager:9093",
+  "alerts": [{
+    "status": "firing",
+    "labels": {"alertname": "DiskFull", "instance": "db1"},
+    "annotations": {},
+    "startsAt": "2026-01-01T00:00:00Z",
+    "endsAt": "0001-01-01T00:00:00Z",
+    "generatorURL": "http://prometheus:9090/graph",
+    "fingerprint": "1f2e3d4c5b6a7980"
+  }]
+}`
+
+func TestDecodeAlertmanagerPayload(t *testing.T) {
+	t.Parallel()
+
+	p, err := decodeAlertmanagerPayload(strings.NewReader(grafanaPayload))
+	if err != nil {
+		t.Fatalf("decode grafana payload: %v", err)
+	}
+	if p.Source() != payloadSourceGrafana {
+		t.Fatalf("expected grafana source, got %q", p.Source())
+	}
+	a := p.Alerts[0]
+	if p.OrgID != 1 || p.Title != "[FIRING:1] HighCPU (Infra)" || p.State != "alerting" || p.Message == "" {
+		t.Fatalf("grafana payload fields not decoded: %+v", p)
+	}
+	if a.PanelURL == "" || a.DashboardURL == "" || a.SilenceURL == "" || a.Values["A"] != 93.5 || a.ValueString == "" {
+		t.Fatalf("grafana alert fields not decoded: %+v", a)
+	}
+
+	p, err = decodeAlertmanagerPayload(strings.NewReader(prometheusPayload))
+	if err != nil {
+		t.Fatalf("decode prometheus payload: %v", err)
+	}
+	if p.Source() != payloadSourcePrometheus {
+		t.Fatalf("expected prometheus source, got %q", p.Source())
+	}
+	if p.TruncatedAlerts != 3 {
+		t.Fatalf("expected 3 truncated alerts, got %d", p.TruncatedAlerts)
+	}
+}
+
+func TestDecodeAlertmanagerPayload_Version(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		version string
+		grafana bool
+		wantErr bool
+	}{
+		{version: "", wantErr: false},
+		{version: "4", wantErr: false},
+		{version: "4.2", wantErr: false},
+		{version: "1", wantErr: true},
+		{version: "5", wantErr: true},
+		{version: "40", wantErr: true},
+		{version: "", grafana: true, wantErr: false},
+		{version: "1", grafana: true, wantErr: false},
+		{version: "4", grafana: true, wantErr: true},
+		{version: "2", grafana: true, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		extra := ""
+		if tt.grafana {
+			extra = `,"orgId":1,"title":"[FIRING:1] Test"`
+		}
+		body := `{"version":"` + tt.version + `","status":"firing","alerts":[]` + extra + `}`
+		_, err := decodeAlertmanagerPayload(strings.NewReader(body))
+		if got := errors.Is(err, errUnsupportedPayloadVersion); got != tt.wantErr {
+			t.Fatalf("version %q (grafana=%v): expected unsupported=%v, got error %v",
+				tt.version, tt.grafana, tt.wantErr, err)
+		}
+	}
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// Async mode defaults: an investigation with no callback for an hour is abandoned, and
+// pending investigations are checked at least once a minute.
+const (
+	defaultAsyncTimeout  = time.Hour
+	pendingCheckInterval = time.Minute
+)
+
+// callbackPath is the path, followed by the investigation ID, that OpenClaw posts the
+// result of an asynchronous investigation to.
+const callbackPath = "/callbacks/openclaw/"
+
+// investigationIDKey is the context key of the investigation ID a forward is recorded under.
+type investigationIDKey struct{}
+
+// WithInvestigationID returns a context that makes Forward send id to OpenClaw as the
+// investigation ID in async mode, so that the callback refers to the record it is saved under.
+func WithInvestigationID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, investigationIDKey{}, id)
+}
+
+// investigationIDFrom returns the investigation ID of ctx, or "".
+func investigationIDFrom(ctx context.Context) string {
+	id, _ := ctx.Value(investigationIDKey{}).(string)
+	return id
+}
+
+// errNotPending is returned when completing an investigation that is no longer pending.
+var errNotPending = errors.New("investigation is not pending")
+
+// callbackRequest is the body OpenClaw posts when an asynchronous investigation ends.
+// The result is either a full chat completions response or just the answer's content.
+// Status defaults to failed if an error is given and to succeeded otherwise.
+type callbackRequest struct {
+	Status   string        `json:"status"`
+	Response *chatResponse `json:"response,omitempty"`
+	Content  string        `json:"content,omitempty"`
+	Error    string        `json:"error,omitempty"`
+}
+
+// complete applies the callback to a pending investigation.
+func (cb *callbackRequest) complete(inv *Investigation) error {
+	if inv.Status != investigationPending {
+		return errNotPending
+	}
+	inv.Status = cb.Status
+	inv.CompletedAt = time.Now().UTC()
+	inv.Error = cb.Error
+	switch {
+	case cb.Response != nil:
+		inv.Response = cb.Response
+	case cb.Content != "":
+		inv.Response = &chatResponse{Choices: []chatChoice{{
+			Message:      chatMessage{Role: "assistant", Content: cb.Content},
+			FinishReason: "stop",
+		}}}
+	}
+	return nil
+}
+
+// decodeCallback reads and validates a callback body.
+func decodeCallback(r *http.Request) (*callbackRequest, error) {
+	var cb callbackRequest
+	if err := json.NewDecoder(r.Body).Decode(&cb); err != nil {
+		return nil, fmt.Errorf("invalid JSON: %w", err)
+	}
+	if cb.Status == "" {
+		cb.Status = investigationSucceeded
+		if cb.Error != "" {
+			cb.Status = investigationFailed
+		}
+	}
+	if cb.Status != investigationSucceeded && cb.Status != investigationFailed {
+		return nil, errors.New(`status must be "succeeded" or "failed"`)
+	}
+	return &cb, nil
+}
+
+// callbackHandler completes the pending investigation named in the path with the result
+// OpenClaw posts. It answers 404 for an unknown investigation and 409 for one that
+// already completed or was abandoned.
+func callbackHandler(store *InvestigationStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !checkContentType(w, r) {
+			return
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, maxResponseSize)
+		cb, err := decodeCallback(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		id := r.PathValue("id")
+		inv, err := store.Update(id, cb.complete)
+		switch {
+		case errors.Is(err, errInvestigationNotFound):
+			http.Error(w, "Not Found", http.StatusNotFound)
+			return
+		case errors.Is(err, errNotPending):
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		case err != nil:
+			slog.Error("failed to save investigation", "id", id, "error", err)
+		}
+		metrics.asyncInvestigations.Inc(inv.Status)
+		slog.Info("openclaw investigation completed", "id", id, "route", inv.Route, "status", inv.Status)
+		writeJSON(w, http.StatusOK, newInvestigationView(inv))
+	}
+}
+
+// newPendingInvestigation returns the record saved under id before an async
+// investigation is submitted, so that a callback arriving before the submit returns
+// finds it. It has no submission time until the submit returns and is not abandoned
+// until then.
+func newPendingInvestigation(id, route string, item *queueItem) *Investigation {
+	return &Investigation{
+		ID:         id,
+		Route:      route,
+		Status:     investigationPending,
+		EnqueuedAt: item.enqueuedAt,
+		StartedAt:  time.Now().UTC(),
+		Payload:    item.payload,
+	}
+}
+
+// mergeSubmit returns the update that replaces the record saved before submitting an
+// async investigation with inv, the outcome of the submit. If OpenClaw's callback
+// already completed the record, its outcome is kept.
+func mergeSubmit(inv *Investigation) func(*Investigation) error {
+	return func(stored *Investigation) error {
+		completed := *stored
+		*stored = *inv
+		if completed.Status != investigationPending {
+			stored.Status = completed.Status
+			stored.CompletedAt = completed.CompletedAt
+			stored.Response = completed.Response
+			stored.Error = completed.Error
+		}
+		return nil
+	}
+}
+
+// watchPending abandons pending investigations that were submitted more than timeout
+// ago, checking until ctx is done. A non-positive timeout disables it.
+func watchPending(ctx context.Context, store *InvestigationStore, timeout time.Duration) {
+	if timeout <= 0 {
+		return
+	}
+	ticker := time.NewTicker(min(timeout, pendingCheckInterval))
+	defer ticker.Stop()
+
+	for {
+		abandonPending(store, timeout, time.Now())
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// abandonPending marks the pending investigations submitted more than timeout before now
+// as abandoned and returns how many it marked. Investigations still being submitted are skipped.
+func abandonPending(store *InvestigationStore, timeout time.Duration, now time.Time) int {
+	abandon := func(inv *Investigation) error {
+		if inv.Status != investigationPending {
+			return errNotPending
+		}
+		inv.Status = investigationAbandoned
+		inv.CompletedAt = now.UTC()
+		inv.Error = fmt.Sprintf("no callback from openclaw within %s", timeout)
+		return nil
+	}
+
+	abandoned := 0
+	for _, inv := range store.List() {
+		if inv.Status != investigationPending || inv.SubmittedAt.IsZero() || now.Sub(inv.SubmittedAt) < timeout {
+			continue
+		}
+		updated, err := store.Update(inv.ID, abandon)
+		if updated == nil {
+			continue
+		}
+		if err != nil {
+			slog.Error("failed to save investigation", "id", inv.ID, "error", err)
+		}
+		abandoned++
+		metrics.asyncInvestigations.Inc(investigationAbandoned)
+		slog.Warn("openclaw investigation abandoned", "id", inv.ID, "route", inv.Route, "timeout", timeout)
+	}
+	return abandoned
+}
@@ -0,0 +1,286 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testCallbackMux(t *testing.T) (http.Handler, *InvestigationStore) {
+	t.Helper()
+
+	store, err := NewInvestigationStore("", 10)
+	if err != nil {
+		t.Fatalf("open store: %v", err)
+	}
+	now := time.Now().UTC()
+	for _, inv := range []*Investigation{
+		{ID: "pending", Route: "root", Status: investigationPending, StartedAt: now, SubmittedAt: now},
+		{ID: "done", Route: "root", Status: investigationSucceeded, StartedAt: now, CompletedAt: now},
+	} {
+		if err := store.Save(inv); err != nil {
+			t.Fatalf("save: %v", err)
+		}
+	}
+
+	client := NewOpenClawClient("http://localhost", "token", "model")
+	queue := NewAlertQueue(client)
+	t.Cleanup(queue.Stop)
+	return NewMux(queue, "", WithInvestigationAPI(store), WithCallbackToken("callback-secret")), store
+}
+
+func postCallback(mux http.Handler, id, token, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, callbackPath+id, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, req)
+	return w
+}
+
+func TestCallback_CompletesPendingInvestigation(t *testing.T) {
+	t.Parallel()
+
+	mux, store := testCallbackMux(t)
+	before, _ := store.Get("pending")
+
+	w := postCallback(mux, "pending", "callback-secret", `{"content":"Root cause: disk full"}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var view investigationView
+	if err := json.NewDecoder(w.Body).Decode(&view); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if view.Status != investigationSucceeded || view.ResponseText != "Root cause: disk full" || view.CompletedAt.IsZero() {
+		t.Fatalf("unexpected investigation: %+v", view)
+	}
+
+	inv, _ := store.Get("pending")
+	if inv.Status != investigationSucceeded || before.Status != investigationPending {
+		t.Fatalf("expected stored record updated and previous record unchanged, got %q and %q",
+			inv.Status, before.Status)
+	}
+
+	if w := postCallback(mux, "pending", "callback-secret", `{"status":"failed"}`); w.Code != http.StatusConflict {
+		t.Fatalf("expected 409 for a second callback, got %d", w.Code)
+	}
+}
+
+func TestCallback_Errors(t *testing.T) {
+	t.Parallel()
+
+	mux, _ := testCallbackMux(t)
+
+	tests := []struct {
+		name     string
+		id       string
+		token    string
+		body     string
+		wantCode int
+	}{
+		{name: "missing token", id: "pending", body: `{}`, wantCode: http.StatusUnauthorized},
+		{name: "wrong token", id: "pending", token: "admin", body: `{}`, wantCode: http.StatusUnauthorized},
+		{name: "unknown investigation", id: "missing", token: "callback-secret", body: `{}`, wantCode: http.StatusNotFound},
+		{name: "already completed", id: "done", token: "callback-secret", body: `{}`, wantCode: http.StatusConflict},
+		{name: "invalid status", id: "pending", token: "callback-secret", body: `{"status":"abandoned"}`,
+			wantCode: http.StatusBadRequest},
+		{name: "invalid JSON", id: "pending", token: "callback-secret", body: `{`, wantCode: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		if w := postCallback(mux, tt.id, tt.token, tt.body); w.Code != tt.wantCode {
+			t.Errorf("%s: expected %d, got %d", tt.name, tt.wantCode, w.Code)
+		}
+	}
+}
+
+func TestCallback_FailureWithError(t *testing.T) {
+	t.Parallel()
+
+	mux, store := testCallbackMux(t)
+
+	w := postCallback(mux, "pending", "callback-secret", `{"error":"agent crashed"}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", w.Code)
+	}
+	inv, _ := store.Get("pending")
+	if inv.Status != investigationFailed || inv.Error != "agent crashed" {
+		t.Fatalf("unexpected investigation: %+v", inv)
+	}
+}
+
+func TestAbandonPending(t *testing.T) {
+	t.Parallel()
+
+	store, err := NewInvestigationStore("", 10)
+	if err != nil {
+		t.Fatalf("open store: %v", err)
+	}
+	now := time.Now().UTC()
+	for _, inv := range []*Investigation{
+		{ID: "stale", Status: investigationPending, SubmittedAt: now.Add(-2 * time.Hour)},
+		{ID: "recent", Status: investigationPending, SubmittedAt: now.Add(-time.Minute)},
+		{ID: "submitting", Status: investigationPending, StartedAt: now.Add(-2 * time.Hour)},
+		{ID: "failed", Status: investigationFailed, StartedAt: now.Add(-2 * time.Hour)},
+	} {
+		if err := store.Save(inv); err != nil {
+			t.Fatalf("save: %v", err)
+		}
+	}
+
+	if n := abandonPending(store, time.Hour, now); n != 1 {
+		t.Fatalf("expected 1 abandoned investigation, got %d", n)
+	}
+	want := map[string]string{
+		"stale":      investigationAbandoned,
+		"recent":     investigationPending,
+		"submitting": investigationPending,
+		"failed":     investigationFailed,
+	}
+	for id, status := range want {
+		if inv, _ := store.Get(id); inv.Status != status {
+			t.Errorf("%s: expected status %q, got %q", id, status, inv.Status)
+		}
+	}
+	if inv, _ := store.Get("stale"); inv.Error == "" || !inv.CompletedAt.Equal(now) {
+		t.Fatalf("expected abandoned investigation to record why and when, got %+v", inv)
+	}
+}
+
+func TestForward_Async(t *testing.T) {
+	t.Parallel()
+
+	var got chatRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewDecoder(r.Body).Decode(&got)
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	client := NewOpenClawClient(server.URL, "token", "model", WithAsyncCallback("https://bridge.example.com/"))
+	payload := &AlertmanagerPayload{Status: "firing", CommonLabels: map[string]string{"alertname": "Test"}}
+
+	result, err := client.Forward(WithInvestigationID(context.Background(), "inv-1"), payload)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result.InvestigationID != "inv-1" || got.Metadata["investigation_id"] != "inv-1" {
+		t.Fatalf("expected investigation ID in request metadata, got %q and %v", result.InvestigationID, got.Metadata)
+	}
+	wantURL := "https://bridge.example.com/callbacks/openclaw/inv-1"
+	if got.Metadata["callback_url"] != wantURL {
+		t.Fatalf("expected callback URL %q, got %q", wantURL, got.Metadata["callback_url"])
+	}
+
+	inv := newInvestigation("inv-1", "root", &queueItem{payload: payload}, result, nil)
+	if inv.Status != investigationPending || !inv.CompletedAt.IsZero() {
+		t.Fatalf("expected pending investigation with the submitted ID, got %+v", inv)
+	}
+}
+
+func TestForward_AsyncGeneratesInvestigationID(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	client := NewOpenClawClient(server.URL, "token", "model", WithAsyncCallback("https://bridge.example.com"))
+	result, err := client.Forward(context.Background(), &AlertmanagerPayload{Status: "firing"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result.InvestigationID == "" {
+		t.Fatal("expected an investigation ID without one in the context")
+	}
+}
+
+func TestAlertQueue_CallbackBeforeSubmitReturns(t *testing.T) {
+	t.Parallel()
+
+	store, err := NewInvestigationStore("", 10)
+	if err != nil {
+		t.Fatalf("open store: %v", err)
+	}
+	callbacks := http.NewServeMux()
+	callbacks.Handle("POST "+callbackPath+"{id}", callbackHandler(store))
+	bridge := httptest.NewServer(callbacks)
+	defer bridge.Close()
+
+	// OpenClaw finishes the investigation and calls back before it answers the submit.
+	openclaw := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req chatRequest
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		resp, err := http.Post(req.Metadata["callback_url"], "application/json",
+			strings.NewReader(`{"content":"Root cause: disk full"}`))
+		if err != nil {
+			t.Errorf("callback: %v", err)
+		} else if _ = resp.Body.Close(); resp.StatusCode != http.StatusOK {
+			t.Errorf("expected callback accepted, got %d", resp.StatusCode)
+		}
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer openclaw.Close()
+
+	client := NewOpenClawClient(openclaw.URL, "token", "model", WithAsyncCallback(bridge.URL))
+	queue := NewAlertQueue(client, WithInvestigationStore(store))
+	defer queue.Stop()
+
+	queue.process(&queueItem{payload: &AlertmanagerPayload{Status: "firing"}, enqueuedAt: time.Now()})
+
+	list := store.List()
+	if len(list) != 1 {
+		t.Fatalf("expected 1 investigation, got %d", len(list))
+	}
+	inv := list[0]
+	if inv.Status != investigationSucceeded || newInvestigationView(inv).ResponseText != "Root cause: disk full" {
+		t.Fatalf("expected the callback's outcome to be kept, got %+v", inv)
+	}
+	if inv.Prompt == "" || inv.Attempts != 1 || inv.SubmittedAt.IsZero() {
+		t.Fatalf("expected the submit's details to be recorded, got %+v", inv)
+	}
+}
+
+func TestConfig_ValidateAsync(t *testing.T) {
+	t.Parallel()
+
+	valid := config{
+		OpenClawAsync:         true,
+		OpenClawCallbackURL:   "https://bridge.example.com",
+		OpenClawCallbackToken: "secret",
+		OpenClawAsyncTimeout:  time.Hour,
+	}
+	tests := []struct {
+		name    string
+		modify  func(c *config)
+		wantErr bool
+	}{
+		{name: "valid", modify: func(*config) {}},
+		{name: "disabled", modify: func(c *config) { *c = config{} }},
+		{name: "missing callback URL", modify: func(c *config) { c.OpenClawCallbackURL = "" }, wantErr: true},
+		{name: "relative callback URL", modify: func(c *config) { c.OpenClawCallbackURL = "/callbacks" }, wantErr: true},
+		{name: "missing callback token", modify: func(c *config) { c.OpenClawCallbackToken = "" }, wantErr: true},
+		{name: "zero timeout", modify: func(c *config) { c.OpenClawAsyncTimeout = 0 }, wantErr: true},
+		{name: "negative timeout", modify: func(c *config) { c.OpenClawAsyncTimeout = -1 }, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			cfg := valid
+			tt.modify(&cfg)
+			if err := cfg.validateAsync(); (err != nil) != tt.wantErr {
+				t.Fatalf("expected error=%v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,388 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Backend pool defaults: backends are checked every 15 seconds, and three consecutive
+// failed requests eject a backend for 30 seconds.
+const (
+	defaultHealthInterval = 15 * time.Second
+	defaultHealthPath     = "/v1/models"
+	defaultEjectThreshold = 3
+	defaultEjectDuration  = 30 * time.Second
+)
+
+// balanceStrategy selects the backend of a pool that the next request is sent to.
+type balanceStrategy string
+
+// Balancing strategies. Priority sends every request to the first available backend, so
+// later backends only take over while earlier ones are down; round-robin rotates through
+// the available backends; least-in-flight picks the available backend with the fewest
+// requests in progress.
+const (
+	balancePriority      balanceStrategy = "priority"
+	balanceRoundRobin    balanceStrategy = "round_robin"
+	balanceLeastInFlight balanceStrategy = "least_in_flight"
+)
+
+// balanceStrategies lists the valid strategies.
+var balanceStrategies = []balanceStrategy{balancePriority, balanceRoundRobin, balanceLeastInFlight}
+
+// BackendConfig is one OpenClaw instance of the backend pool. Token and model default to
+// those of the route.
+type BackendConfig struct {
+	Name  string `json:"name"`
+	URL   string `json:"url"`
+	Token string `json:"token,omitempty"`
+	Model string `json:"model,omitempty"`
+}
+
+// validateBackends checks that every backend has a unique name and a URL.
+func validateBackends(backends []BackendConfig) error {
+	for i, b := range backends {
+		switch {
+		case b.Name == "":
+			return fmt.Errorf("openclaw_backends[%d]: name is required", i)
+		case b.URL == "":
+			return fmt.Errorf("openclaw_backends[%d] %q: url is required", i, b.Name)
+		case slices.ContainsFunc(backends[:i], func(o BackendConfig) bool { return o.Name == b.Name }):
+			return fmt.Errorf("openclaw_backends: duplicate backend %q", b.Name)
+		}
+	}
+	return nil
+}
+
+// backendState is the health, ejection and load of one backend. It is shared by every
+// route sending to the backend and outlives configuration reloads.
+type backendState struct {
+	name     string
+	url      string
+	inFlight atomic.Int64
+
+	mu           sync.Mutex
+	healthy      bool
+	failures     int
+	ejectedUntil time.Time
+	check        func(ctx context.Context) error
+}
+
+// available reports whether the backend passed its last health check and is not ejected.
+func (s *backendState) available(now time.Time) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.healthy && !now.Before(s.ejectedUntil)
+}
+
+// BackendStatus is the state of one backend as reported on /metrics.
+type BackendStatus struct {
+	Name     string
+	Healthy  bool
+	Ejected  bool
+	InFlight int64
+}
+
+// Backends tracks the state of the pool's backends by name. A backend that fails
+// ejectThreshold consecutive requests with a retryable error is ejected: it receives no
+// requests for ejectDuration, unless every backend is unavailable. A threshold of zero
+// disables ejection. A nil *Backends gives every pool private state.
+type Backends struct {
+	ejectThreshold int
+	ejectDuration  time.Duration
+	healthPath     string
+
+	mu     sync.Mutex
+	byName map[string]*backendState
+}
+
+// NewBackends creates the registry of backend states.
+func NewBackends(ejectThreshold int, ejectDuration time.Duration, healthPath string) *Backends {
+	return &Backends{
+		ejectThreshold: ejectThreshold,
+		ejectDuration:  ejectDuration,
+		healthPath:     healthPath,
+		byName:         make(map[string]*backendState),
+	}
+}
+
+// BackendPool is the set of backends that routes without their own URL send to.
+type BackendPool struct {
+	strategy balanceStrategy
+	configs  []BackendConfig
+	states   []*backendState
+	checks   []func(ctx context.Context) error
+	registry *Backends
+	next     atomic.Uint64
+}
+
+// Pool returns a pool for the configured backends, in priority order. Backends keep
+// their state if their name and URL are unchanged. The registry is not changed until
+// the pool is installed. Health checks authenticate with the backend's token, or token
+// if it has none, and use rt.
+func (r *Backends) Pool(
+	configs []BackendConfig, strategy balanceStrategy, token string, rt http.RoundTripper,
+) *BackendPool {
+	p := &BackendPool{strategy: strategy, configs: configs, registry: r}
+	checker := &http.Client{Transport: rt, Timeout: 10 * time.Second}
+	for _, cfg := range configs {
+		p.states = append(p.states, r.state(cfg))
+		p.checks = append(p.checks, healthCheck(checker, cfg.URL+r.path(), firstNonEmpty(cfg.Token, token)))
+	}
+	return p
+}
+
+// Install registers the backends of pools, with their health checks, in place of those
+// registered before; backends no longer configured are forgotten. It is called once the
+// router using the pools is in service, so that a rejected configuration never shows up
+// in health checks or metrics.
+func (r *Backends) Install(pools ...*BackendPool) {
+	if r == nil {
+		return
+	}
+	byName := make(map[string]*backendState)
+	for _, p := range pools {
+		for i, s := range p.states {
+			s.mu.Lock()
+			s.check = p.checks[i]
+			s.mu.Unlock()
+			byName[s.name] = s
+		}
+	}
+	r.mu.Lock()
+	r.byName = byName
+	r.mu.Unlock()
+}
+
+// state returns the state of a backend, reusing the existing one if its URL is unchanged.
+func (r *Backends) state(cfg BackendConfig) *backendState {
+	if r != nil {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+
+		if s, ok := r.byName[cfg.Name]; ok && s.url == cfg.URL {
+			return s
+		}
+	}
+	return &backendState{name: cfg.Name, url: cfg.URL, healthy: true}
+}
+
+// path returns the path requested by health checks.
+func (r *Backends) path() string {
+	if r == nil || r.healthPath == "" {
+		return defaultHealthPath
+	}
+	return r.healthPath
+}
+
+// record counts the outcome of a request to a backend, ejecting it after too many
+// consecutive failures.
+func (r *Backends) record(s *backendState, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !hostFailure(err) {
+		s.failures = 0
+		return
+	}
+	s.failures++
+	if r == nil || r.ejectThreshold <= 0 || s.failures < r.ejectThreshold {
+		return
+	}
+	s.failures = 0
+	s.ejectedUntil = time.Now().Add(r.ejectDuration)
+	metrics.backendEjections.Inc(s.name)
+	slog.Warn("openclaw backend ejected", "backend", s.name, "duration", r.ejectDuration)
+}
+
+// healthCheck returns a check that requests target and fails on a transport error or a
+// 5xx response. Other responses show that the backend is up.
+func healthCheck(client *http.Client, target, token string) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+		if err != nil {
+			return fmt.Errorf("create request: %w", err)
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+		resp, err := client.Do(req) //nolint:gosec // G704: URL is from server config, not user input.
+		if err != nil {
+			return err
+		}
+		_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, errorSnippetSize))
+		_ = resp.Body.Close()
+		if resp.StatusCode >= http.StatusInternalServerError {
+			return fmt.Errorf("health check returned status %d", resp.StatusCode)
+		}
+		return nil
+	}
+}
+
+// Run checks every backend each interval until ctx is done. A non-positive interval
+// disables health checks, leaving every backend healthy.
+func (r *Backends) Run(ctx context.Context, interval time.Duration) {
+	if r == nil || interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		r.checkAll(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// checkAll runs the health check of every backend and records the results.
+func (r *Backends) checkAll(ctx context.Context) {
+	r.mu.Lock()
+	states := make([]*backendState, 0, len(r.byName))
+	for _, s := range r.byName {
+		states = append(states, s)
+	}
+	r.mu.Unlock()
+
+	for _, s := range states {
+		s.mu.Lock()
+		check := s.check
+		s.mu.Unlock()
+		if check == nil {
+			continue
+		}
+		err := check(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+
+		s.mu.Lock()
+		changed := s.healthy != (err == nil)
+		s.healthy = err == nil
+		s.mu.Unlock()
+		switch {
+		case changed && err != nil:
+			slog.Warn("openclaw backend unhealthy", "backend", s.name, "error", err)
+		case changed:
+			slog.Info("openclaw backend healthy", "backend", s.name)
+		}
+	}
+}
+
+// States returns the state of every configured backend, sorted by name.
+func (r *Backends) States() []BackendStatus {
+	if r == nil {
+		return nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	states := make([]BackendStatus, 0, len(r.byName))
+	for name, s := range r.byName {
+		s.mu.Lock()
+		states = append(states, BackendStatus{
+			Name:     name,
+			Healthy:  s.healthy,
+			Ejected:  now.Before(s.ejectedUntil),
+			InFlight: s.inFlight.Load(),
+		})
+		s.mu.Unlock()
+	}
+	slices.SortFunc(states, func(a, b BackendStatus) int { return strings.Compare(a.Name, b.Name) })
+	return states
+}
+
+// clientBackend is a backend as seen by one client: its state plus the token and model
+// the client sends to it.
+type clientBackend struct {
+	name    string
+	url     string
+	token   string
+	model   string
+	breaker *CircuitBreaker
+	state   *backendState
+}
+
+// backendsFor returns the client backends for a route with the given fallback token and
+// model, each with the circuit breaker for its host.
+func (p *BackendPool) backendsFor(token, model string, breakers *CircuitBreakers) []*clientBackend {
+	backends := make([]*clientBackend, len(p.configs))
+	for i, cfg := range p.configs {
+		backends[i] = &clientBackend{
+			name:    cfg.Name,
+			url:     cfg.URL,
+			token:   firstNonEmpty(cfg.Token, token),
+			model:   firstNonEmpty(cfg.Model, model),
+			breaker: breakers.For(cfg.URL),
+			state:   p.states[i],
+		}
+	}
+	return backends
+}
+
+// pick selects the backend for the next request. Backends that are available and not yet
+// tried by this forward are preferred, so a failed request fails over to another backend;
+// if every backend is unavailable, all of them are candidates.
+func (p *BackendPool) pick(backends []*clientBackend, tried map[*clientBackend]bool) *clientBackend {
+	now := time.Now()
+	var available, untried []*clientBackend
+	for _, b := range backends {
+		if b.state.available(now) && b.breaker.available() {
+			available = append(available, b)
+			if !tried[b] {
+				untried = append(untried, b)
+			}
+		}
+	}
+	candidates := backends
+	switch {
+	case len(untried) > 0:
+		candidates = untried
+	case len(available) > 0:
+		candidates = available
+	}
+
+	switch p.strategy {
+	case balanceRoundRobin:
+		return candidates[int((p.next.Add(1)-1)%uint64(len(candidates)))] //nolint:gosec // G115: index is below len.
+	case balanceLeastInFlight:
+		best := candidates[0]
+		for _, b := range candidates[1:] {
+			if b.state.inFlight.Load() < best.state.inFlight.Load() {
+				best = b
+			}
+		}
+		return best
+	default:
+		return candidates[0]
+	}
+}
+
+// parseBalanceStrategy validates a strategy name.
+func parseBalanceStrategy(s string) (balanceStrategy, error) {
+	if slices.Contains(balanceStrategies, balanceStrategy(s)) {
+		return balanceStrategy(s), nil
+	}
+	return "", errors.New(`openclaw_balance must be "priority", "round_robin" or "least_in_flight"`)
+}
+
+// backendName returns the name used for a single OpenClaw URL: its host.
+func backendName(baseURL string) string {
+	if u, err := url.Parse(baseURL); err == nil && u.Host != "" {
+		return u.Host
+	}
+	return baseURL
+}
@@ -0,0 +1,229 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func testPool(strategy balanceStrategy, registry *Backends, names ...string) (*BackendPool, []*clientBackend) {
+	configs := make([]BackendConfig, len(names))
+	for i, name := range names {
+		configs[i] = BackendConfig{Name: name, URL: "http://" + name}
+	}
+	pool := registry.Pool(configs, strategy, "token", nil)
+	registry.Install(pool)
+	return pool, pool.backendsFor("token", "model", nil)
+}
+
+func TestBackendPool_Pick(t *testing.T) {
+	t.Parallel()
+
+	t.Run("priority", func(t *testing.T) {
+		t.Parallel()
+
+		pool, backends := testPool(balancePriority, nil, "primary", "standby")
+		if got := pool.pick(backends, nil); got.name != "primary" {
+			t.Fatalf("expected primary, got %s", got.name)
+		}
+		if got := pool.pick(backends, map[*clientBackend]bool{backends[0]: true}); got.name != "standby" {
+			t.Fatalf("expected failover to standby, got %s", got.name)
+		}
+		backends[0].state.healthy = false
+		if got := pool.pick(backends, nil); got.name != "standby" {
+			t.Fatalf("expected standby while primary is unhealthy, got %s", got.name)
+		}
+		backends[1].state.healthy = false
+		if got := pool.pick(backends, nil); got.name != "primary" {
+			t.Fatalf("expected primary when every backend is unavailable, got %s", got.name)
+		}
+	})
+
+	t.Run("round robin", func(t *testing.T) {
+		t.Parallel()
+
+		pool, backends := testPool(balanceRoundRobin, nil, "a", "b", "c")
+		var got []string
+		for range 4 {
+			got = append(got, pool.pick(backends, nil).name)
+		}
+		if want := []string{"a", "b", "c", "a"}; !slices.Equal(got, want) {
+			t.Fatalf("expected %v, got %v", want, got)
+		}
+	})
+
+	t.Run("least in flight", func(t *testing.T) {
+		t.Parallel()
+
+		pool, backends := testPool(balanceLeastInFlight, nil, "a", "b")
+		backends[0].state.inFlight.Add(2)
+		backends[1].state.inFlight.Add(1)
+		if got := pool.pick(backends, nil); got.name != "b" {
+			t.Fatalf("expected the backend with fewer requests in flight, got %s", got.name)
+		}
+	})
+}
+
+func TestBackends_Ejection(t *testing.T) {
+	t.Parallel()
+
+	registry := NewBackends(2, time.Hour, defaultHealthPath)
+	pool, backends := testPool(balancePriority, registry, "primary", "standby")
+	down := &requestError{kind: errorServer, status: http.StatusBadGateway}
+
+	registry.record(backends[0].state, down)
+	registry.record(backends[0].state, &requestError{kind: errorClient, status: http.StatusBadRequest})
+	registry.record(backends[0].state, down)
+	if got := pool.pick(backends, nil); got.name != "primary" {
+		t.Fatal("expected a client error to reset the failure count")
+	}
+	registry.record(backends[0].state, down)
+	if got := pool.pick(backends, nil); got.name != "standby" {
+		t.Fatalf("expected the primary to be ejected, got %s", got.name)
+	}
+	if states := registry.States(); len(states) != 2 || !states[0].Ejected || states[1].Ejected {
+		t.Fatalf("unexpected states: %+v", states)
+	}
+}
+
+func TestBackends_Install(t *testing.T) {
+	t.Parallel()
+
+	registry := NewBackends(0, 0, defaultHealthPath)
+	current, _ := testPool(balancePriority, registry, "primary", "standby")
+
+	// A pool that is built but never installed, like one of a rejected reload, leaves the
+	// registry alone.
+	moved := []BackendConfig{{Name: "primary", URL: "http://moved"}, {Name: "extra", URL: "http://extra"}}
+	rejected := registry.Pool(moved, balancePriority, "token", nil)
+	if states := registry.States(); len(states) != 2 || states[0].Name != "primary" || states[1].Name != "standby" {
+		t.Fatalf("expected the installed backends only, got %+v", states)
+	}
+	if rejected.states[0] == current.states[0] {
+		t.Fatal("expected a backend with a new URL to get new state")
+	}
+
+	other := registry.Pool([]BackendConfig{{Name: "other", URL: "http://other"}}, balancePriority, "token", nil)
+	registry.Install(current, other)
+	if states := registry.States(); len(states) != 3 {
+		t.Fatalf("expected the backends of both pools, got %+v", states)
+	}
+	registry.Install(other)
+	if states := registry.States(); len(states) != 1 || states[0].Name != "other" {
+		t.Fatalf("expected backends no longer configured to be forgotten, got %+v", states)
+	}
+}
+
+func TestBackends_HealthCheck(t *testing.T) {
+	t.Parallel()
+
+	var healthy atomic.Bool
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/status" || r.Header.Get("Authorization") != "Bearer secret" {
+			t.Errorf("unexpected health check %s with %q", r.URL.Path, r.Header.Get("Authorization"))
+		}
+		if !healthy.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+
+	registry := NewBackends(0, 0, "/status")
+	configs := []BackendConfig{{Name: "primary", URL: server.URL, Token: "secret"}}
+	registry.Install(registry.Pool(configs, balancePriority, "", nil))
+
+	registry.checkAll(context.Background())
+	if states := registry.States(); states[0].Healthy {
+		t.Fatal("expected the backend to be unhealthy")
+	}
+	healthy.Store(true)
+	registry.checkAll(context.Background())
+	if states := registry.States(); !states[0].Healthy {
+		t.Fatal("expected the backend to recover")
+	}
+}
+
+func TestForward_FailsOverToStandby(t *testing.T) {
+	t.Parallel()
+
+	var primaryCount atomic.Int32
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		primaryCount.Add(1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer primary.Close()
+	models := make(chan string, 1)
+	standby := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req chatRequest
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		models <- req.Model
+		if r.Header.Get("Authorization") != "Bearer standby-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+	}))
+	defer standby.Close()
+
+	pool := NewBackends(0, 0, defaultHealthPath).Pool([]BackendConfig{
+		{Name: "primary", URL: primary.URL},
+		{Name: "standby", URL: standby.URL, Token: "standby-token", Model: "openclaw:standby"},
+	}, balancePriority, "token", nil)
+	policy := RetryPolicy{Attempts: 3, BaseDelay: time.Hour, MaxDelay: time.Hour}
+	client := NewOpenClawClient("", "token", "openclaw:main", WithBackendPool(pool), WithRetryPolicy(policy))
+	payload := &AlertmanagerPayload{Status: "firing", CommonLabels: map[string]string{"alertname": "Test"}}
+
+	result, err := client.Forward(context.Background(), payload)
+	if err != nil {
+		t.Fatalf("expected the standby to take over, got: %v", err)
+	}
+	if primaryCount.Load() != 1 || result.Attempts != 2 {
+		t.Fatalf("expected one request to each backend, got %d attempts", result.Attempts)
+	}
+	if result.Backend != "standby" || result.Model != "openclaw:standby" || <-models != "openclaw:standby" {
+		t.Fatalf("expected the standby's model, got backend=%s model=%s", result.Backend, result.Model)
+	}
+	if result.AttemptLog[0].Backend != "primary" || result.AttemptLog[1].Backend != "standby" {
+		t.Fatalf("unexpected attempt log: %+v", result.AttemptLog)
+	}
+}
+
+func TestConfig_ValidateBackends(t *testing.T) {
+	t.Parallel()
+
+	valid := func(c config) config {
+		c.OpenClawBalance = string(balancePriority)
+		c.OpenClawHealthPath = defaultHealthPath
+		return c
+	}
+	tests := []struct {
+		name    string
+		cfg     config
+		wantErr bool
+	}{
+		{name: "none", cfg: valid(config{})},
+		{name: "pool", cfg: valid(config{OpenClawBackends: []BackendConfig{{Name: "a", URL: "http://a"}}})},
+		{name: "with url", cfg: valid(config{
+			OpenClawURL: "http://a", OpenClawBackends: []BackendConfig{{Name: "a", URL: "http://a"}},
+		}), wantErr: true},
+		{name: "missing name", cfg: valid(config{OpenClawBackends: []BackendConfig{{URL: "http://a"}}}), wantErr: true},
+		{name: "duplicate name", cfg: valid(config{OpenClawBackends: []BackendConfig{
+			{Name: "a", URL: "http://a"}, {Name: "a", URL: "http://b"},
+		}}), wantErr: true},
+		{name: "unknown strategy", cfg: config{OpenClawBalance: "random", OpenClawHealthPath: "/"}, wantErr: true},
+		{name: "ejection without duration", cfg: valid(config{OpenClawEjectThreshold: 3}), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			if err := tt.cfg.validateBackends(); (err != nil) != tt.wantErr {
+				t.Fatalf("expected error=%v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
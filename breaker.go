@@ -0,0 +1,265 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Circuit breaker defaults: five consecutive failed requests to a host open its circuit,
+// and a probe is sent after 30 seconds.
+const (
+	defaultCircuitThreshold = 5
+	defaultCircuitCooldown  = 30 * time.Second
+)
+
+// circuitState is the state of a circuit breaker.
+type circuitState int
+
+// Circuit breaker states. Requests flow while closed; while open they wait for the
+// cool-down, and while half-open a single probe request is in flight.
+const (
+	circuitClosed circuitState = iota
+	circuitHalfOpen
+	circuitOpen
+)
+
+// circuitStates lists the states in the order they are exported as metrics.
+var circuitStates = []circuitState{circuitClosed, circuitHalfOpen, circuitOpen}
+
+// String returns the state name used in logs, metrics and /healthz.
+func (s circuitState) String() string {
+	switch s {
+	case circuitHalfOpen:
+		return "half_open"
+	case circuitOpen:
+		return "open"
+	default:
+		return "closed"
+	}
+}
+
+// CircuitBreaker stops requests to an OpenClaw host that keeps failing. After threshold
+// consecutive failures the circuit opens: requests wait instead of being sent, so
+// payloads stay held rather than using up their attempts. After the cool-down one probe
+// request is let through; if it succeeds the circuit closes, otherwise it opens again.
+// A nil *CircuitBreaker never opens.
+type CircuitBreaker struct {
+	host      string
+	threshold int
+	cooldown  time.Duration
+
+	mu       sync.Mutex
+	state    circuitState
+	failures int
+	openedAt time.Time
+	changed  chan struct{}
+}
+
+// newCircuitBreaker creates a closed circuit breaker for host.
+func newCircuitBreaker(host string, threshold int, cooldown time.Duration) *CircuitBreaker {
+	return &CircuitBreaker{host: host, threshold: threshold, cooldown: cooldown, changed: make(chan struct{})}
+}
+
+// acquire waits until a request may be sent and reports whether it is the probe of a
+// half-open circuit. The caller must pass the outcome of the request to record, or call
+// release if it was abandoned.
+func (b *CircuitBreaker) acquire(ctx context.Context) (bool, error) {
+	if b == nil {
+		return false, nil
+	}
+	for {
+		b.mu.Lock()
+		if b.state == circuitClosed {
+			b.mu.Unlock()
+			return false, nil
+		}
+		wait := time.Until(b.openedAt.Add(b.cooldown))
+		if b.state == circuitOpen && wait <= 0 {
+			b.setState(circuitHalfOpen)
+			b.mu.Unlock()
+			return true, nil
+		}
+		if b.state == circuitHalfOpen {
+			wait = b.cooldown
+		}
+		changed := b.changed
+		b.mu.Unlock()
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-changed:
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return false, ctx.Err()
+		}
+		timer.Stop()
+	}
+}
+
+// record counts the outcome of a request. A failure is a transport error, a timeout or a
+// 5xx or 429 response; other responses show that the host is up. Outcomes of requests sent before
+// the circuit opened are ignored until it closes again. record reports whether the
+// request failed while the circuit is not closed, that is, because the host is down.
+func (b *CircuitBreaker) record(probe bool, err error) bool {
+	if b == nil {
+		return false
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	failed := hostFailure(err)
+	switch {
+	case probe && failed:
+		b.open()
+	case probe:
+		b.failures = 0
+		b.setState(circuitClosed)
+	case b.state != circuitClosed:
+		return failed
+	case failed:
+		b.failures++
+		if b.failures >= b.threshold {
+			b.open()
+		}
+	default:
+		b.failures = 0
+	}
+	return failed && b.state != circuitClosed
+}
+
+// release returns an abandoned probe, so that the next request becomes the probe.
+func (b *CircuitBreaker) release(probe bool) {
+	if b == nil || !probe {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.setState(circuitOpen)
+	b.openedAt = time.Now().Add(-b.cooldown)
+}
+
+// open opens the circuit for the cool-down. The caller must hold b.mu.
+func (b *CircuitBreaker) open() {
+	b.openedAt = time.Now()
+	b.setState(circuitOpen)
+}
+
+// setState moves the circuit to state and wakes the waiting requests. The caller must
+// hold b.mu.
+func (b *CircuitBreaker) setState(state circuitState) {
+	if b.state == state {
+		return
+	}
+	b.state = state
+	close(b.changed)
+	b.changed = make(chan struct{})
+	metrics.circuitTransitions.Inc(b.host, state.String())
+	switch state {
+	case circuitOpen:
+		slog.Warn("openclaw circuit opened", "host", b.host, "cooldown", b.cooldown)
+	case circuitHalfOpen:
+		slog.Info("openclaw circuit half-open, sending probe", "host", b.host)
+	case circuitClosed:
+		slog.Info("openclaw circuit closed", "host", b.host)
+	}
+}
+
+// available reports whether a request could be sent without waiting: the circuit is
+// closed, or open with the cool-down over, so that the request would be the probe.
+func (b *CircuitBreaker) available() bool {
+	if b == nil {
+		return true
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case circuitClosed:
+		return true
+	case circuitOpen:
+		return time.Since(b.openedAt) >= b.cooldown
+	default:
+		return false
+	}
+}
+
+// State returns the current state of the circuit.
+func (b *CircuitBreaker) State() circuitState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.state
+}
+
+// hostFailure reports whether a request error means the host is unavailable: every
+// retryable error kind does, client and authentication errors do not.
+func hostFailure(err error) bool {
+	return err != nil && errorKindOf(err).retryable()
+}
+
+// CircuitBreakers holds one circuit breaker per OpenClaw host. Routes to the same host
+// share a breaker, and breakers outlive configuration reloads. A threshold of zero
+// disables circuit breaking.
+type CircuitBreakers struct {
+	threshold int
+	cooldown  time.Duration
+
+	mu     sync.Mutex
+	byHost map[string]*CircuitBreaker
+}
+
+// NewCircuitBreakers creates the breakers for OpenClaw hosts.
+func NewCircuitBreakers(threshold int, cooldown time.Duration) *CircuitBreakers {
+	return &CircuitBreakers{threshold: threshold, cooldown: cooldown, byHost: make(map[string]*CircuitBreaker)}
+}
+
+// For returns the breaker for the host of baseURL, creating it on first use. It returns
+// nil if circuit breaking is disabled.
+func (s *CircuitBreakers) For(baseURL string) *CircuitBreaker {
+	if s == nil || s.threshold <= 0 {
+		return nil
+	}
+	host := baseURL
+	if u, err := url.Parse(baseURL); err == nil && u.Host != "" {
+		host = u.Host
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	b, ok := s.byHost[host]
+	if !ok {
+		b = newCircuitBreaker(host, s.threshold, s.cooldown)
+		s.byHost[host] = b
+	}
+	return b
+}
+
+// CircuitStatus is the state of the circuit of one host.
+type CircuitStatus struct {
+	Host  string
+	State circuitState
+}
+
+// States returns the state of every breaker, sorted by host.
+func (s *CircuitBreakers) States() []CircuitStatus {
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	states := make([]CircuitStatus, 0, len(s.byHost))
+	for host, b := range s.byHost {
+		states = append(states, CircuitStatus{Host: host, State: b.State()})
+	}
+	slices.SortFunc(states, func(a, b CircuitStatus) int { return strings.Compare(a.Host, b.Host) })
+	return states
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCircuitBreaker_Transitions(t *testing.T) {
+	t.Parallel()
+
+	b := newCircuitBreaker("openclaw:1", 2, 20*time.Millisecond)
+	ctx := context.Background()
+	down := &requestError{kind: errorServer, status: http.StatusServiceUnavailable}
+
+	// A client error shows the host is up and resets the failure count.
+	for _, err := range []error{down, &requestError{kind: errorClient, status: http.StatusBadRequest}, down} {
+		if held := b.record(false, err); held {
+			t.Fatalf("expected %v not to be held while the circuit is closed", err)
+		}
+	}
+	if got := b.State(); got != circuitClosed {
+		t.Fatalf("expected closed circuit, got %s", got)
+	}
+	if held := b.record(false, down); !held {
+		t.Fatal("expected the failure that opens the circuit to be held")
+	}
+	if got := b.State(); got != circuitOpen {
+		t.Fatalf("expected open circuit, got %s", got)
+	}
+
+	// After the cool-down one probe is let through; a failed probe opens the circuit again.
+	probe, err := b.acquire(ctx)
+	if err != nil || !probe {
+		t.Fatalf("expected a probe, got probe=%v err=%v", probe, err)
+	}
+	if got := b.State(); got != circuitHalfOpen {
+		t.Fatalf("expected half-open circuit, got %s", got)
+	}
+	b.record(probe, errors.New("connection refused"))
+	if got := b.State(); got != circuitOpen {
+		t.Fatalf("expected open circuit after failed probe, got %s", got)
+	}
+
+	// A successful probe closes it.
+	if probe, err = b.acquire(ctx); err != nil || !probe {
+		t.Fatalf("expected a probe, got probe=%v err=%v", probe, err)
+	}
+	b.record(probe, nil)
+	if got := b.State(); got != circuitClosed {
+		t.Fatalf("expected closed circuit after successful probe, got %s", got)
+	}
+	if probe, err = b.acquire(ctx); err != nil || probe {
+		t.Fatalf("expected a plain request, got probe=%v err=%v", probe, err)
+	}
+}
+
+func TestCircuitBreaker_AcquireCancelled(t *testing.T) {
+	t.Parallel()
+
+	b := newCircuitBreaker("openclaw:1", 1, time.Hour)
+	b.record(false, errors.New("connection refused"))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := b.acquire(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected deadline exceeded while the circuit is open, got %v", err)
+	}
+}
+
+func TestCircuitBreakers_SharedPerHost(t *testing.T) {
+	t.Parallel()
+
+	breakers := NewCircuitBreakers(3, time.Second)
+	a := breakers.For("http://openclaw:18789")
+	if breakers.For("http://openclaw:18789/v1") != a {
+		t.Fatal("expected URLs on the same host to share a breaker")
+	}
+	if breakers.For("http://standby:18789") == a {
+		t.Fatal("expected different hosts to use different breakers")
+	}
+	if got := breakers.States(); len(got) != 2 || got[0].Host != "openclaw:18789" {
+		t.Fatalf("unexpected states: %+v", got)
+	}
+	if NewCircuitBreakers(0, time.Second).For("http://openclaw:18789") != nil {
+		t.Fatal("expected no breaker with a zero threshold")
+	}
+}
+
+func TestForward_HeldWhileCircuitOpen(t *testing.T) {
+	t.Parallel()
+
+	var count atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		if count.Add(1) <= 4 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	breakers := NewCircuitBreakers(2, 20*time.Millisecond)
+	client := NewOpenClawClient(server.URL, "token", "test-model", WithCircuitBreakers(breakers))
+	payload := &AlertmanagerPayload{Status: "firing", CommonLabels: map[string]string{"alertname": "Test"}}
+
+	// Only the failure before the circuit opened counts; the rest are held until a probe succeeds.
+	result, err := client.Forward(context.Background(), payload)
+	if err != nil {
+		t.Fatalf("expected the payload to be held until the host recovers, got: %v", err)
+	}
+	if result.Attempts != 5 {
+		t.Fatalf("expected 5 requests, got %d", result.Attempts)
+	}
+	if got := breakers.States(); len(got) != 1 || got[0].State != circuitClosed {
+		t.Fatalf("expected a closed circuit, got %+v", got)
+	}
+}
@@ -0,0 +1,806 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// defaultConfigWatchInterval is how often the configuration files are checked for changes.
+const defaultConfigWatchInterval = 5 * time.Second
+
+// config holds the service settings.
+type config struct {
+	ConfigFile               string
+	ListenAddr               string
+	OpenClawURL              string
+	OpenClawToken            string
+	OpenClawModel            string
+	OpenClawCAFile           string
+	OpenClawCertFile         string
+	OpenClawKeyFile          string
+	OpenClawServerName       string
+	OpenClawProxyURL         string
+	OpenClawMaxIdleConns     int
+	OpenClawMaxIdlePerHost   int
+	OpenClawMaxConnsPerHost  int
+	OpenClawIdleConnTimeout  time.Duration
+	OpenClawBackends         []BackendConfig
+	OpenClawBalance          string
+	OpenClawHealthInterval   time.Duration
+	OpenClawHealthPath       string
+	OpenClawEjectThreshold   int
+	OpenClawEjectDuration    time.Duration
+	OpenClawRetryAttempts    int
+	OpenClawRetryBaseDelay   time.Duration
+	OpenClawRetryMaxDelay    time.Duration
+	OpenClawCircuitThreshold int
+	OpenClawCircuitCooldown  time.Duration
+	OpenClawAsync            bool
+	OpenClawCallbackURL      string
+	OpenClawCallbackToken    string
+	OpenClawAsyncTimeout     time.Duration
+	OpenClawStream           bool
+	OpenClawStreamIdle       time.Duration
+	WebhookToken             string
+	WebhookTokens            []WebhookTokenConfig
+	WebhookTokensFile        string
+	WebhookHMACSecrets       []string
+	SignatureHeader          string
+	TimestampHeader          string
+	MaxSkew                  time.Duration
+	AdminToken               string
+	TLSCertFile              string
+	TLSKeyFile               string
+	TLSClientCAFile          string
+	TLSAllowedSubjects       []string
+	TLSAllowedSANs           []string
+	JournalPath              string
+	QueueWorkers             int
+	QueueSerializeLabel      string
+	TemplateDir              string
+	RoutesFile               string
+	Routes                   *RouteConfig
+	GenericSources           map[string]GenericSourceConfig
+	InvestigationsPath       string
+	InvestigationsRetention  int
+	DeadLetterPath           string
+	DeadLetterRetention      int
+	DedupTTL                 time.Duration
+	PriorityLabel            string
+	PriorityClasses          []string
+	PriorityAging            time.Duration
+	ForwardResolved          bool
+	WatchInterval            time.Duration
+}
+
+// fileFields maps the keys of the configuration file to the settings they override.
+func (c *config) fileFields() map[string]any {
+	return map[string]any{
+		"listen_addr":                  &c.ListenAddr,
+		"openclaw_url":                 &c.OpenClawURL,
+		"openclaw_token":               &c.OpenClawToken,
+		"openclaw_model":               &c.OpenClawModel,
+		"openclaw_ca_file":             &c.OpenClawCAFile,
+		"openclaw_cert_file":           &c.OpenClawCertFile,
+		"openclaw_key_file":            &c.OpenClawKeyFile,
+		"openclaw_server_name":         &c.OpenClawServerName,
+		"openclaw_proxy_url":           &c.OpenClawProxyURL,
+		"openclaw_max_idle_conns":      &c.OpenClawMaxIdleConns,
+		"openclaw_max_idle_per_host":   &c.OpenClawMaxIdlePerHost,
+		"openclaw_max_conns_per_host":  &c.OpenClawMaxConnsPerHost,
+		"openclaw_idle_conn_timeout":   (*jsonDuration)(&c.OpenClawIdleConnTimeout),
+		"openclaw_backends":            &c.OpenClawBackends,
+		"openclaw_balance":             &c.OpenClawBalance,
+		"openclaw_health_interval":     (*jsonDuration)(&c.OpenClawHealthInterval),
+		"openclaw_health_path":         &c.OpenClawHealthPath,
+		"openclaw_eject_threshold":     &c.OpenClawEjectThreshold,
+		"openclaw_eject_duration":      (*jsonDuration)(&c.OpenClawEjectDuration),
+		"openclaw_retry_attempts":      &c.OpenClawRetryAttempts,
+		"openclaw_retry_base_delay":    (*jsonDuration)(&c.OpenClawRetryBaseDelay),
+		"openclaw_retry_max_delay":     (*jsonDuration)(&c.OpenClawRetryMaxDelay),
+		"openclaw_circuit_threshold":   &c.OpenClawCircuitThreshold,
+		"openclaw_circuit_cooldown":    (*jsonDuration)(&c.OpenClawCircuitCooldown),
+		"openclaw_async":               &c.OpenClawAsync,
+		"openclaw_callback_url":        &c.OpenClawCallbackURL,
+		"openclaw_callback_token":      &c.OpenClawCallbackToken,
+		"openclaw_async_timeout":       (*jsonDuration)(&c.OpenClawAsyncTimeout),
+		"openclaw_stream":              &c.OpenClawStream,
+		"openclaw_stream_idle_timeout": (*jsonDuration)(&c.OpenClawStreamIdle),
+		"webhook_token":                &c.WebhookToken,
+		"webhook_tokens":               &c.WebhookTokens,
+		"webhook_tokens_file":          &c.WebhookTokensFile,
+		"webhook_hmac_secrets":         &c.WebhookHMACSecrets,
+		"webhook_signature_header":     &c.SignatureHeader,
+		"webhook_timestamp_header":     &c.TimestampHeader,
+		"webhook_max_skew":             (*jsonDuration)(&c.MaxSkew),
+		"admin_token":                  &c.AdminToken,
+		"tls_cert_file":                &c.TLSCertFile,
+		"tls_key_file":                 &c.TLSKeyFile,
+		"tls_client_ca_file":           &c.TLSClientCAFile,
+		"tls_client_allowed_subjects":  &c.TLSAllowedSubjects,
+		"tls_client_allowed_sans":      &c.TLSAllowedSANs,
+		"queue_journal_path":           &c.JournalPath,
+		"queue_workers":                &c.QueueWorkers,
+		"queue_serialize_label":        &c.QueueSerializeLabel,
+		"prompt_template_dir":          &c.TemplateDir,
+		"routes_file":                  &c.RoutesFile,
+		"routes":                       &c.Routes,
+		"generic_sources":              &c.GenericSources,
+		"investigations_path":          &c.InvestigationsPath,
+		"investigations_retention":     &c.InvestigationsRetention,
+		"dead_letter_path":             &c.DeadLetterPath,
+		"dead_letter_retention":        &c.DeadLetterRetention,
+		"dedup_ttl":                    (*jsonDuration)(&c.DedupTTL),
+		"priority_label":               &c.PriorityLabel,
+		"priority_classes":             &c.PriorityClasses,
+		"priority_aging":               (*jsonDuration)(&c.PriorityAging),
+		"forward_resolved":             &c.ForwardResolved,
+		"config_watch_interval":        (*jsonDuration)(&c.WatchInterval),
+	}
+}
+
+// loadConfig reads the configuration from environment variables, applies the
+// configuration file at path on top if path is non-empty, and validates the result.
+func loadConfig(path string) (*config, error) {
+	cfg, err := configFromEnv()
+	if err != nil {
+		return nil, err
+	}
+	if path != "" {
+		cfg.ConfigFile = path
+		data, err := os.ReadFile(path) //nolint:gosec // G304: path comes from the command line.
+		if err != nil {
+			return nil, fmt.Errorf("read config file: %w", err)
+		}
+		if err := cfg.applyFile(path, data); err != nil {
+			return nil, err
+		}
+	}
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// configFromEnv reads the settings from environment variables.
+func configFromEnv() (*config, error) {
+	cfg := &config{
+		ListenAddr:            envOr("LISTEN_ADDR", ":8080"),
+		OpenClawURL:           os.Getenv("OPENCLAW_URL"),
+		OpenClawToken:         os.Getenv("OPENCLAW_TOKEN"),
+		OpenClawModel:         envOr("OPENCLAW_MODEL", "openclaw:main"),
+		OpenClawCAFile:        os.Getenv("OPENCLAW_CA_FILE"),
+		OpenClawCertFile:      os.Getenv("OPENCLAW_CERT_FILE"),
+		OpenClawKeyFile:       os.Getenv("OPENCLAW_KEY_FILE"),
+		OpenClawServerName:    os.Getenv("OPENCLAW_SERVER_NAME"),
+		OpenClawProxyURL:      os.Getenv("OPENCLAW_PROXY_URL"),
+		OpenClawBalance:       envOr("OPENCLAW_BALANCE", string(balancePriority)),
+		OpenClawHealthPath:    envOr("OPENCLAW_HEALTH_PATH", defaultHealthPath),
+		OpenClawCallbackURL:   os.Getenv("OPENCLAW_CALLBACK_URL"),
+		OpenClawCallbackToken: os.Getenv("OPENCLAW_CALLBACK_TOKEN"),
+		WebhookToken:          os.Getenv("WEBHOOK_TOKEN"),
+		WebhookTokensFile:     os.Getenv("WEBHOOK_TOKENS_FILE"),
+		WebhookHMACSecrets:    envList("WEBHOOK_HMAC_SECRETS"),
+		SignatureHeader:       envOr("WEBHOOK_SIGNATURE_HEADER", defaultSignatureHeader),
+		TimestampHeader:       envOr("WEBHOOK_TIMESTAMP_HEADER", defaultTimestampHeader),
+		AdminToken:            os.Getenv("ADMIN_TOKEN"),
+		TLSCertFile:           os.Getenv("TLS_CERT_FILE"),
+		TLSKeyFile:            os.Getenv("TLS_KEY_FILE"),
+		TLSClientCAFile:       os.Getenv("TLS_CLIENT_CA_FILE"),
+		TLSAllowedSubjects:    envList("TLS_CLIENT_ALLOWED_SUBJECTS"),
+		TLSAllowedSANs:        envList("TLS_CLIENT_ALLOWED_SANS"),
+		JournalPath:           os.Getenv("QUEUE_JOURNAL_PATH"),
+		QueueSerializeLabel:   os.Getenv("QUEUE_SERIALIZE_LABEL"),
+		TemplateDir:           os.Getenv("PROMPT_TEMPLATE_DIR"),
+		RoutesFile:            os.Getenv("ROUTES_FILE"),
+		InvestigationsPath:    os.Getenv("INVESTIGATIONS_PATH"),
+		DeadLetterPath:        os.Getenv("DEAD_LETTER_PATH"),
+		PriorityLabel:         envOr("PRIORITY_LABEL", defaultPriorityLabel),
+		PriorityClasses:       envList("PRIORITY_CLASSES"),
+	}
+	if cfg.PriorityClasses == nil {
+		cfg.PriorityClasses = defaultPriorityClasses
+	}
+
+	var err error
+	if cfg.DedupTTL, err = envDuration("DEDUP_TTL", 0); err != nil {
+		return nil, err
+	}
+	if cfg.PriorityAging, err = envDuration("PRIORITY_AGING", defaultPriorityAging); err != nil {
+		return nil, err
+	}
+	if cfg.MaxSkew, err = envDuration("WEBHOOK_MAX_SKEW", defaultMaxSkew); err != nil {
+		return nil, err
+	}
+	if cfg.ForwardResolved, err = envBool("FORWARD_RESOLVED", false); err != nil {
+		return nil, err
+	}
+	fromEnvs := []func() error{cfg.limitsFromEnv, cfg.transportFromEnv, cfg.backendsFromEnv, cfg.asyncFromEnv}
+	for _, fromEnv := range fromEnvs {
+		if err := fromEnv(); err != nil {
+			return nil, err
+		}
+	}
+	return cfg, nil
+}
+
+// asyncFromEnv reads the async investigation and streaming settings from environment
+// variables.
+func (c *config) asyncFromEnv() error {
+	var err error
+	if c.OpenClawAsync, err = envBool("OPENCLAW_ASYNC", false); err != nil {
+		return err
+	}
+	if c.OpenClawAsyncTimeout, err = envDuration("OPENCLAW_ASYNC_TIMEOUT", defaultAsyncTimeout); err != nil {
+		return err
+	}
+	if c.OpenClawStream, err = envBool("OPENCLAW_STREAM", false); err != nil {
+		return err
+	}
+	c.OpenClawStreamIdle, err = envDuration("OPENCLAW_STREAM_IDLE_TIMEOUT", defaultStreamIdleTimeout)
+	return err
+}
+
+// backendsFromEnv reads the backend pool health check and ejection settings from
+// environment variables.
+func (c *config) backendsFromEnv() error {
+	var err error
+	if c.OpenClawHealthInterval, err = envDuration("OPENCLAW_HEALTH_INTERVAL", defaultHealthInterval); err != nil {
+		return err
+	}
+	if c.OpenClawEjectThreshold, err = envInt("OPENCLAW_EJECT_THRESHOLD", defaultEjectThreshold); err != nil {
+		return err
+	}
+	c.OpenClawEjectDuration, err = envDuration("OPENCLAW_EJECT_DURATION", defaultEjectDuration)
+	return err
+}
+
+// limitsFromEnv reads the worker count, retention limits and watch interval from
+// environment variables.
+func (c *config) limitsFromEnv() error {
+	var err error
+	if c.QueueWorkers, err = envInt("QUEUE_WORKERS", 1); err != nil {
+		return err
+	}
+	if c.InvestigationsRetention, err = envInt("INVESTIGATIONS_RETENTION", defaultInvestigationRetention); err != nil {
+		return err
+	}
+	if c.DeadLetterRetention, err = envInt("DEAD_LETTER_RETENTION", defaultDeadLetterRetention); err != nil {
+		return err
+	}
+	c.WatchInterval, err = envDuration("CONFIG_WATCH_INTERVAL", defaultConfigWatchInterval)
+	return err
+}
+
+// transportFromEnv reads the OpenClaw connection pool, retry and circuit breaker settings
+// from environment variables.
+func (c *config) transportFromEnv() error {
+	var err error
+	if c.OpenClawMaxIdleConns, err = envInt("OPENCLAW_MAX_IDLE_CONNS", defaultMaxIdleConns); err != nil {
+		return err
+	}
+	if c.OpenClawMaxIdlePerHost, err = envInt("OPENCLAW_MAX_IDLE_PER_HOST", http.DefaultMaxIdleConnsPerHost); err != nil {
+		return err
+	}
+	if c.OpenClawMaxConnsPerHost, err = envInt("OPENCLAW_MAX_CONNS_PER_HOST", 0); err != nil {
+		return err
+	}
+	if c.OpenClawIdleConnTimeout, err = envDuration("OPENCLAW_IDLE_CONN_TIMEOUT", defaultIdleConnTimeout); err != nil {
+		return err
+	}
+	if c.OpenClawRetryAttempts, err = envInt("OPENCLAW_RETRY_ATTEMPTS", defaultRetryAttempts); err != nil {
+		return err
+	}
+	if c.OpenClawRetryBaseDelay, err = envDuration("OPENCLAW_RETRY_BASE_DELAY", defaultRetryBaseDelay); err != nil {
+		return err
+	}
+	if c.OpenClawRetryMaxDelay, err = envDuration("OPENCLAW_RETRY_MAX_DELAY", defaultRetryMaxDelay); err != nil {
+		return err
+	}
+	if c.OpenClawCircuitThreshold, err = envInt("OPENCLAW_CIRCUIT_THRESHOLD", defaultCircuitThreshold); err != nil {
+		return err
+	}
+	c.OpenClawCircuitCooldown, err = envDuration("OPENCLAW_CIRCUIT_COOLDOWN", defaultCircuitCooldown)
+	return err
+}
+
+// validate checks settings that depend on each other.
+func (c *config) validate() error {
+	if c.Routes != nil && c.RoutesFile != "" {
+		return errors.New("routes and routes_file are mutually exclusive")
+	}
+	checks := []func() error{
+		c.validateLimits, c.validateTLS, c.validateTransport, c.validateRetry, c.validateBackends,
+		c.validateAsync, c.validateStream, c.validateSignatures, c.validatePriority,
+	}
+	for _, check := range checks {
+		if err := check(); err != nil {
+			return err
+		}
+	}
+	if _, err := compileGenericSources(c.GenericSources); err != nil {
+		return err
+	}
+
+	// With a routing tree or a backend pool, destinations are validated per route when
+	// the router is built.
+	if c.Routes != nil || c.RoutesFile != "" || len(c.OpenClawBackends) > 0 {
+		return nil
+	}
+	if c.OpenClawURL == "" {
+		return errors.New("OPENCLAW_URL is required")
+	}
+	if c.OpenClawToken == "" {
+		return errors.New("OPENCLAW_TOKEN is required")
+	}
+	return nil
+}
+
+// validateLimits checks that counts and intervals are in range.
+func (c *config) validateLimits() error {
+	if c.QueueWorkers < 1 {
+		return errors.New("queue_workers must be at least 1")
+	}
+	if c.InvestigationsRetention < 0 {
+		return errors.New("investigations_retention must not be negative")
+	}
+	if c.DeadLetterRetention < 0 {
+		return errors.New("dead_letter_retention must not be negative")
+	}
+	if c.WatchInterval < 0 {
+		return errors.New("config_watch_interval must not be negative")
+	}
+	return nil
+}
+
+// validateTLS checks that the listener TLS settings are complete.
+func (c *config) validateTLS() error {
+	if (c.TLSCertFile == "") != (c.TLSKeyFile == "") {
+		return errors.New("tls_cert_file and tls_key_file must be set together")
+	}
+	if c.TLSClientCAFile != "" && c.TLSCertFile == "" {
+		return errors.New("tls_client_ca_file requires tls_cert_file and tls_key_file")
+	}
+	if (len(c.TLSAllowedSubjects) > 0 || len(c.TLSAllowedSANs) > 0) && c.TLSClientCAFile == "" {
+		return errors.New("tls_client_allowed_subjects and tls_client_allowed_sans require tls_client_ca_file")
+	}
+	return nil
+}
+
+// listenerTLS returns the listener TLS settings.
+func (c *config) listenerTLS() listenerTLSConfig {
+	return listenerTLSConfig{
+		CertFile:        c.TLSCertFile,
+		KeyFile:         c.TLSKeyFile,
+		ClientCAFile:    c.TLSClientCAFile,
+		AllowedSubjects: c.TLSAllowedSubjects,
+		AllowedSANs:     c.TLSAllowedSANs,
+	}
+}
+
+// validateTransport checks the OpenClaw client certificate and connection pool settings.
+func (c *config) validateTransport() error {
+	if (c.OpenClawCertFile == "") != (c.OpenClawKeyFile == "") {
+		return errors.New("openclaw_cert_file and openclaw_key_file must be set together")
+	}
+	if c.OpenClawMaxIdleConns < 0 || c.OpenClawMaxIdlePerHost < 0 || c.OpenClawMaxConnsPerHost < 0 {
+		return errors.New("OpenClaw connection limits must not be negative")
+	}
+	if c.OpenClawIdleConnTimeout < 0 {
+		return errors.New("openclaw_idle_conn_timeout must not be negative")
+	}
+	return nil
+}
+
+// transport returns the settings of the HTTP transport used to reach OpenClaw.
+func (c *config) transport() transportConfig {
+	return transportConfig{
+		CAFile:              c.OpenClawCAFile,
+		CertFile:            c.OpenClawCertFile,
+		KeyFile:             c.OpenClawKeyFile,
+		ServerName:          c.OpenClawServerName,
+		ProxyURL:            c.OpenClawProxyURL,
+		MaxIdleConns:        c.OpenClawMaxIdleConns,
+		MaxIdleConnsPerHost: c.OpenClawMaxIdlePerHost,
+		MaxConnsPerHost:     c.OpenClawMaxConnsPerHost,
+		IdleConnTimeout:     c.OpenClawIdleConnTimeout,
+	}
+}
+
+// validateRetry checks the OpenClaw retry and circuit breaker settings.
+func (c *config) validateRetry() error {
+	if c.OpenClawRetryAttempts < 1 {
+		return errors.New("openclaw_retry_attempts must be at least 1")
+	}
+	if c.OpenClawRetryBaseDelay < 0 || c.OpenClawRetryMaxDelay < c.OpenClawRetryBaseDelay {
+		return errors.New("openclaw_retry_base_delay must not be negative or exceed openclaw_retry_max_delay")
+	}
+	if c.OpenClawCircuitThreshold < 0 {
+		return errors.New("openclaw_circuit_threshold must not be negative")
+	}
+	if c.OpenClawCircuitThreshold > 0 && c.OpenClawCircuitCooldown <= 0 {
+		return errors.New("openclaw_circuit_cooldown must be positive")
+	}
+	return nil
+}
+
+// validateBackends checks the backend pool, its strategy and its health check and
+// ejection settings.
+func (c *config) validateBackends() error {
+	if len(c.OpenClawBackends) > 0 && c.OpenClawURL != "" {
+		return errors.New("openclaw_url and openclaw_backends are mutually exclusive")
+	}
+	if err := validateBackends(c.OpenClawBackends); err != nil {
+		return err
+	}
+	if _, err := parseBalanceStrategy(c.OpenClawBalance); err != nil {
+		return err
+	}
+	if c.OpenClawHealthInterval < 0 {
+		return errors.New("openclaw_health_interval must not be negative")
+	}
+	if !strings.HasPrefix(c.OpenClawHealthPath, "/") {
+		return errors.New(`openclaw_health_path must start with "/"`)
+	}
+	if c.OpenClawEjectThreshold < 0 {
+		return errors.New("openclaw_eject_threshold must not be negative")
+	}
+	if c.OpenClawEjectThreshold > 0 && c.OpenClawEjectDuration <= 0 {
+		return errors.New("openclaw_eject_duration must be positive")
+	}
+	return nil
+}
+
+// validateAsync checks that async mode has a callback URL OpenClaw can reach, a token
+// to authenticate callbacks and a timeout.
+func (c *config) validateAsync() error {
+	if c.OpenClawAsyncTimeout < 0 {
+		return errors.New("openclaw_async_timeout must not be negative")
+	}
+	if !c.OpenClawAsync {
+		return nil
+	}
+	u, err := url.Parse(c.OpenClawCallbackURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return errors.New("openclaw_async requires openclaw_callback_url, an http or https URL")
+	}
+	if c.OpenClawCallbackToken == "" {
+		return errors.New("openclaw_async requires openclaw_callback_token")
+	}
+	if c.OpenClawAsyncTimeout == 0 {
+		return errors.New("openclaw_async_timeout must be positive")
+	}
+	return nil
+}
+
+// validateStream checks that streaming has an idle timeout and is not combined with
+// async mode, whose answers arrive by callback.
+func (c *config) validateStream() error {
+	if c.OpenClawStreamIdle < 0 {
+		return errors.New("openclaw_stream_idle_timeout must not be negative")
+	}
+	if !c.OpenClawStream {
+		return nil
+	}
+	if c.OpenClawStreamIdle == 0 {
+		return errors.New("openclaw_stream_idle_timeout must be positive")
+	}
+	if c.OpenClawAsync {
+		return errors.New("openclaw_stream and openclaw_async are mutually exclusive")
+	}
+	return nil
+}
+
+// retryPolicy returns how failed OpenClaw requests are retried.
+func (c *config) retryPolicy() RetryPolicy {
+	return RetryPolicy{
+		Attempts:  c.OpenClawRetryAttempts,
+		BaseDelay: c.OpenClawRetryBaseDelay,
+		MaxDelay:  c.OpenClawRetryMaxDelay,
+	}
+}
+
+// validateSignatures checks the webhook signature settings if HMAC secrets are configured.
+func (c *config) validateSignatures() error {
+	if len(c.WebhookHMACSecrets) == 0 {
+		return nil
+	}
+	if c.WebhookToken != "" || len(c.WebhookTokens) > 0 || c.WebhookTokensFile != "" {
+		return errors.New("webhook tokens and webhook_hmac_secrets are mutually exclusive")
+	}
+	for _, secret := range c.WebhookHMACSecrets {
+		if secret == "" {
+			return errors.New("webhook_hmac_secrets must not contain empty secrets")
+		}
+	}
+	if c.SignatureHeader == "" {
+		return errors.New("webhook_signature_header is required with webhook_hmac_secrets")
+	}
+	if c.TimestampHeader != "" && c.MaxSkew <= 0 {
+		return errors.New("webhook_max_skew must be positive")
+	}
+	return nil
+}
+
+// validatePriority checks that the priority classes are distinct and that aging is not negative.
+func (c *config) validatePriority() error {
+	for i, class := range c.PriorityClasses {
+		switch {
+		case class == "":
+			return errors.New("priority_classes must not contain empty classes")
+		case class == otherPriorityClass:
+			return fmt.Errorf("priority_classes: %q is reserved for unlisted values", otherPriorityClass)
+		case slices.Contains(c.PriorityClasses[:i], class):
+			return fmt.Errorf("priority_classes: duplicate class %q", class)
+		}
+	}
+	if c.PriorityAging < 0 {
+		return errors.New("priority_aging must not be negative")
+	}
+	return nil
+}
+
+// applyFile overrides the settings with those in a JSON configuration file. The file
+// is a single object; unknown or repeated keys, type mismatches and invalid values are
+// reported with the line and column where they occur.
+func (c *config) applyFile(path string, data []byte) error {
+	fields := c.fileFields()
+	seen := make(map[string]bool)
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	if tok, err := dec.Token(); err != nil || tok != json.Delim('{') {
+		return newConfigError(path, data, errorOffset(err, 0), errors.New("expected a JSON object"))
+	}
+	for dec.More() {
+		if err := applyField(dec, path, data, fields, seen); err != nil {
+			return err
+		}
+	}
+	if _, err := dec.Token(); err != nil {
+		return newConfigError(path, data, errorOffset(err, dec.InputOffset()), err)
+	}
+	end := dec.InputOffset()
+	if _, err := dec.Token(); !errors.Is(err, io.EOF) {
+		return newConfigError(path, data, end, errors.New("unexpected data after the configuration object"))
+	}
+	return nil
+}
+
+// applyField decodes the next key and value of the configuration object into its field.
+func applyField(dec *json.Decoder, path string, data []byte, fields map[string]any, seen map[string]bool) error {
+	keyOffset := dec.InputOffset()
+	tok, err := dec.Token()
+	if err != nil {
+		return newConfigError(path, data, errorOffset(err, dec.InputOffset()), err)
+	}
+	key, _ := tok.(string)
+
+	var raw json.RawMessage
+	if err := dec.Decode(&raw); err != nil {
+		return newConfigError(path, data, errorOffset(err, dec.InputOffset()), err)
+	}
+	valueOffset := dec.InputOffset() - int64(len(raw))
+
+	target, ok := fields[key]
+	if !ok {
+		return newConfigError(path, data, keyOffset, fmt.Errorf("unknown field %q", key))
+	}
+	if seen[key] {
+		return newConfigError(path, data, keyOffset, fmt.Errorf("duplicate field %q", key))
+	}
+	seen[key] = true
+	if err := decodeStrict(raw, target); err != nil {
+		return newConfigError(path, data, valueOffset+nestedErrorOffset(raw, err), fmt.Errorf("%s: %w", key, err))
+	}
+	return nil
+}
+
+// decodeStrict unmarshals a JSON value, rejecting unknown fields in nested objects.
+func decodeStrict(raw []byte, target any) error {
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.DisallowUnknownFields()
+	return dec.Decode(target)
+}
+
+// errorOffset returns the input offset of a JSON syntax or type error, or fallback.
+func errorOffset(err error, fallback int64) int64 {
+	var syntaxErr *json.SyntaxError
+	if errors.As(err, &syntaxErr) {
+		return syntaxErr.Offset
+	}
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) {
+		return typeErr.Offset
+	}
+	return fallback
+}
+
+// nestedErrorOffset locates an error inside a decoded value. Type errors are reported
+// after the offending value, so the start of that value is used instead; unknown field
+// errors carry no offset, so the first occurrence of the field as a key is used.
+func nestedErrorOffset(raw []byte, err error) int64 {
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) {
+		return tokenStart(raw, typeErr.Offset)
+	}
+	if field, ok := strings.CutPrefix(err.Error(), "json: unknown field "); ok {
+		key := regexp.MustCompile(regexp.QuoteMeta(field) + `\s*:`)
+		if loc := key.FindIndex(raw); loc != nil {
+			return int64(loc[0])
+		}
+	}
+	return errorOffset(err, 0)
+}
+
+// tokenStart returns the offset in raw just before the JSON token that ends at end.
+func tokenStart(raw []byte, end int64) int64 {
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	for {
+		before := dec.InputOffset()
+		if _, err := dec.Token(); err != nil || dec.InputOffset() >= end {
+			return before
+		}
+	}
+}
+
+// configError is an error at a position in the configuration file.
+type configError struct {
+	path string
+	line int
+	col  int
+	err  error
+}
+
+// newConfigError converts a byte offset in data into a line and column. Leading
+// whitespace and separators are skipped, so an offset between tokens points at the next one.
+func newConfigError(path string, data []byte, offset int64, err error) *configError {
+	off := int(min(max(offset, 0), int64(len(data))))
+	for off < len(data) && strings.IndexByte(" \t\r\n,:", data[off]) >= 0 {
+		off++
+	}
+	line := 1 + bytes.Count(data[:off], []byte("\n"))
+	col := off - bytes.LastIndexByte(data[:off], '\n')
+	return &configError{path: path, line: line, col: col, err: err}
+}
+
+// Error returns the error prefixed with path:line:column.
+func (e *configError) Error() string {
+	return e.path + ":" + strconv.Itoa(e.line) + ":" + strconv.Itoa(e.col) + ": " + e.err.Error()
+}
+
+// Unwrap returns the underlying error.
+func (e *configError) Unwrap() error {
+	return e.err
+}
+
+// jsonDuration is a time.Duration written in the configuration file as a string such as "4h".
+type jsonDuration time.Duration
+
+// UnmarshalJSON parses a Go duration string.
+func (d *jsonDuration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return errors.New(`expected a duration string such as "30s"`)
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return fmt.Errorf("parse duration: %w", err)
+	}
+	*d = jsonDuration(v)
+	return nil
+}
+
+// buildRouter compiles the routing tree from the inline routes or the routes file, or a
+// single route to OPENCLAW_URL or the backend pool if neither is configured. All routes
+// share one transport, routes to the same host share a circuit breaker from breakers, and
+// backends keep their state in backends. Both may be nil. The transport of previous, the
+// running router if any, is reused while the transport settings and files are unchanged.
+func buildRouter(
+	cfg *config, templates *PromptTemplates, breakers *CircuitBreakers, backends *Backends, previous *Router,
+) (*Router, error) {
+	transport, key, err := reuseTransport(cfg.transport(), previous)
+	if err != nil {
+		return nil, err
+	}
+	var routes RouteConfig
+	switch {
+	case cfg.Routes != nil:
+		routes = *cfg.Routes
+	case cfg.RoutesFile != "":
+		if routes, err = LoadRouteConfig(cfg.RoutesFile); err != nil {
+			return nil, err
+		}
+	}
+	opts := []ClientOption{WithTransport(transport), WithRetryPolicy(cfg.retryPolicy()), WithCircuitBreakers(breakers)}
+	if cfg.OpenClawAsync {
+		opts = append(opts, WithAsyncCallback(cfg.OpenClawCallbackURL))
+	}
+	if cfg.OpenClawStream {
+		opts = append(opts, WithStreaming(cfg.OpenClawStreamIdle))
+	}
+	var router *Router
+	if len(cfg.OpenClawBackends) == 0 {
+		router, err = NewRouter(routes, cfg.OpenClawURL, cfg.OpenClawToken, cfg.OpenClawModel, templates, opts...)
+	} else {
+		pool := backends.Pool(cfg.OpenClawBackends, balanceStrategy(cfg.OpenClawBalance), cfg.OpenClawToken, transport)
+		router, err = NewPoolRouter(routes, pool, cfg.OpenClawToken, cfg.OpenClawModel, templates, opts...)
+	}
+	if err != nil {
+		return nil, err
+	}
+	router.transport, router.transportKey = transport, key
+	return router, nil
+}
+
+// reuseTransport returns the transport of previous if it was built from the same
+// settings and files, and a new transport otherwise, together with the key identifying
+// its settings and the size and modification time of its files.
+func reuseTransport(tc transportConfig, previous *Router) (*http.Transport, string, error) {
+	key := fmt.Sprintf("%+v\n%s", tc, filesStamp(tc.files()))
+	if previous != nil && previous.transport != nil && previous.transportKey == key {
+		return previous.transport, key, nil
+	}
+	transport, err := newTransport(tc)
+	return transport, key, err
+}
+
+// checkConfig loads the configuration, prompt templates, routing tree, webhook tokens and
+// TLS files the way the service does at startup, without opening any files it would write to.
+func checkConfig(path string) error {
+	cfg, err := loadConfig(path)
+	if err != nil {
+		return err
+	}
+	templates, err := LoadPromptTemplates(cfg.TemplateDir)
+	if err != nil {
+		return err
+	}
+	router, err := buildRouter(cfg, templates, nil, nil, nil)
+	if err != nil {
+		return err
+	}
+	if _, err := buildTokenSet(cfg, router); err != nil {
+		return err
+	}
+	if cfg.TLSCertFile != "" {
+		if _, err := newListenerTLS(cfg.listenerTLS()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// buildTokenSet compiles the named webhook tokens from the configuration and the tokens
+// file, checking their route policies against router. It returns nil if none are configured.
+func buildTokenSet(cfg *config, router *Router) (*TokenSet, error) {
+	tokens := cfg.WebhookTokens
+	if cfg.WebhookTokensFile != "" {
+		fromFile, err := LoadTokenFile(cfg.WebhookTokensFile)
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(slices.Clip(tokens), fromFile...)
+	}
+	if len(tokens) == 0 {
+		return nil, nil //nolint:nilnil // no named tokens is not an error.
+	}
+	set, err := NewTokenSet(tokens)
+	if err != nil {
+		return nil, err
+	}
+	if err := set.CheckRoutes(router); err != nil {
+		return nil, err
+	}
+	return set, nil
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeConfig(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+	return path
+}
+
+func TestLoadConfig_FileOverridesEnv(t *testing.T) {
+	// Not parallel: t.Setenv modifies process environment.
+	t.Setenv("OPENCLAW_URL", "http://env:18789")
+	t.Setenv("OPENCLAW_TOKEN", "env-token")
+	t.Setenv("OPENCLAW_MODEL", "openclaw:env")
+	t.Setenv("DEDUP_TTL", "1h")
+
+	path := writeConfig(t, `{
+  "openclaw_model": "openclaw:file",
+  "dedup_ttl": "4h",
+  "forward_resolved": true,
+  "routes": {"routes": [{"name": "db", "matchers": ["team=db"]}]}
+}`)
+
+	cfg, err := loadConfig(path)
+	if err != nil {
+		t.Fatalf("loadConfig: %v", err)
+	}
+	if cfg.OpenClawURL != "http://env:18789" || cfg.OpenClawToken != "env-token" {
+		t.Fatalf("expected environment values to be kept, got %q %q", cfg.OpenClawURL, cfg.OpenClawToken)
+	}
+	if cfg.OpenClawModel != "openclaw:file" || cfg.DedupTTL != 4*time.Hour || !cfg.ForwardResolved {
+		t.Fatalf("expected file values to override, got %+v", cfg)
+	}
+	if cfg.Routes == nil || len(cfg.Routes.Routes) != 1 || cfg.Routes.Routes[0].Name != "db" {
+		t.Fatalf("expected inline routes, got %+v", cfg.Routes)
+	}
+	if cfg.ConfigFile != path {
+		t.Fatalf("expected config file %q, got %q", path, cfg.ConfigFile)
+	}
+}
+
+func TestLoadConfig_FileErrors(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		content string
+		wantErr string
+	}{
+		{
+			name:    "unknown field",
+			content: "{\n  \"openclaw_url\": \"http://x\",\n  \"lisen_addr\": \":9090\"\n}",
+			wantErr: `:3:3: unknown field "lisen_addr"`,
+		},
+		{
+			name:    "type mismatch",
+			content: "{\n  \"investigations_retention\": \"many\"\n}",
+			wantErr: ":2:31: investigations_retention: json: cannot unmarshal string",
+		},
+		{
+			name:    "invalid duration",
+			content: "{\n  \"dedup_ttl\": \"4 hours\"\n}",
+			wantErr: `:2:16: dedup_ttl: parse duration`,
+		},
+		{
+			name:    "unknown field in routes",
+			content: "{\n  \"routes\": {\n    \"routes\": [\n      {\"name\": \"db\", \"matcher\": []}\n    ]\n  }\n}",
+			wantErr: `:4:22: routes: json: unknown field "matcher"`,
+		},
+		{
+			name:    "duplicate field",
+			content: "{\n  \"openclaw_model\": \"a\",\n  \"openclaw_model\": \"b\"\n}",
+			wantErr: `:3:3: duplicate field "openclaw_model"`,
+		},
+		{
+			name:    "syntax error",
+			content: "{\n  \"openclaw_model\": \"a\",\n}",
+			wantErr: ":3:1: invalid character",
+		},
+		{
+			name:    "not an object",
+			content: "[]",
+			wantErr: ":1:1: expected a JSON object",
+		},
+		{
+			name:    "trailing data",
+			content: "{}\n{}",
+			wantErr: ":2:1: unexpected data after the configuration object",
+		},
+		{
+			name:    "routes and routes_file",
+			content: `{"routes": {}, "routes_file": "routes.json"}`,
+			wantErr: "routes and routes_file are mutually exclusive",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := loadConfig(writeConfig(t, tt.content))
+			if err == nil {
+				t.Fatal("expected error, got nil")
+			}
+			if !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("expected error containing %q, got %q", tt.wantErr, err.Error())
+			}
+		})
+	}
+}
+
+func TestCheckConfig(t *testing.T) {
+	t.Parallel()
+
+	valid := writeConfig(t, `{
+  "openclaw_url": "http://openclaw:18789",
+  "openclaw_token": "token",
+  "routes": {"routes": [{"matchers": ["team=db"], "model": "openclaw:db"}]}
+}`)
+	if err := checkConfig(valid); err != nil {
+		t.Fatalf("expected valid configuration, got %v", err)
+	}
+
+	invalid := writeConfig(t, `{
+  "openclaw_url": "http://openclaw:18789",
+  "openclaw_token": "token",
+  "routes": {"routes": [{"name": "db", "matchers": ["team=db"], "template": "missing"}]}
+}`)
+	err := checkConfig(invalid)
+	if err == nil || !strings.Contains(err.Error(), `unknown prompt template "missing"`) {
+		t.Fatalf("expected unknown template error, got %v", err)
+	}
+}
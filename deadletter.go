@@ -0,0 +1,338 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// defaultDeadLetterRetention is the number of dead letters kept by default.
+const defaultDeadLetterRetention = 1000
+
+// Dead-letter store errors.
+var (
+	// errDeadLettersClosed is returned when saving dead letters after the store was closed.
+	errDeadLettersClosed = errors.New("dead-letter store closed")
+	// errDeadLettersFull is returned by Add once the store holds its retention limit.
+	errDeadLettersFull = errors.New("dead-letter store is full")
+)
+
+// DeadLetter is a payload that failed on at least one route after all attempts, kept
+// for inspection and replay.
+type DeadLetter struct {
+	ID         string               `json:"id"`
+	FailedAt   time.Time            `json:"failed_at"`
+	EnqueuedAt time.Time            `json:"enqueued_at,omitzero"`
+	Payload    *AlertmanagerPayload `json:"payload"`
+	Failures   []RouteFailure       `json:"failures"`
+}
+
+// RouteFailure describes why forwarding a payload to one route failed: the error, the
+// errors it wraps, and every HTTP request that was made.
+type RouteFailure struct {
+	Route      string           `json:"route"`
+	Error      string           `json:"error"`
+	ErrorChain []string         `json:"error_chain"`
+	Attempts   []ForwardAttempt `json:"attempts,omitempty"`
+}
+
+// newRouteFailure records a failed forward to a route. result may be nil if no request
+// was made.
+func newRouteFailure(route string, result *ForwardResult, err error) RouteFailure {
+	f := RouteFailure{Route: route, Error: err.Error(), ErrorChain: errorChain(err)}
+	if result != nil {
+		f.Attempts = result.AttemptLog
+	}
+	return f
+}
+
+// errorChain returns the message of err and of every error it wraps, outermost first.
+func errorChain(err error) []string {
+	var chain []string
+	for ; err != nil; err = errors.Unwrap(err) {
+		chain = append(chain, err.Error())
+	}
+	return chain
+}
+
+// DeadLetterStore keeps the most recent dead letters in memory and, if a path is
+// configured, in a JSON-lines file that is appended to on every change, compacted as it
+// grows and reloaded on start.
+type DeadLetterStore struct {
+	mu        sync.RWMutex
+	path      string
+	retention int
+	f         *os.File
+	lines     int
+	byID      map[string]*DeadLetter
+	order     []string
+}
+
+// deadLetterRemoval is the line appended to the dead-letter file when dead letters are
+// replayed or purged.
+type deadLetterRemoval struct {
+	Removed []string `json:"removed"`
+}
+
+// deadLetterRecord is one line of the dead-letter file as read back: a dead letter or
+// a removal.
+type deadLetterRecord struct {
+	DeadLetter
+	deadLetterRemoval
+}
+
+// NewDeadLetterStore creates a store holding up to retention dead letters. If path is
+// non-empty, previously saved dead letters are loaded from it, all of them even if the
+// retention was lowered.
+func NewDeadLetterStore(path string, retention int) (*DeadLetterStore, error) {
+	if retention <= 0 {
+		retention = defaultDeadLetterRetention
+	}
+	s := &DeadLetterStore{path: path, retention: retention, byID: make(map[string]*DeadLetter)}
+	if path == "" {
+		return s, nil
+	}
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+	if err := s.rewrite(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// load reads the dead-letter file, applying removals in order.
+func (s *DeadLetterStore) load() error {
+	f, err := os.Open(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("open dead letters: %w", err)
+	}
+	defer func() { _ = f.Close() }()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), journalMaxLine)
+	line := 0
+	for scanner.Scan() {
+		line++
+		var rec deadLetterRecord
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil || (rec.ID == "" && len(rec.Removed) == 0) {
+			slog.Warn("skipping unreadable dead letter", "path", s.path, "line", line, "error", err)
+			continue
+		}
+		if len(rec.Removed) > 0 {
+			s.remove(rec.Removed)
+			continue
+		}
+		d := rec.DeadLetter
+		s.put(&d)
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("read dead letters: %w", err)
+	}
+	return nil
+}
+
+// Persistent reports whether dead letters are written to disk.
+func (s *DeadLetterStore) Persistent() bool {
+	return s.path != ""
+}
+
+// Add stores a dead letter and appends it to the file, if any. The file is synced, so a
+// dead letter is on disk once Add returns. On a write error the dead letter is kept in
+// memory only. Once the store holds retention dead letters, Add refuses new ones with
+// errDeadLettersFull rather than evicting any, since their payloads may no longer be
+// in the journal.
+func (s *DeadLetterStore) Add(d *DeadLetter) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.byID[d.ID]; !ok && len(s.order) >= s.retention {
+		metrics.deadLetters.Inc("rejected")
+		return errDeadLettersFull
+	}
+	s.put(d)
+	return s.append(d, true)
+}
+
+// put stores a dead letter in memory. The caller must hold s.mu or have exclusive access.
+func (s *DeadLetterStore) put(d *DeadLetter) {
+	if _, ok := s.byID[d.ID]; !ok {
+		s.order = append(s.order, d.ID)
+	}
+	s.byID[d.ID] = d
+}
+
+// Remove deletes the dead letters with the given IDs and returns how many existed.
+func (s *DeadLetterStore) Remove(ids ...string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	removed := s.remove(ids)
+	if len(removed) == 0 {
+		return 0, nil
+	}
+	// Removals are not synced: losing one only brings a replayed or purged dead letter back.
+	return len(removed), s.append(deadLetterRemoval{Removed: removed}, false)
+}
+
+// remove deletes the dead letters with the given IDs from memory and returns the IDs
+// that existed. The caller must hold s.mu or have exclusive access.
+func (s *DeadLetterStore) remove(ids []string) []string {
+	var removed []string
+	for _, id := range ids {
+		if _, ok := s.byID[id]; ok {
+			delete(s.byID, id)
+			removed = append(removed, id)
+		}
+	}
+	if len(removed) == 0 {
+		return nil
+	}
+	order := s.order[:0]
+	for _, id := range s.order {
+		if _, ok := s.byID[id]; ok {
+			order = append(order, id)
+		}
+	}
+	s.order = order
+	return removed
+}
+
+// append writes a dead letter or a removal to the file, if any, optionally syncing it,
+// and compacts the file once it holds more than twice the retention or, if more dead
+// letters were loaded than the retention allows, twice their number.
+// The caller must hold s.mu.
+func (s *DeadLetterStore) append(rec any, durable bool) error {
+	if s.path == "" {
+		return nil
+	}
+	if s.f == nil {
+		return errDeadLettersClosed
+	}
+	line, err := json.Marshal(rec)
+	if err != nil {
+		return fmt.Errorf("marshal dead letter: %w", err)
+	}
+	if _, err := s.f.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("write dead letters: %w", err)
+	}
+	if durable {
+		if err := s.f.Sync(); err != nil {
+			return fmt.Errorf("sync dead letters: %w", err)
+		}
+	}
+	s.lines++
+	if s.lines > 2*max(s.retention, len(s.order)) {
+		// The record is already on disk; if compaction fails, the old file stays in use.
+		if err := s.rewrite(); err != nil {
+			slog.Warn("failed to compact dead-letter file", "path", s.path, "error", err)
+		}
+	}
+	return nil
+}
+
+// rewrite replaces the file with the retained dead letters and keeps it open for
+// appending. The new file is synced before it replaces the old one, and the old one
+// stays open until then, so a failed rewrite loses nothing.
+// The caller must hold s.mu or have exclusive access.
+func (s *DeadLetterStore) rewrite() error {
+	tmpPath := s.path + ".tmp"
+	f, err := os.OpenFile(tmpPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC|os.O_APPEND, 0o600)
+	if err != nil {
+		return fmt.Errorf("create dead letters: %w", err)
+	}
+	if err := s.writeRetained(f); err != nil {
+		_ = f.Close()
+		_ = os.Remove(tmpPath)
+		return err
+	}
+	if err := os.Rename(tmpPath, s.path); err != nil {
+		_ = f.Close()
+		_ = os.Remove(tmpPath)
+		return fmt.Errorf("replace dead letters: %w", err)
+	}
+
+	if s.f != nil {
+		_ = s.f.Close()
+	}
+	s.f = f
+	s.lines = len(s.order)
+	return nil
+}
+
+// writeRetained writes the retained dead letters to f and syncs it.
+func (s *DeadLetterStore) writeRetained(f *os.File) error {
+	w := bufio.NewWriter(f)
+	enc := json.NewEncoder(w)
+	for _, id := range s.order {
+		if err := enc.Encode(s.byID[id]); err != nil {
+			return fmt.Errorf("write dead letters: %w", err)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return fmt.Errorf("write dead letters: %w", err)
+	}
+	if err := f.Sync(); err != nil {
+		return fmt.Errorf("sync dead letters: %w", err)
+	}
+	return nil
+}
+
+// Close closes the dead-letter file. Later changes are kept in memory only and return
+// an error.
+func (s *DeadLetterStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.f == nil {
+		return nil
+	}
+	err := s.f.Close()
+	s.f = nil
+	if err != nil {
+		return fmt.Errorf("close dead letters: %w", err)
+	}
+	return nil
+}
+
+// Get returns the dead letter with the given ID.
+func (s *DeadLetterStore) Get(id string) (*DeadLetter, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	d, ok := s.byID[id]
+	return d, ok
+}
+
+// List returns the stored dead letters, most recently failed first.
+func (s *DeadLetterStore) List() []*DeadLetter {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	list := make([]*DeadLetter, 0, len(s.order))
+	for _, id := range s.order {
+		list = append(list, s.byID[id])
+	}
+	sort.SliceStable(list, func(a, b int) bool { return list[a].FailedAt.After(list[b].FailedAt) })
+	return list
+}
+
+// Len returns the number of stored dead letters. A nil store holds none.
+func (s *DeadLetterStore) Len() int {
+	if s == nil {
+		return 0
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return len(s.order)
+}
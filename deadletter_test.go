@@ -0,0 +1,423 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestDeadLetterStore_PersistsAcrossRestarts(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "dead-letters.jsonl")
+	store, err := NewDeadLetterStore(path, 2)
+	if err != nil {
+		t.Fatalf("open store: %v", err)
+	}
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	add := func(id string, i int) error {
+		return store.Add(&DeadLetter{
+			ID:       id,
+			FailedAt: start.Add(time.Duration(i) * time.Minute),
+			Payload:  &AlertmanagerPayload{GroupKey: id},
+			Failures: []RouteFailure{{Route: "root", Error: "openclaw returned status 500"}},
+		})
+	}
+	for i, id := range []string{"a", "b"} {
+		if err := add(id, i); err != nil {
+			t.Fatalf("add: %v", err)
+		}
+	}
+	// A full store refuses new dead letters instead of evicting old ones.
+	if err := add("c", 2); !errors.Is(err, errDeadLettersFull) {
+		t.Fatalf("expected a full store to refuse a dead letter, got %v", err)
+	}
+	if _, ok := store.Get("a"); !ok {
+		t.Fatal("expected the oldest dead letter to be kept")
+	}
+	if n, err := store.Remove("a", "missing"); n != 1 || err != nil {
+		t.Fatalf("expected to remove 1 dead letter, got %d, %v", n, err)
+	}
+	if err := add("c", 2); err != nil {
+		t.Fatalf("add: %v", err)
+	}
+	if err := store.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+	if err := store.Add(&DeadLetter{ID: "c", FailedAt: start}); !errors.Is(err, errDeadLettersClosed) {
+		t.Fatalf("expected an add after close to fail, got %v", err)
+	}
+
+	store, err = NewDeadLetterStore(path, 2)
+	if err != nil {
+		t.Fatalf("reopen store: %v", err)
+	}
+	list := store.List()
+	if len(list) != 2 || list[0].ID != "c" || list[1].ID != "b" || list[0].Failures[0].Route != "root" {
+		t.Fatalf("expected dead letters c and b to be reloaded, got %+v", list)
+	}
+}
+
+func TestDeadLetterStore_AppendsAndCompacts(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "dead-letters.jsonl")
+	store, err := NewDeadLetterStore(path, 3)
+	if err != nil {
+		t.Fatalf("open store: %v", err)
+	}
+	defer func() { _ = store.Close() }()
+
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := range 20 {
+		id := fmt.Sprint(i)
+		if err := store.Add(&DeadLetter{ID: id, FailedAt: start.Add(time.Duration(i) * time.Minute)}); err != nil {
+			t.Fatalf("add: %v", err)
+		}
+		if i < 18 {
+			if _, err := store.Remove(id); err != nil {
+				t.Fatalf("remove: %v", err)
+			}
+		}
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	if lines := bytes.Count(data, []byte("\n")); lines > 2*3 {
+		t.Fatalf("expected the file to be compacted to at most 6 lines, got %d", lines)
+	}
+
+	reopened, err := NewDeadLetterStore(path, 3)
+	if err != nil {
+		t.Fatalf("reopen store: %v", err)
+	}
+	defer func() { _ = reopened.Close() }()
+	var ids []string
+	for _, d := range reopened.List() {
+		ids = append(ids, d.ID)
+	}
+	if !slices.Equal(ids, []string{"19", "18"}) {
+		t.Fatalf("expected the dead letters that were not removed, got %v", ids)
+	}
+}
+
+func TestAlertQueue_DeadLetter(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		http.Error(w, "model overloaded", http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	dead, err := NewDeadLetterStore("", 10)
+	if err != nil {
+		t.Fatalf("open store: %v", err)
+	}
+	client := NewOpenClawClient(server.URL, "token", "model")
+	queue := NewAlertQueue(client, WithDeadLetters(dead))
+	queue.Start()
+	defer queue.Stop()
+
+	queue.Enqueue(&AlertmanagerPayload{GroupKey: "g", CommonLabels: map[string]string{"alertname": "DiskFull"}})
+
+	deadline := time.Now().Add(10 * time.Second)
+	for dead.Len() == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for the dead letter")
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	d := dead.List()[0]
+	if len(d.Failures) != 1 || d.Failures[0].Route != "root" {
+		t.Fatalf("expected one failure on the root route, got %+v", d.Failures)
+	}
+	failure := d.Failures[0]
+	if len(failure.Attempts) != 3 || len(failure.ErrorChain) < 2 {
+		t.Fatalf("expected 3 attempts and a wrapped error, got %+v", failure)
+	}
+	if a := failure.Attempts[2]; a.Status != http.StatusInternalServerError || a.Response != "model overloaded\n" {
+		t.Fatalf("expected the status and response body, got %+v", a)
+	}
+	if stats := queue.Stats(); stats.DeadLetters != 1 {
+		t.Fatalf("expected 1 dead letter in stats, got %d", stats.DeadLetters)
+	}
+}
+
+func TestAlertQueue_FullDeadLettersKeepJournalEntry(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		http.Error(w, "bad request", http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	dead, err := NewDeadLetterStore(filepath.Join(dir, "dead-letters.jsonl"), 1)
+	if err != nil {
+		t.Fatalf("open store: %v", err)
+	}
+	defer func() { _ = dead.Close() }()
+	if err := dead.Add(&DeadLetter{ID: "old", FailedAt: time.Now()}); err != nil {
+		t.Fatalf("add: %v", err)
+	}
+	journal, err := OpenJournal(filepath.Join(dir, "queue.journal"))
+	if err != nil {
+		t.Fatalf("open journal: %v", err)
+	}
+	defer func() { _ = journal.Close() }()
+	queue := NewAlertQueue(NewOpenClawClient(server.URL, "token", "model"), WithJournal(journal), WithDeadLetters(dead))
+	defer queue.Stop()
+
+	payload := &AlertmanagerPayload{GroupKey: "g", CommonLabels: map[string]string{"alertname": "DiskFull"}}
+	id, err := journal.Append(payload)
+	if err != nil {
+		t.Fatalf("append: %v", err)
+	}
+	queue.process(&queueItem{id: id, payload: payload, enqueuedAt: time.Now()})
+
+	if _, ok := dead.Get("old"); !ok || dead.Len() != 1 {
+		t.Fatalf("expected the full store to keep its dead letter and refuse the new one, got %d", dead.Len())
+	}
+	if pending := journal.Pending(); len(pending) != 1 || pending[0].ID != id {
+		t.Fatalf("expected the refused payload to stay in the journal, got %+v", pending)
+	}
+}
+
+func testDeadLetterMux(t *testing.T) (http.Handler, *AlertQueue, *DeadLetterStore) {
+	t.Helper()
+
+	store, err := NewDeadLetterStore("", 10)
+	if err != nil {
+		t.Fatalf("open store: %v", err)
+	}
+	now := time.Now().UTC()
+	for i, d := range []*DeadLetter{
+		{
+			ID:       "disk",
+			Payload:  &AlertmanagerPayload{GroupKey: "disk", CommonLabels: map[string]string{"alertname": "DiskFull"}},
+			Failures: []RouteFailure{{Route: "root"}},
+		},
+		{
+			ID:       "cpu",
+			Payload:  &AlertmanagerPayload{GroupKey: "cpu", CommonLabels: map[string]string{"alertname": "HighCPU"}},
+			Failures: []RouteFailure{{Route: "database"}},
+		},
+	} {
+		d.FailedAt = now.Add(time.Duration(i) * time.Minute)
+		if err := store.Add(d); err != nil {
+			t.Fatalf("add: %v", err)
+		}
+	}
+
+	queue := NewAlertQueue(NewOpenClawClient("http://localhost", "token", "model"), WithCapacity(1))
+	t.Cleanup(queue.Stop)
+	return NewMux(queue, "", WithAdminToken("admin-token"), WithDeadLetterAPI(store)), queue, store
+}
+
+func serveAdmin(mux http.Handler, method, target string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, nil)
+	req.Header.Set("Authorization", "Bearer admin-token")
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, req)
+	return w
+}
+
+func TestListDeadLetters(t *testing.T) {
+	t.Parallel()
+
+	mux, _, _ := testDeadLetterMux(t)
+
+	tests := []struct {
+		query   string
+		wantIDs []string
+	}{
+		{query: "", wantIDs: []string{"cpu", "disk"}},
+		{query: "?route=root", wantIDs: []string{"disk"}},
+		{query: "?alertname=HighCPU", wantIDs: []string{"cpu"}},
+		{query: "?limit=1", wantIDs: []string{"cpu"}},
+	}
+
+	for _, tt := range tests {
+		w := serveAdmin(mux, http.MethodGet, "/dead-letters"+tt.query)
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: expected 200, got %d", tt.query, w.Code)
+		}
+		var resp struct {
+			DeadLetters []DeadLetter `json:"dead_letters"`
+			Count       int          `json:"count"`
+		}
+		if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+			t.Fatalf("%s: decode: %v", tt.query, err)
+		}
+		if resp.Count != len(tt.wantIDs) {
+			t.Fatalf("%s: expected %v, got %d dead letters", tt.query, tt.wantIDs, resp.Count)
+		}
+		for i, id := range tt.wantIDs {
+			if resp.DeadLetters[i].ID != id {
+				t.Fatalf("%s: expected %v at %d, got %q", tt.query, id, i, resp.DeadLetters[i].ID)
+			}
+		}
+	}
+
+	if w := serveAdmin(mux, http.MethodGet, "/dead-letters/disk"); w.Code != http.StatusOK {
+		t.Fatalf("expected 200 for a known dead letter, got %d", w.Code)
+	}
+	if w := serveAdmin(mux, http.MethodGet, "/dead-letters/missing"); w.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 for an unknown dead letter, got %d", w.Code)
+	}
+	if w := serveAdmin(mux, http.MethodGet, "/dead-letters?limit=0"); w.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for an invalid limit, got %d", w.Code)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/dead-letters", nil)
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, req)
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 without token, got %d", w.Code)
+	}
+}
+
+func TestReplayDeadLetters(t *testing.T) {
+	t.Parallel()
+
+	mux, queue, store := testDeadLetterMux(t)
+
+	if w := serveAdmin(mux, http.MethodPost, "/dead-letters/disk/replay"); w.Code != http.StatusAccepted {
+		t.Fatalf("expected 202, got %d", w.Code)
+	}
+	if _, ok := store.Get("disk"); ok {
+		t.Fatal("expected the replayed dead letter to be removed")
+	}
+	if depth := queue.Stats().Depth; depth != 1 {
+		t.Fatalf("expected the payload to be queued, got depth %d", depth)
+	}
+
+	// The queue is full: the dead letter is kept.
+	if w := serveAdmin(mux, http.MethodPost, "/dead-letters/replay"); w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503 with a full queue, got %d", w.Code)
+	}
+	if _, ok := store.Get("cpu"); !ok {
+		t.Fatal("expected the dead letter to be kept")
+	}
+	if w := serveAdmin(mux, http.MethodPost, "/dead-letters/missing/replay"); w.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 for an unknown dead letter, got %d", w.Code)
+	}
+}
+
+func TestReplayDeadLetters_OldestFirst(t *testing.T) {
+	t.Parallel()
+
+	mux, _, store := testDeadLetterMux(t)
+
+	if w := serveAdmin(mux, http.MethodPost, "/dead-letters/replay?limit=1"); w.Code != http.StatusAccepted {
+		t.Fatalf("expected 202, got %d", w.Code)
+	}
+	if _, ok := store.Get("disk"); ok {
+		t.Fatal("expected the oldest dead letter to be replayed")
+	}
+	if _, ok := store.Get("cpu"); !ok {
+		t.Fatal("expected the newer dead letter to be kept")
+	}
+}
+
+func TestAlertQueue_ReplayNeverCoalesces(t *testing.T) {
+	t.Parallel()
+
+	journal, err := OpenJournal(filepath.Join(t.TempDir(), "queue.journal"))
+	if err != nil {
+		t.Fatalf("open journal: %v", err)
+	}
+	defer func() { _ = journal.Close() }()
+	queue := NewAlertQueue(NewOpenClawClient("http://localhost", "token", "model"), WithJournal(journal))
+	defer queue.Stop()
+
+	newer := &AlertmanagerPayload{GroupKey: "g", Status: "firing"}
+	stale := &AlertmanagerPayload{GroupKey: "g", Status: "firing"}
+	latest := &AlertmanagerPayload{GroupKey: "g", Status: "resolved"}
+	if !queue.Enqueue(newer) || !queue.Replay(stale, []string{"web"}) || !queue.Enqueue(latest) {
+		t.Fatal("expected every payload to be queued")
+	}
+
+	// The update merges into the queued payload of the group, not into the replay.
+	if len(queue.items) != 2 || queue.items[0].payload != latest || queue.items[1].payload != stale {
+		t.Fatalf("expected the replay to be queued on its own after the group's payload, got %d items", len(queue.items))
+	}
+	pending := journal.Pending()
+	if len(pending) != 2 || !slices.Equal(pending[0].Routes, []string{"web"}) {
+		t.Fatalf("expected the replay to be journaled with its routes, got %+v", pending)
+	}
+
+	// After a restart, the replay is still limited to its routes.
+	restarted := NewAlertQueue(NewOpenClawClient("http://localhost", "token", "model"), WithJournal(journal))
+	defer restarted.Stop()
+	if len(restarted.items) != 2 || !slices.Equal(restarted.items[0].routes, []string{"web"}) {
+		t.Fatalf("expected the replay to keep its routes across a restart, got %d items", len(restarted.items))
+	}
+}
+
+func TestAlertQueue_ReplayForwardsToFailedRoutes(t *testing.T) {
+	t.Parallel()
+
+	models := make(chan string, 2)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req chatRequest
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		models <- req.Model
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	cfg := RouteConfig{Routes: []RouteConfig{
+		{Name: "db", Model: "openclaw:db", Continue: true},
+		{Name: "web", Model: "openclaw:web"},
+	}}
+	router, err := NewRouter(cfg, server.URL, "token", "openclaw:main", defaultPromptTemplates)
+	if err != nil {
+		t.Fatalf("NewRouter: %v", err)
+	}
+	queue := NewAlertQueue(nil, WithRouter(router))
+	defer queue.Stop()
+
+	queue.process(&queueItem{payload: &AlertmanagerPayload{Status: "firing"}, routes: []string{"web"}})
+
+	if len(models) != 1 {
+		t.Fatalf("expected the replay to be forwarded to 1 route, got %d", len(models))
+	}
+	if got := <-models; got != "openclaw:web" {
+		t.Fatalf("expected the failed route's model, got %q", got)
+	}
+}
+
+func TestPurgeDeadLetters(t *testing.T) {
+	t.Parallel()
+
+	mux, _, store := testDeadLetterMux(t)
+
+	if w := serveAdmin(mux, http.MethodDelete, "/dead-letters/disk"); w.Code != http.StatusNoContent {
+		t.Fatalf("expected 204, got %d", w.Code)
+	}
+	if w := serveAdmin(mux, http.MethodDelete, "/dead-letters/disk"); w.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 for a purged dead letter, got %d", w.Code)
+	}
+
+	w := serveAdmin(mux, http.MethodDelete, "/dead-letters?alertname=HighCPU")
+	var resp struct {
+		Purged int `json:"purged"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil || resp.Purged != 1 {
+		t.Fatalf("expected 1 purged dead letter, got %+v, %v", resp, err)
+	}
+	if store.Len() != 0 {
+		t.Fatalf("expected no dead letters left, got %d", store.Len())
+	}
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Deduplicator suppresses repeated notifications for a group whose firing alerts were
+// all part of the last forwarded payload for that group within the TTL.
+type Deduplicator struct {
+	mu     sync.Mutex
+	ttl    time.Duration
+	now    func() time.Time
+	groups map[string]dedupEntry
+}
+
+// dedupEntry records the firing alert fingerprints last forwarded for a group.
+type dedupEntry struct {
+	fingerprints map[string]struct{}
+	forwardedAt  time.Time
+}
+
+// NewDeduplicator creates a deduplicator that remembers forwarded groups for ttl.
+func NewDeduplicator(ttl time.Duration) *Deduplicator {
+	return &Deduplicator{
+		ttl:    ttl,
+		now:    time.Now,
+		groups: make(map[string]dedupEntry),
+	}
+}
+
+// Duplicate reports whether every firing alert in payload was already forwarded for its
+// group within the TTL. A payload with a new fingerprint or a resolved payload is never a duplicate.
+func (d *Deduplicator) Duplicate(payload *AlertmanagerPayload) bool {
+	if payload.Status == "resolved" {
+		return false
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	entry, ok := d.groups[groupKey(payload)]
+	if !ok || d.now().Sub(entry.forwardedAt) >= d.ttl {
+		return false
+	}
+	for _, fp := range firingFingerprints(payload) {
+		if _, seen := entry.fingerprints[fp]; !seen {
+			return false
+		}
+	}
+	return true
+}
+
+// Record remembers the firing alerts of a payload that was forwarded successfully.
+// A resolved payload clears its group, so the next firing notification is forwarded.
+func (d *Deduplicator) Record(payload *AlertmanagerPayload) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	now := d.now()
+	for key, entry := range d.groups {
+		if now.Sub(entry.forwardedAt) >= d.ttl {
+			delete(d.groups, key)
+		}
+	}
+
+	if payload.Status == "resolved" {
+		delete(d.groups, groupKey(payload))
+		return
+	}
+
+	fps := firingFingerprints(payload)
+	set := make(map[string]struct{}, len(fps))
+	for _, fp := range fps {
+		set[fp] = struct{}{}
+	}
+	d.groups[groupKey(payload)] = dedupEntry{fingerprints: set, forwardedAt: now}
+}
+
+// groupKey identifies the Alertmanager group of a payload, falling back to its group
+// labels when the sender did not set a group key.
+func groupKey(payload *AlertmanagerPayload) string {
+	if payload.GroupKey != "" {
+		return payload.GroupKey
+	}
+	return "labels:" + labelsFingerprint(payload.GroupLabels)
+}
+
+// firingFingerprints returns the fingerprints of all alerts in the payload that are not resolved.
+func firingFingerprints(payload *AlertmanagerPayload) []string {
+	fps := make([]string, 0, len(payload.Alerts))
+	for _, a := range payload.Alerts {
+		if a.Status == "resolved" {
+			continue
+		}
+		fps = append(fps, alertFingerprint(a))
+	}
+	return fps
+}
+
+// alertFingerprint returns the alert's fingerprint, or a hash of its labels if none was sent.
+func alertFingerprint(a Alert) string {
+	if a.Fingerprint != "" {
+		return a.Fingerprint
+	}
+	return labelsFingerprint(a.Labels)
+}
+
+// labelsFingerprint returns a stable hex hash of a label set.
+func labelsFingerprint(labels map[string]string) string {
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	for _, name := range names {
+		b.WriteString(name)
+		b.WriteByte(0)
+		b.WriteString(labels[name])
+		b.WriteByte(0)
+	}
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(b.String()))
+	return fmt.Sprintf("%016x", h.Sum64())
+}
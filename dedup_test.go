@@ -0,0 +1,99 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func dedupPayload(fingerprints ...string) *AlertmanagerPayload {
+	p := &AlertmanagerPayload{GroupKey: "{}:{alertname=\"HighCPU\"}", Status: "firing"}
+	for _, fp := range fingerprints {
+		p.Alerts = append(p.Alerts, Alert{Status: "firing", Fingerprint: fp})
+	}
+	return p
+}
+
+func TestDeduplicator(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name      string
+		forwarded *AlertmanagerPayload
+		elapsed   time.Duration
+		next      *AlertmanagerPayload
+		want      bool
+	}{
+		{
+			name: "unseen group is not a duplicate",
+			next: dedupPayload("a"),
+			want: false,
+		},
+		{
+			name:      "same firing set is a duplicate",
+			forwarded: dedupPayload("a", "b"),
+			next:      dedupPayload("b", "a"),
+			want:      true,
+		},
+		{
+			name:      "subset of forwarded set is a duplicate",
+			forwarded: dedupPayload("a", "b"),
+			next:      dedupPayload("a"),
+			want:      true,
+		},
+		{
+			name:      "new fingerprint joining the group is forwarded",
+			forwarded: dedupPayload("a"),
+			next:      dedupPayload("a", "c"),
+			want:      false,
+		},
+		{
+			name:      "expired entry is forwarded again",
+			forwarded: dedupPayload("a"),
+			elapsed:   2 * time.Hour,
+			next:      dedupPayload("a"),
+			want:      false,
+		},
+		{
+			name:      "resolved alerts are ignored",
+			forwarded: dedupPayload("a"),
+			next: &AlertmanagerPayload{
+				GroupKey: "{}:{alertname=\"HighCPU\"}",
+				Alerts:   []Alert{{Status: "firing", Fingerprint: "a"}, {Status: "resolved", Fingerprint: "z"}},
+			},
+			want: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+			d := NewDeduplicator(time.Hour)
+			d.now = func() time.Time { return now }
+			if tt.forwarded != nil {
+				d.Record(tt.forwarded)
+			}
+			now = now.Add(tt.elapsed)
+
+			if got := d.Duplicate(tt.next); got != tt.want {
+				t.Fatalf("Duplicate() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAlertFingerprint_FallsBackToLabels(t *testing.T) {
+	t.Parallel()
+
+	a := Alert{Labels: map[string]string{"alertname": "HighCPU", "instance": "server1"}}
+	b := Alert{Labels: map[string]string{"instance": "server1", "alertname": "HighCPU"}}
+	c := Alert{Labels: map[string]string{"alertname": "HighCPU", "instance": "server2"}}
+
+	if alertFingerprint(a) != alertFingerprint(b) {
+		t.Fatal("expected identical label sets to share a fingerprint")
+	}
+	if alertFingerprint(a) == alertFingerprint(c) {
+		t.Fatal("expected different label sets to have different fingerprints")
+	}
+}
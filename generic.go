@@ -0,0 +1,379 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// errMissingField is returned when a required field cannot be mapped from a generic webhook body.
+var errMissingField = errors.New("missing required field")
+
+// errUnmappedStatus is returned when a generic webhook status maps to neither firing nor resolved.
+var errUnmappedStatus = errors.New("unmapped status")
+
+// GenericSourceConfig maps fields of a JSON webhook body to an alert. Each mapping is a
+// JSONPath-like expression such as $.job.name, $.hosts[0] or $.meta["team-name"].
+type GenericSourceConfig struct {
+	Alertname   string            `json:"alertname"`
+	Status      string            `json:"status,omitempty"`
+	StatusMap   map[string]string `json:"status_map,omitempty"`
+	Labels      map[string]string `json:"labels,omitempty"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+	Fingerprint string            `json:"fingerprint,omitempty"`
+	StartsAt    string            `json:"starts_at,omitempty"`
+	GroupKey    string            `json:"group_key,omitempty"`
+	Required    []string          `json:"required,omitempty"`
+}
+
+// genericSource is a compiled GenericSourceConfig.
+type genericSource struct {
+	name        string
+	alertname   *jsonPath
+	status      *jsonPath
+	statusMap   map[string]string
+	labels      map[string]*jsonPath
+	annotations map[string]*jsonPath
+	fingerprint *jsonPath
+	startsAt    *jsonPath
+	groupKey    *jsonPath
+	required    map[string]bool
+}
+
+// compileGenericSources parses the path expressions of every generic source.
+func compileGenericSources(cfgs map[string]GenericSourceConfig) (map[string]*genericSource, error) {
+	sources := make(map[string]*genericSource, len(cfgs))
+	for name, cfg := range cfgs {
+		src, err := compileGenericSource(name, cfg)
+		if err != nil {
+			return nil, fmt.Errorf("generic source %q: %w", name, err)
+		}
+		sources[name] = src
+	}
+	return sources, nil
+}
+
+// compileGenericSource parses the path expressions of one generic source and checks
+// that its required fields are mapped.
+func compileGenericSource(name string, cfg GenericSourceConfig) (*genericSource, error) {
+	if cfg.Alertname == "" {
+		return nil, errors.New("alertname mapping is required")
+	}
+	src := &genericSource{
+		name:        name,
+		statusMap:   cfg.StatusMap,
+		labels:      make(map[string]*jsonPath, len(cfg.Labels)),
+		annotations: make(map[string]*jsonPath, len(cfg.Annotations)),
+		required:    map[string]bool{"alertname": true},
+	}
+
+	var err error
+	optional := []struct {
+		field string
+		expr  string
+		dst   **jsonPath
+	}{
+		{"alertname", cfg.Alertname, &src.alertname},
+		{"status", cfg.Status, &src.status},
+		{"fingerprint", cfg.Fingerprint, &src.fingerprint},
+		{"starts_at", cfg.StartsAt, &src.startsAt},
+		{"group_key", cfg.GroupKey, &src.groupKey},
+	}
+	for _, f := range optional {
+		if f.expr == "" {
+			continue
+		}
+		if *f.dst, err = parseJSONPath(f.expr); err != nil {
+			return nil, fmt.Errorf("%s: %w", f.field, err)
+		}
+	}
+	if err := compilePathMap("labels", cfg.Labels, src.labels); err != nil {
+		return nil, err
+	}
+	if err := compilePathMap("annotations", cfg.Annotations, src.annotations); err != nil {
+		return nil, err
+	}
+
+	for _, field := range cfg.Required {
+		if !src.mapped(field) {
+			return nil, fmt.Errorf("required field %q has no mapping", field)
+		}
+		src.required[field] = true
+	}
+	return src, nil
+}
+
+// compilePathMap parses a map of label or annotation names to path expressions.
+func compilePathMap(kind string, exprs map[string]string, dst map[string]*jsonPath) error {
+	for name, expr := range exprs {
+		p, err := parseJSONPath(expr)
+		if err != nil {
+			return fmt.Errorf("%s.%s: %w", kind, name, err)
+		}
+		dst[name] = p
+	}
+	return nil
+}
+
+// mapped reports whether a field, such as status or labels.team, has a mapping.
+func (s *genericSource) mapped(field string) bool {
+	if name, ok := strings.CutPrefix(field, "labels."); ok {
+		return s.labels[name] != nil
+	}
+	if name, ok := strings.CutPrefix(field, "annotations."); ok {
+		return s.annotations[name] != nil
+	}
+	switch field {
+	case "alertname":
+		return s.alertname != nil
+	case "status":
+		return s.status != nil
+	case "fingerprint":
+		return s.fingerprint != nil
+	case "starts_at":
+		return s.startsAt != nil
+	case "group_key":
+		return s.groupKey != nil
+	}
+	return false
+}
+
+// lookup evaluates the mapping of a field, failing if a required field has no value.
+func (s *genericSource) lookup(doc any, field string, p *jsonPath) (string, error) {
+	if p == nil {
+		return "", nil
+	}
+	v, ok := p.lookup(doc)
+	if !ok && s.required[field] {
+		return "", fmt.Errorf("%w %s (%s)", errMissingField, field, p.expr)
+	}
+	return v, nil
+}
+
+// decode converts a webhook body into a payload with a single alert. Without a status
+// mapping the alert is firing; otherwise the value is translated through status_map and
+// must end up as firing or resolved unless the map names another status explicitly.
+func (s *genericSource) decode(r io.Reader) (*AlertmanagerPayload, error) {
+	dec := json.NewDecoder(r)
+	dec.UseNumber()
+	var doc any
+	if err := dec.Decode(&doc); err != nil {
+		return nil, fmt.Errorf("decode %s webhook: %w", s.name, err)
+	}
+
+	alertname, err := s.lookup(doc, "alertname", s.alertname)
+	if err != nil {
+		return nil, err
+	}
+	status, err := s.decodeStatus(doc)
+	if err != nil {
+		return nil, err
+	}
+
+	alert := Alert{Labels: map[string]string{}, Annotations: map[string]string{}}
+	if err := s.lookupMap(doc, "labels", s.labels, alert.Labels); err != nil {
+		return nil, err
+	}
+	if err := s.lookupMap(doc, "annotations", s.annotations, alert.Annotations); err != nil {
+		return nil, err
+	}
+	alert.Labels["alertname"] = alertname
+	alert.Labels["source"] = s.name
+	if alert.Fingerprint, err = s.lookup(doc, "fingerprint", s.fingerprint); err != nil {
+		return nil, err
+	}
+	startsAt, err := s.lookup(doc, "starts_at", s.startsAt)
+	if err != nil {
+		return nil, err
+	}
+	alert.StartsAt = normalizeTimestamp(startsAt)
+	key, err := s.lookup(doc, "group_key", s.groupKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return newVendorPayload("generic/"+s.name, firstNonEmpty(key, alertname), status, alert), nil
+}
+
+// decodeStatus maps the status field of a body to an alert status.
+func (s *genericSource) decodeStatus(doc any) (string, error) {
+	raw, err := s.lookup(doc, "status", s.status)
+	if err != nil {
+		return "", err
+	}
+	if s.status == nil || (raw == "" && !s.required["status"]) {
+		return "firing", nil
+	}
+	if mapped, ok := s.statusMap[raw]; ok {
+		return mapped, nil
+	}
+	if status := strings.ToLower(raw); status == "firing" || status == "resolved" {
+		return status, nil
+	}
+	return "", fmt.Errorf("%w %q: add it to status_map", errUnmappedStatus, raw)
+}
+
+// lookupMap evaluates a map of label or annotation mappings into dst, skipping missing values.
+func (s *genericSource) lookupMap(doc any, kind string, paths map[string]*jsonPath, dst map[string]string) error {
+	for name, p := range paths {
+		v, err := s.lookup(doc, kind+"."+name, p)
+		if err != nil {
+			return err
+		}
+		if v != "" {
+			dst[name] = v
+		}
+	}
+	return nil
+}
+
+// jsonPath is a parsed path expression: $ followed by .key, ["key"] or [index] steps.
+type jsonPath struct {
+	expr  string
+	steps []pathStep
+}
+
+// pathStep selects an object member by key or an array element by index.
+type pathStep struct {
+	key   string
+	index int
+	isIdx bool
+}
+
+// parseJSONPath parses an expression such as $.alert.labels["team-name"] or $.items[0].id.
+func parseJSONPath(expr string) (*jsonPath, error) {
+	rest, ok := strings.CutPrefix(expr, "$")
+	if !ok {
+		return nil, fmt.Errorf("path %q must start with $", expr)
+	}
+	p := &jsonPath{expr: expr}
+	for rest != "" {
+		var step pathStep
+		var err error
+		switch rest[0] {
+		case '.':
+			end := strings.IndexAny(rest[1:], ".[") + 1
+			if end == 0 {
+				end = len(rest)
+			}
+			step.key, rest = rest[1:end], rest[end:]
+			if step.key == "" {
+				return nil, fmt.Errorf("path %q: empty key", expr)
+			}
+		case '[':
+			if step, rest, err = parseBracketStep(rest); err != nil {
+				return nil, fmt.Errorf("path %q: %w", expr, err)
+			}
+		default:
+			return nil, fmt.Errorf("path %q: unexpected %q", expr, rest[0])
+		}
+		p.steps = append(p.steps, step)
+	}
+	return p, nil
+}
+
+// parseBracketStep parses a leading [index], ["key"] or ['key'] step and returns the rest.
+func parseBracketStep(s string) (pathStep, string, error) {
+	end := strings.IndexByte(s, ']')
+	if end < 0 {
+		return pathStep{}, "", errors.New("unterminated [")
+	}
+	inner := s[1:end]
+	if len(inner) >= 2 && (inner[0] == '"' || inner[0] == '\'') && inner[len(inner)-1] == inner[0] {
+		return pathStep{key: inner[1 : len(inner)-1]}, s[end+1:], nil
+	}
+	n, err := strconv.Atoi(inner)
+	if err != nil || n < 0 {
+		return pathStep{}, "", fmt.Errorf("invalid index %q", inner)
+	}
+	return pathStep{index: n, isIdx: true}, s[end+1:], nil
+}
+
+// lookup evaluates the path against a decoded JSON document. Strings are returned as
+// is, numbers and booleans in their JSON form, and objects and arrays as compact JSON.
+// A missing member, out-of-range index or null value reports false.
+func (p *jsonPath) lookup(doc any) (string, bool) {
+	v := doc
+	for _, step := range p.steps {
+		switch x := v.(type) {
+		case map[string]any:
+			if step.isIdx {
+				return "", false
+			}
+			v = x[step.key]
+		case []any:
+			if !step.isIdx || step.index >= len(x) {
+				return "", false
+			}
+			v = x[step.index]
+		default:
+			return "", false
+		}
+	}
+	return jsonValueString(v)
+}
+
+// jsonValueString renders a decoded JSON value as a string.
+func jsonValueString(v any) (string, bool) {
+	switch x := v.(type) {
+	case nil:
+		return "", false
+	case string:
+		return x, true
+	case json.Number:
+		return x.String(), true
+	case bool:
+		return strconv.FormatBool(x), true
+	default:
+		var buf bytes.Buffer
+		enc := json.NewEncoder(&buf)
+		enc.SetEscapeHTML(false)
+		if err := enc.Encode(x); err != nil {
+			return "", false
+		}
+		return strings.TrimSuffix(buf.String(), "\n"), true
+	}
+}
+
+// normalizeTimestamp converts Unix timestamps in seconds or milliseconds to RFC 3339.
+// Other values are returned unchanged.
+func normalizeTimestamp(v string) string {
+	n, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		return v
+	}
+	if n >= 1e12 {
+		return epochMillisToRFC3339(strconv.FormatInt(int64(n), 10))
+	}
+	return time.Unix(int64(n), 0).UTC().Format(time.RFC3339)
+}
+
+// genericWebhookHandler dispatches POST /webhook/generic/{name} to the named source.
+func genericWebhookHandler(queue *AlertQueue, cfg muxConfig) http.HandlerFunc {
+	names := make([]string, 0, len(cfg.genericSources))
+	handlers := make(map[string]http.HandlerFunc, len(cfg.genericSources))
+	for name, src := range cfg.genericSources {
+		names = append(names, name)
+		handlers[name] = webhookHandler(queue, cfg, src.decode)
+	}
+	sort.Strings(names)
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		handler, ok := handlers[r.PathValue("name")]
+		if !ok {
+			//nolint:gosec // G706: structured slog key-value, not string interpolation.
+			slog.Warn("unknown generic webhook source", "name", r.PathValue("name"), "configured", names)
+			http.Error(w, "Not Found", http.StatusNotFound)
+			return
+		}
+		handler(w, r)
+	}
+}
@@ -0,0 +1,271 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+const genericWebhookBody = `{
+  "job": {"name": "nightly-backup", "id": 42},
+  "result": "failed",
+  "host": "db1",
+  "meta": {"team-name": "dba", "tags": ["prod", "eu"]},
+  "message": "Backup failed: disk full",
+  "finished": 1767225600
+}`
+
+var backupSourceConfig = GenericSourceConfig{
+	Alertname:   "$.job.name",
+	Status:      "$.result",
+	StatusMap:   map[string]string{"failed": "firing", "ok": "resolved", "running": "running"},
+	Labels:      map[string]string{"host": "$.host", "team": `$.meta["team-name"]`, "env": "$.meta.tags[0]"},
+	Annotations: map[string]string{"summary": "$.message", "tags": "$.meta.tags"},
+	Fingerprint: "$.job.id",
+	StartsAt:    "$.finished",
+	Required:    []string{"labels.host"},
+}
+
+func TestJSONPath_Lookup(t *testing.T) {
+	t.Parallel()
+
+	var doc any
+	dec := json.NewDecoder(strings.NewReader(genericWebhookBody))
+	dec.UseNumber()
+	if err := dec.Decode(&doc); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+
+	tests := []struct {
+		expr    string
+		want    string
+		found   bool
+		wantErr bool
+	}{
+		{expr: "$.job.name", want: "nightly-backup", found: true},
+		{expr: "$.job.id", want: "42", found: true},
+		{expr: `$.meta["team-name"]`, want: "dba", found: true},
+		{expr: "$.meta['team-name']", want: "dba", found: true},
+		{expr: "$.meta.tags[1]", want: "eu", found: true},
+		{expr: "$.meta.tags", want: `["prod","eu"]`, found: true},
+		{expr: "$.meta.tags[2]"},
+		{expr: "$.job.missing"},
+		{expr: "$.host.name"},
+		{expr: "$.job[0]"},
+		{expr: "job.name", wantErr: true},
+		{expr: "$..name", wantErr: true},
+		{expr: "$.tags[x]", wantErr: true},
+		{expr: "$.tags[0", wantErr: true},
+		{expr: "$job", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			t.Parallel()
+
+			p, err := parseJSONPath(tt.expr)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected parse error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseJSONPath: %v", err)
+			}
+			if got, found := p.lookup(doc); got != tt.want || found != tt.found {
+				t.Fatalf("expected %q (found=%v), got %q (found=%v)", tt.want, tt.found, got, found)
+			}
+		})
+	}
+}
+
+func TestGenericSource_Decode(t *testing.T) {
+	t.Parallel()
+
+	src, err := compileGenericSource("backup", backupSourceConfig)
+	if err != nil {
+		t.Fatalf("compileGenericSource: %v", err)
+	}
+
+	p, err := src.decode(strings.NewReader(genericWebhookBody))
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if p.Status != "firing" || p.GroupKey != "generic/backup:nightly-backup" || p.Source() != "generic/backup" {
+		t.Fatalf("unexpected payload: status=%q group_key=%q source=%q", p.Status, p.GroupKey, p.Source())
+	}
+	a := p.Alerts[0]
+	if a.Fingerprint != "42" || a.StartsAt != "2026-01-01T00:00:00Z" {
+		t.Fatalf("unexpected alert: fingerprint=%q startsAt=%q", a.Fingerprint, a.StartsAt)
+	}
+	wantLabels := map[string]string{
+		"alertname": "nightly-backup", "source": "backup", "host": "db1", "team": "dba", "env": "prod",
+	}
+	for k, v := range wantLabels {
+		if a.Labels[k] != v {
+			t.Errorf("label %s: expected %q, got %q", k, v, a.Labels[k])
+		}
+	}
+	if a.Annotations["summary"] != "Backup failed: disk full" || a.Annotations["tags"] != `["prod","eu"]` {
+		t.Errorf("unexpected annotations %v", a.Annotations)
+	}
+}
+
+func TestGenericSource_DecodeErrors(t *testing.T) {
+	t.Parallel()
+
+	src, err := compileGenericSource("backup", backupSourceConfig)
+	if err != nil {
+		t.Fatalf("compileGenericSource: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		body    string
+		status  string
+		wantErr error
+		message string
+	}{
+		{name: "resolved", body: strings.Replace(genericWebhookBody, `"failed"`, `"ok"`, 1), status: "resolved"},
+		{name: "mapped other", body: strings.Replace(genericWebhookBody, `"failed"`, `"running"`, 1), status: "running"},
+		{name: "literal status", body: strings.Replace(genericWebhookBody, `"failed"`, `"Resolved"`, 1), status: "resolved"},
+		{name: "no status", body: strings.Replace(genericWebhookBody, `"result": "failed",`, "", 1), status: "firing"},
+		{
+			name:    "unmapped status",
+			body:    strings.Replace(genericWebhookBody, `"failed"`, `"skipped"`, 1),
+			wantErr: errUnmappedStatus,
+			message: `unmapped status "skipped"`,
+		},
+		{
+			name:    "missing alertname",
+			body:    strings.Replace(genericWebhookBody, `"name": "nightly-backup", `, "", 1),
+			wantErr: errMissingField,
+			message: "missing required field alertname ($.job.name)",
+		},
+		{
+			name:    "missing required label",
+			body:    strings.Replace(genericWebhookBody, `"host": "db1",`, `"host": null,`, 1),
+			wantErr: errMissingField,
+			message: "missing required field labels.host ($.host)",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			p, err := src.decode(strings.NewReader(tt.body))
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) || !strings.Contains(err.Error(), tt.message) {
+					t.Fatalf("expected %q, got %v", tt.message, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("decode: %v", err)
+			}
+			if p.Status != tt.status {
+				t.Fatalf("expected status %q, got %q", tt.status, p.Status)
+			}
+		})
+	}
+}
+
+func TestCompileGenericSource_Invalid(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		cfg  GenericSourceConfig
+		want string
+	}{
+		{name: "no alertname", cfg: GenericSourceConfig{}, want: "alertname mapping is required"},
+		{name: "bad path", cfg: GenericSourceConfig{Alertname: "name"}, want: "must start with $"},
+		{
+			name: "bad label path",
+			cfg:  GenericSourceConfig{Alertname: "$.name", Labels: map[string]string{"host": "$.h["}},
+			want: "labels.host",
+		},
+		{
+			name: "unmapped required field",
+			cfg:  GenericSourceConfig{Alertname: "$.name", Required: []string{"fingerprint"}},
+			want: `required field "fingerprint" has no mapping`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := compileGenericSource("test", tt.cfg)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("expected error containing %q, got %v", tt.want, err)
+			}
+		})
+	}
+}
+
+func TestGenericWebhookEndpoint(t *testing.T) {
+	t.Parallel()
+
+	sources, err := compileGenericSources(map[string]GenericSourceConfig{"backup": backupSourceConfig})
+	if err != nil {
+		t.Fatalf("compileGenericSources: %v", err)
+	}
+	client := NewOpenClawClient("http://localhost", "token", "model")
+	queue := NewAlertQueue(client)
+	defer queue.Stop()
+	mux := NewMux(queue, "secret", WithGenericSources(sources))
+
+	post := func(path, body string) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer secret")
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := post("/webhook/generic/backup", genericWebhookBody); w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if depth := queue.Stats().Depth; depth != 1 {
+		t.Fatalf("expected 1 queued payload, got %d", depth)
+	}
+
+	w := post("/webhook/generic/backup", `{"result": "failed"}`)
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "missing required field alertname") {
+		t.Fatalf("expected 400 naming the missing field, got %d: %s", w.Code, w.Body.String())
+	}
+
+	if w := post("/webhook/generic/unknown", genericWebhookBody); w.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 for unknown source, got %d", w.Code)
+	}
+}
+
+func TestLoadConfig_GenericSources(t *testing.T) {
+	// Not parallel: t.Setenv modifies process environment.
+	t.Setenv("OPENCLAW_URL", "http://localhost")
+	t.Setenv("OPENCLAW_TOKEN", "t")
+
+	cfg, err := loadConfig(writeConfig(t, `{"generic_sources": {"backup": {"alertname": "$.job.name"}}}`))
+	if err != nil {
+		t.Fatalf("loadConfig: %v", err)
+	}
+	if cfg.GenericSources["backup"].Alertname != "$.job.name" {
+		t.Fatalf("unexpected generic sources %+v", cfg.GenericSources)
+	}
+
+	_, err = loadConfig(writeConfig(t, `{"generic_sources": {"backup": {"alertname": "job.name"}}}`))
+	if err == nil || !strings.Contains(err.Error(), `generic source "backup"`) {
+		t.Fatalf("expected invalid mapping error, got %v", err)
+	}
+	_, err = loadConfig(writeConfig(t, `{"generic_sources": {"backup": {"alertnam": "$.x"}}}`))
+	if err == nil || !strings.Contains(err.Error(), "alertnam") {
+		t.Fatalf("expected unknown field error, got %v", err)
+	}
+}
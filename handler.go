@@ -1,66 +1,221 @@
 package main
 
 import (
-	"encoding/json"
+	"crypto/subtle"
+	"errors"
 	"log/slog"
 	"net/http"
 	"strings"
 )
 
-// NewMux creates the HTTP handler with /webhook and /healthz routes.
-func NewMux(queue *AlertQueue, webhookToken string) http.Handler {
+// muxConfig holds optional settings for the HTTP handlers.
+type muxConfig struct {
+	forwardResolved bool
+	adminToken      string
+	investigations  *InvestigationStore
+	deadLetters     *DeadLetterStore
+	genericSources  map[string]*genericSource
+	signatures      *SignatureVerifier
+	tokens          *TokenSet
+	breakers        *CircuitBreakers
+	backends        *Backends
+	callbackToken   string
+}
+
+// MuxOption configures optional HTTP handler behaviour.
+type MuxOption func(*muxConfig)
+
+// WithForwardResolved enqueues resolved payloads in addition to firing ones.
+func WithForwardResolved() MuxOption {
+	return func(c *muxConfig) {
+		c.forwardResolved = true
+	}
+}
+
+// WithAdminToken requires a bearer token on the read and admin endpoints, which are
+// only served if it is set.
+func WithAdminToken(token string) MuxOption {
+	return func(c *muxConfig) {
+		c.adminToken = token
+	}
+}
+
+// WithInvestigationAPI serves the investigations in store under /investigations if an
+// admin token is set.
+func WithInvestigationAPI(store *InvestigationStore) MuxOption {
+	return func(c *muxConfig) {
+		c.investigations = store
+	}
+}
+
+// WithDeadLetterAPI serves the dead letters in store under /dead-letters, with
+// endpoints to replay them into the queue and to purge them, if an admin token is set.
+func WithDeadLetterAPI(store *DeadLetterStore) MuxOption {
+	return func(c *muxConfig) {
+		c.deadLetters = store
+	}
+}
+
+// WithGenericSources serves the generic webhook sources under /webhook/generic/{name}.
+func WithGenericSources(sources map[string]*genericSource) MuxOption {
+	return func(c *muxConfig) {
+		c.genericSources = sources
+	}
+}
+
+// WithSignatureVerifier requires a valid HMAC signature on inbound webhooks.
+func WithSignatureVerifier(v *SignatureVerifier) MuxOption {
+	return func(c *muxConfig) {
+		c.signatures = v
+	}
+}
+
+// WithWebhookTokens accepts the named tokens in tokens on the webhook endpoints, in
+// addition to the webhook token passed to NewMux, and enforces their route policies.
+func WithWebhookTokens(tokens *TokenSet) MuxOption {
+	return func(c *muxConfig) {
+		c.tokens = tokens
+	}
+}
+
+// WithCircuitStatus reports the state of the OpenClaw circuit breakers on /healthz and /metrics.
+func WithCircuitStatus(breakers *CircuitBreakers) MuxOption {
+	return func(c *muxConfig) {
+		c.breakers = breakers
+	}
+}
+
+// WithBackendStatus reports the state of the OpenClaw backend pool on /metrics.
+func WithBackendStatus(backends *Backends) MuxOption {
+	return func(c *muxConfig) {
+		c.backends = backends
+	}
+}
+
+// WithCallbackToken accepts asynchronous investigation results on
+// /callbacks/openclaw/{id}, authenticated with token.
+func WithCallbackToken(token string) MuxOption {
+	return func(c *muxConfig) {
+		c.callbackToken = token
+	}
+}
+
+// NewMux creates the HTTP handler with /webhook, the vendor and generic webhooks under
+// /webhook/, /healthz and /metrics, plus /investigations and /dead-letters if their stores
+// and an admin token are configured and /callbacks/openclaw/{id} if the investigation
+// store and a callback token are. Without an admin token, the payloads and prompts in
+// the stores are not exposed and dead letters can't be replayed or purged over HTTP.
+func NewMux(queue *AlertQueue, webhookToken string, opts ...MuxOption) http.Handler {
+	var cfg muxConfig
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	if webhookToken != "" {
+		cfg.tokens = cfg.tokens.withDefault(webhookToken)
+	}
+	webhook := func(source string, handler http.HandlerFunc) http.HandlerFunc {
+		return countWebhooks(source, authenticateWebhook(cfg.tokens, handler))
+	}
+
 	mux := http.NewServeMux()
-	mux.HandleFunc("POST /webhook", webhookHandler(queue, webhookToken))
-	mux.HandleFunc("GET /healthz", healthzHandler)
+	mux.HandleFunc("POST /webhook", webhook("alertmanager", webhookHandler(queue, cfg, decodeAlertmanagerPayload)))
+	for source, decode := range vendorDecoders {
+		mux.HandleFunc("POST /webhook/"+source, webhook(source, webhookHandler(queue, cfg, decode)))
+	}
+	mux.HandleFunc("POST /webhook/generic/{name}", webhook("generic", genericWebhookHandler(queue, cfg)))
+	mux.HandleFunc("GET /healthz", healthzHandler(queue, cfg.breakers))
+	mux.HandleFunc("GET /metrics", metricsHandler(queue, cfg.breakers, cfg.backends))
+	if cfg.investigations != nil && cfg.adminToken != "" {
+		mux.HandleFunc("GET /investigations", requireToken(cfg.adminToken, listInvestigationsHandler(cfg.investigations)))
+		mux.HandleFunc("GET /investigations/{id}", requireToken(cfg.adminToken, getInvestigationHandler(cfg.investigations)))
+	}
+	if cfg.investigations != nil && cfg.callbackToken != "" {
+		mux.HandleFunc("POST "+callbackPath+"{id}", requireToken(cfg.callbackToken, callbackHandler(cfg.investigations)))
+	}
+	if cfg.deadLetters != nil && cfg.adminToken != "" {
+		handleDeadLetters(mux, queue, cfg.deadLetters, cfg.adminToken)
+	}
 	return mux
 }
 
-// webhookHandler returns an HTTP handler that validates and enqueues Alertmanager webhook payloads.
-func webhookHandler(queue *AlertQueue, webhookToken string) http.HandlerFunc {
+// webhookHandler returns an HTTP handler that validates webhook bodies, converts them
+// with decode and enqueues the resulting payloads. Authentication happens before it, in
+// authenticateWebhook.
+func webhookHandler(queue *AlertQueue, cfg muxConfig, decode payloadDecoder) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		if !checkAuth(w, r, webhookToken) {
-			return
-		}
 		if !checkContentType(w, r) {
 			return
 		}
 
 		// Limit request body to 1 MB.
 		r.Body = http.MaxBytesReader(w, r.Body, 1<<20)
+		if !checkSignature(w, r, cfg.signatures) {
+			return
+		}
 
-		var payload AlertmanagerPayload
-		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		payload, err := decode(r.Body)
+		if rejectedPayload(err) {
+			slog.Warn("rejected webhook payload", "error", err)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err != nil {
 			slog.Warn("invalid webhook payload", "error", err)
 			http.Error(w, "Bad Request", http.StatusBadRequest)
 			return
 		}
+		payload.Caller = callerFromContext(r.Context())
+		if payload.TruncatedAlerts > 0 {
+			slog.Warn("alertmanager truncated alerts in payload", "truncated_alerts", payload.TruncatedAlerts,
+				"group_key", payload.GroupKey)
+		}
 
-		// Only forward firing alerts.
-		if payload.Status != "firing" {
-			slog.Info("ignoring non-firing alert", "status", payload.Status)
+		// Only forward firing alerts, and resolved ones if enabled.
+		if payload.Status != "firing" && (!cfg.forwardResolved || payload.Status != "resolved") {
+			slog.Info("ignoring non-firing alert", "status", payload.Status, "source", payload.Source(),
+				"caller", payload.Caller)
+			metrics.payloads.Inc("ignored")
 			w.WriteHeader(http.StatusOK)
 			return
 		}
 
-		if !queue.Enqueue(&payload) {
-			slog.Warn("failed to enqueue alert, queue full")
+		if !callerMayRoute(queue, cfg.tokens, payload) {
+			slog.Warn("caller not allowed to reach any matching route", "caller", payload.Caller,
+				"alertname", payload.CommonLabels["alertname"])
+			metrics.payloads.Inc("forbidden")
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		if !queue.Enqueue(payload) {
+			slog.Warn("failed to enqueue alert", "caller", payload.Caller)
+			metrics.payloads.Inc("dropped")
 			http.Error(w, "Service Unavailable", http.StatusServiceUnavailable)
 			return
 		}
+		metrics.payloads.Inc("enqueued")
 
 		w.WriteHeader(http.StatusOK)
 	}
 }
 
-// checkAuth validates the bearer token if webhook authentication is configured.
-func checkAuth(w http.ResponseWriter, r *http.Request, webhookToken string) bool {
-	if webhookToken == "" {
+// rejectedPayload reports whether a decode error describes a problem the sender can
+// fix, in which case its message is returned in the response.
+func rejectedPayload(err error) bool {
+	return errors.Is(err, errUnsupportedPayloadVersion) || errors.Is(err, errMissingField) ||
+		errors.Is(err, errUnmappedStatus)
+}
+
+// checkAuth validates the bearer token if one is configured.
+// The comparison takes constant time so that the token cannot be guessed by timing.
+func checkAuth(w http.ResponseWriter, r *http.Request, token string) bool {
+	if token == "" {
 		return true
 	}
 	auth := r.Header.Get("Authorization")
-	if auth != "Bearer "+webhookToken {
+	if subtle.ConstantTimeCompare([]byte(auth), []byte("Bearer "+token)) != 1 {
 		//nolint:gosec // G706: structured slog key-value, not string interpolation.
-		slog.Warn("unauthorized webhook request", "remote_addr", r.RemoteAddr)
+		slog.Warn("unauthorized request", "path", r.URL.Path, "remote_addr", r.RemoteAddr)
 		http.Error(w, "Unauthorized", http.StatusUnauthorized)
 		return false
 	}
@@ -83,9 +238,56 @@ func checkContentType(w http.ResponseWriter, r *http.Request) bool {
 	return true
 }
 
-// healthzHandler responds with a JSON health check status.
-func healthzHandler(w http.ResponseWriter, _ *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	_, _ = w.Write([]byte(`{"status":"ok"}`))
+// healthResponse is the body of /healthz. The status is "degraded" while the circuit of
+// any OpenClaw host is not closed.
+type healthResponse struct {
+	Status   string            `json:"status"`
+	Queue    queueHealth       `json:"queue"`
+	OpenClaw map[string]string `json:"openclaw,omitempty"`
+}
+
+// queueHealth reports the queue depth in total and per priority class, the number of
+// payloads the workers are processing, and the number of dead letters.
+type queueHealth struct {
+	Depth       int            `json:"depth"`
+	Capacity    int            `json:"capacity"`
+	InFlight    int            `json:"in_flight"`
+	Workers     int            `json:"workers"`
+	Classes     map[string]int `json:"classes"`
+	DeadLetters int            `json:"dead_letters"`
+}
+
+// healthzHandler responds with a JSON health check status, the queue depth and the
+// circuit state of each OpenClaw host.
+func healthzHandler(queue *AlertQueue, breakers *CircuitBreakers) http.HandlerFunc {
+	return func(w http.ResponseWriter, _ *http.Request) {
+		stats := queue.Stats()
+		classes := make(map[string]int, len(stats.Classes))
+		for _, c := range stats.Classes {
+			classes[c.Class] = c.Depth
+		}
+		status := "ok"
+		var circuits map[string]string
+		for _, c := range breakers.States() {
+			if circuits == nil {
+				circuits = make(map[string]string)
+			}
+			circuits[c.Host] = c.State.String()
+			if c.State != circuitClosed {
+				status = "degraded"
+			}
+		}
+		writeJSON(w, http.StatusOK, healthResponse{
+			Status:   status,
+			OpenClaw: circuits,
+			Queue: queueHealth{
+				Depth:       stats.Depth,
+				Capacity:    stats.Capacity,
+				InFlight:    stats.InFlight,
+				Workers:     stats.Workers,
+				Classes:     classes,
+				DeadLetters: stats.DeadLetters,
+			},
+		})
+	}
 }
@@ -1,10 +1,11 @@
 package main
 
 import (
-	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"net/http/httptest"
+	"reflect"
 	"strings"
 	"testing"
 	"time"
@@ -81,6 +82,18 @@ func TestWebhookHandler_validation(t *testing.T) { //nolint:gocognit // table-dr
 			body:        `{"status":"firing","alerts":[` + strings.Repeat(`{"status":"firing","labels":{"x":"`+strings.Repeat("A", 1000)+`"}},`, 1100) + `]}`, //nolint:lll
 			wantCode:    http.StatusBadRequest,
 		},
+		{
+			name:        "unsupported payload version returns 400",
+			contentType: "application/json",
+			body:        `{"version":"5","status":"firing","alerts":[]}`,
+			wantCode:    http.StatusBadRequest,
+		},
+		{
+			name:        "minor payload version is accepted",
+			contentType: "application/json",
+			body:        `{"version":"4.1","status":"firing","alerts":[]}`,
+			wantCode:    http.StatusOK,
+		},
 	}
 
 	for _, tt := range tests {
@@ -181,16 +194,12 @@ func TestQueueFull(t *testing.T) {
 
 	client := NewOpenClawClient("http://localhost", "token", "model")
 	// Create a queue with capacity 1 and don't start the consumer so it stays full.
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel()
-	queue := &AlertQueue{
-		ch:     make(chan *AlertmanagerPayload, 1),
-		client: client,
-		ctx:    ctx,
-		cancel: cancel,
+	queue := NewAlertQueue(client, WithCapacity(1))
+	defer queue.Stop()
+	// Fill the queue with a different group so the request cannot be merged into it.
+	if !queue.Enqueue(&AlertmanagerPayload{GroupKey: "other"}) {
+		t.Fatal("expected first enqueue to succeed")
 	}
-	// Fill the queue.
-	queue.ch <- &AlertmanagerPayload{}
 
 	mux := NewMux(queue, "")
 	req := httptest.NewRequest(http.MethodPost, "/webhook", strings.NewReader(testPayload(t, "firing")))
@@ -207,9 +216,10 @@ func TestHealthz(t *testing.T) {
 	t.Parallel()
 
 	client := NewOpenClawClient("http://localhost", "token", "model")
-	queue := NewAlertQueue(client)
-	queue.Start()
+	priority := NewPriorityClasses("severity", defaultPriorityClasses, 0)
+	queue := NewAlertQueue(client, WithPriorityClasses(priority))
 	defer queue.Stop()
+	queue.Enqueue(&AlertmanagerPayload{GroupKey: "a", CommonLabels: map[string]string{"severity": "critical"}})
 
 	mux := NewMux(queue, "")
 	req := httptest.NewRequest(http.MethodGet, "/healthz", nil)
@@ -220,11 +230,76 @@ func TestHealthz(t *testing.T) {
 		t.Fatalf("expected 200, got %d", w.Code)
 	}
 
-	var resp map[string]string
+	var resp healthResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if resp.Status != "ok" {
+		t.Fatalf("expected status ok, got %q", resp.Status)
+	}
+	want := map[string]int{"critical": 1, "warning": 0, "info": 0, otherPriorityClass: 0}
+	if resp.Queue.Depth != 1 || !reflect.DeepEqual(resp.Queue.Classes, want) {
+		t.Fatalf("expected one critical payload queued, got %+v", resp.Queue)
+	}
+}
+
+func TestHealthz_CircuitOpen(t *testing.T) {
+	t.Parallel()
+
+	breakers := NewCircuitBreakers(1, time.Hour)
+	breakers.For("http://openclaw:18789").record(false, errors.New("connection refused"))
+	queue := NewAlertQueue(NewOpenClawClient("http://localhost", "token", "model"))
+	defer queue.Stop()
+
+	mux := NewMux(queue, "", WithCircuitStatus(breakers))
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+
+	var resp healthResponse
 	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
 		t.Fatalf("failed to decode response: %v", err)
 	}
-	if resp["status"] != "ok" {
-		t.Fatalf("expected status ok, got %q", resp["status"])
+	if resp.Status != "degraded" || resp.OpenClaw["openclaw:18789"] != "open" {
+		t.Fatalf("expected degraded status with an open circuit, got %+v", resp)
+	}
+}
+
+func TestResolvedAlert_ForwardResolved(t *testing.T) {
+	t.Parallel()
+
+	received := make(chan chatRequest, 1)
+	ocServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req chatRequest
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		received <- req
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer ocServer.Close()
+
+	client := NewOpenClawClient(ocServer.URL, "test-token", "test-model")
+	queue := NewAlertQueue(client)
+	queue.Start()
+	defer queue.Stop()
+
+	mux := NewMux(queue, "", WithForwardResolved())
+	req := httptest.NewRequest(http.MethodPost, "/webhook", strings.NewReader(testPayload(t, "resolved")))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", w.Code)
+	}
+
+	select {
+	case got := <-received:
+		if !strings.Contains(got.Messages[0].Content, "has resolved") {
+			t.Fatalf("expected resolved prompt, got %q", got.Messages[0].Content)
+		}
+		if got.User == "" {
+			t.Fatal("expected user field to reference the alert group")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for OpenClaw server to be called")
 	}
 }
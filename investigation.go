@@ -0,0 +1,317 @@
+package main
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// defaultInvestigationRetention is the number of investigations kept by default.
+const defaultInvestigationRetention = 1000
+
+// Investigation status values. In async mode an investigation is pending from its
+// submission until OpenClaw reports completion, or abandoned if it never does. A streamed
+// answer is recorded as running while it arrives.
+const (
+	investigationSucceeded = "succeeded"
+	investigationFailed    = "failed"
+	investigationPending   = "pending"
+	investigationAbandoned = "abandoned"
+	investigationRunning   = "running"
+)
+
+// Investigation store errors.
+var (
+	// errInvestigationNotFound is returned by Update for an unknown investigation ID.
+	errInvestigationNotFound = errors.New("investigation not found")
+	// errInvestigationsClosed is returned when saving to a file-backed store after Close.
+	errInvestigationsClosed = errors.New("investigations file is closed")
+)
+
+// Investigation records one payload forwarded to one route and what OpenClaw answered.
+type Investigation struct {
+	ID          string               `json:"id"`
+	Route       string               `json:"route"`
+	Status      string               `json:"status"`
+	EnqueuedAt  time.Time            `json:"enqueued_at,omitzero"`
+	StartedAt   time.Time            `json:"started_at"`
+	SubmittedAt time.Time            `json:"submitted_at,omitzero"`
+	CompletedAt time.Time            `json:"completed_at,omitzero"`
+	Backend     string               `json:"backend,omitempty"`
+	Model       string               `json:"model,omitempty"`
+	Attempts    int                  `json:"attempts"`
+	Prompt      string               `json:"prompt,omitempty"`
+	Payload     *AlertmanagerPayload `json:"payload"`
+	Response    *chatResponse        `json:"response,omitempty"`
+	Error       string               `json:"error,omitempty"`
+}
+
+// InvestigationStore keeps the most recent investigations in memory and, if a path is
+// configured, appends every saved investigation to a JSON-lines file that is reloaded on start.
+type InvestigationStore struct {
+	mu        sync.RWMutex
+	path      string
+	retention int
+	f         *os.File
+	lines     int
+	byID      map[string]*Investigation
+	order     []string
+}
+
+// NewInvestigationStore creates a store keeping up to retention investigations. If path
+// is non-empty, previously saved investigations are loaded from it.
+func NewInvestigationStore(path string, retention int) (*InvestigationStore, error) {
+	if retention <= 0 {
+		retention = defaultInvestigationRetention
+	}
+	s := &InvestigationStore{
+		path:      path,
+		retention: retention,
+		byID:      make(map[string]*Investigation),
+	}
+	if path == "" {
+		return s, nil
+	}
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+	if err := s.rewrite(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// load reads the investigations file; later records for the same ID replace earlier ones.
+// Investigations still running or being submitted when the service stopped are recorded
+// as failed; their payloads are forwarded again from the journal.
+func (s *InvestigationStore) load() error {
+	f, err := os.Open(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("open investigations: %w", err)
+	}
+	defer func() { _ = f.Close() }()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxResponseSize+journalMaxLine)
+	line := 0
+	for scanner.Scan() {
+		line++
+		var inv Investigation
+		if err := json.Unmarshal(scanner.Bytes(), &inv); err != nil || inv.ID == "" {
+			slog.Warn("skipping unreadable investigation record", "path", s.path, "line", line, "error", err)
+			continue
+		}
+		switch {
+		case inv.Status == investigationRunning:
+			inv.Status = investigationFailed
+			inv.Error = "interrupted by a restart while the answer was streamed"
+		case inv.Status == investigationPending && inv.SubmittedAt.IsZero():
+			inv.Status = investigationFailed
+			inv.Error = "interrupted by a restart while the investigation was submitted"
+		}
+		s.put(&inv)
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("read investigations: %w", err)
+	}
+	return nil
+}
+
+// Save adds or replaces an investigation and persists it if the store has a file.
+func (s *InvestigationStore) Save(inv *Investigation) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.save(inv)
+}
+
+// Update applies update to a copy of the investigation with the given ID and saves the
+// copy, so that records already handed out never change. Nothing is saved if update
+// returns an error, which Update returns.
+func (s *InvestigationStore) Update(id string, update func(inv *Investigation) error) (*Investigation, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	current, ok := s.byID[id]
+	if !ok {
+		return nil, errInvestigationNotFound
+	}
+	next := *current
+	if err := update(&next); err != nil {
+		return nil, err
+	}
+	return &next, s.save(&next)
+}
+
+// save stores an investigation and appends it to the file, if any. The caller must hold s.mu.
+func (s *InvestigationStore) save(inv *Investigation) error {
+	s.put(inv)
+	if s.path == "" {
+		return nil
+	}
+	if s.f == nil {
+		return errInvestigationsClosed
+	}
+	line, err := json.Marshal(inv)
+	if err != nil {
+		return fmt.Errorf("marshal investigation: %w", err)
+	}
+	if _, err := s.f.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("write investigation: %w", err)
+	}
+	s.lines++
+	if s.lines > 2*s.retention {
+		// The record is already on disk; if compaction fails, the old file stays in use.
+		if err := s.rewrite(); err != nil {
+			slog.Warn("failed to compact investigations file", "path", s.path, "error", err)
+		}
+	}
+	return nil
+}
+
+// put stores an investigation in memory, evicting the oldest beyond the retention limit.
+// The caller must hold s.mu or have exclusive access.
+func (s *InvestigationStore) put(inv *Investigation) {
+	if _, ok := s.byID[inv.ID]; !ok {
+		s.order = append(s.order, inv.ID)
+	}
+	s.byID[inv.ID] = inv
+	for len(s.order) > s.retention {
+		delete(s.byID, s.order[0])
+		s.order = s.order[1:]
+	}
+}
+
+// rewrite replaces the file with the retained investigations and reopens it for appending.
+// The new file is synced before it replaces the old one, and the old one stays open for
+// appending until then, so a failed rewrite loses no records.
+// The caller must hold s.mu or have exclusive access.
+func (s *InvestigationStore) rewrite() error {
+	tmpPath := s.path + ".tmp"
+	f, err := os.OpenFile(tmpPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC|os.O_APPEND, 0o600)
+	if err != nil {
+		return fmt.Errorf("create investigations: %w", err)
+	}
+	if err := s.writeRetained(f); err != nil {
+		_ = f.Close()
+		_ = os.Remove(tmpPath)
+		return err
+	}
+	if err := os.Rename(tmpPath, s.path); err != nil {
+		_ = f.Close()
+		_ = os.Remove(tmpPath)
+		return fmt.Errorf("replace investigations: %w", err)
+	}
+
+	if s.f != nil {
+		_ = s.f.Close()
+	}
+	s.f = f
+	s.lines = len(s.order)
+	return nil
+}
+
+// writeRetained writes the retained investigations to f and syncs it.
+func (s *InvestigationStore) writeRetained(f *os.File) error {
+	w := bufio.NewWriter(f)
+	enc := json.NewEncoder(w)
+	for _, id := range s.order {
+		if err := enc.Encode(s.byID[id]); err != nil {
+			return fmt.Errorf("write investigations: %w", err)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return fmt.Errorf("write investigations: %w", err)
+	}
+	if err := f.Sync(); err != nil {
+		return fmt.Errorf("sync investigations: %w", err)
+	}
+	return nil
+}
+
+// Get returns the investigation with the given ID.
+func (s *InvestigationStore) Get(id string) (*Investigation, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	inv, ok := s.byID[id]
+	return inv, ok
+}
+
+// List returns the stored investigations, most recently started first.
+func (s *InvestigationStore) List() []*Investigation {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	list := make([]*Investigation, 0, len(s.order))
+	for _, id := range s.order {
+		list = append(list, s.byID[id])
+	}
+	sort.SliceStable(list, func(a, b int) bool { return list[a].StartedAt.After(list[b].StartedAt) })
+	return list
+}
+
+// Close closes the investigations file.
+func (s *InvestigationStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.f == nil {
+		return nil
+	}
+	err := s.f.Close()
+	s.f = nil
+	if err != nil {
+		return fmt.Errorf("close investigations: %w", err)
+	}
+	return nil
+}
+
+// newInvestigation builds the record with the given ID of forwarding a payload to a
+// route. A payload submitted in async mode stays pending until the callback arrives.
+func newInvestigation(id, route string, item *queueItem, result *ForwardResult, err error) *Investigation {
+	inv := &Investigation{
+		ID:         id,
+		Route:      route,
+		Status:     investigationSucceeded,
+		EnqueuedAt: item.enqueuedAt,
+		StartedAt:  time.Now().UTC(),
+		Payload:    item.payload,
+	}
+	if result != nil {
+		inv.StartedAt = result.StartedAt
+		inv.CompletedAt = result.FinishedAt
+		inv.Backend = result.Backend
+		inv.Model = result.Model
+		inv.Attempts = result.Attempts
+		inv.Prompt = result.Prompt
+		inv.Response = result.Response
+	}
+	switch {
+	case err != nil:
+		inv.Status = investigationFailed
+		inv.Error = err.Error()
+	case result != nil && result.InvestigationID != "":
+		inv.Status = investigationPending
+		inv.SubmittedAt, inv.CompletedAt = inv.CompletedAt, time.Time{}
+	}
+	return inv
+}
+
+// newID returns a random 128-bit identifier in hex.
+func newID() string {
+	var b [16]byte
+	_, _ = rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestInvestigationStore_PersistsAcrossRestarts(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "investigations.jsonl")
+	store, err := NewInvestigationStore(path, 10)
+	if err != nil {
+		t.Fatalf("open store: %v", err)
+	}
+
+	inv := &Investigation{
+		ID:        "abc",
+		Route:     "root",
+		Status:    investigationSucceeded,
+		StartedAt: time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC),
+		Payload:   &AlertmanagerPayload{GroupKey: "g"},
+		Response: &chatResponse{
+			Choices: []chatChoice{{Message: chatMessage{Role: "assistant", Content: "disk full"}, FinishReason: "stop"}},
+			Usage:   &chatUsage{TotalTokens: 42},
+		},
+	}
+	if err := store.Save(inv); err != nil {
+		t.Fatalf("save: %v", err)
+	}
+	// A later save of the same ID replaces the record.
+	updated := *inv
+	updated.Attempts = 2
+	if err := store.Save(&updated); err != nil {
+		t.Fatalf("save: %v", err)
+	}
+	if err := store.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+
+	store, err = NewInvestigationStore(path, 10)
+	if err != nil {
+		t.Fatalf("reopen store: %v", err)
+	}
+	defer func() { _ = store.Close() }()
+
+	got, ok := store.Get("abc")
+	if !ok {
+		t.Fatal("expected investigation to be reloaded")
+	}
+	if got.Attempts != 2 || got.Response.Choices[0].Message.Content != "disk full" {
+		t.Fatalf("unexpected reloaded investigation: %+v", got)
+	}
+	if got.Response.Usage.TotalTokens != 42 {
+		t.Fatalf("expected usage to be reloaded, got %+v", got.Response.Usage)
+	}
+	if n := len(store.List()); n != 1 {
+		t.Fatalf("expected 1 investigation, got %d", n)
+	}
+}
+
+func TestInvestigationStore_Retention(t *testing.T) {
+	t.Parallel()
+
+	store, err := NewInvestigationStore("", 3)
+	if err != nil {
+		t.Fatalf("open store: %v", err)
+	}
+
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := range 5 {
+		inv := &Investigation{ID: fmt.Sprint(i), StartedAt: start.Add(time.Duration(i) * time.Minute)}
+		if err := store.Save(inv); err != nil {
+			t.Fatalf("save: %v", err)
+		}
+	}
+
+	list := store.List()
+	if len(list) != 3 {
+		t.Fatalf("expected 3 retained investigations, got %d", len(list))
+	}
+	if list[0].ID != "4" || list[2].ID != "2" {
+		t.Fatalf("expected newest first, got %s..%s", list[0].ID, list[2].ID)
+	}
+	if _, ok := store.Get("0"); ok {
+		t.Fatal("expected oldest investigation to be evicted")
+	}
+}
+
+func TestInvestigationStore_FailedCompactionKeepsPersisting(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "investigations.jsonl")
+	store, err := NewInvestigationStore(path, 2)
+	if err != nil {
+		t.Fatalf("open store: %v", err)
+	}
+	// A directory in the way of the temporary file makes every compaction fail.
+	if err := os.Mkdir(path+".tmp", 0o700); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	for i := range 6 {
+		if err := store.Save(&Investigation{ID: fmt.Sprint(i), StartedAt: time.Now()}); err != nil {
+			t.Fatalf("save %d: %v", i, err)
+		}
+	}
+	if err := store.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+	if err := store.Save(&Investigation{ID: "late"}); !errors.Is(err, errInvestigationsClosed) {
+		t.Fatalf("expected a save after close to fail, got %v", err)
+	}
+	if err := os.Remove(path + ".tmp"); err != nil {
+		t.Fatalf("remove: %v", err)
+	}
+
+	store, err = NewInvestigationStore(path, 2)
+	if err != nil {
+		t.Fatalf("reopen store: %v", err)
+	}
+	defer func() { _ = store.Close() }()
+	if _, ok := store.Get("5"); !ok {
+		t.Fatal("expected the last investigation saved while compaction failed to be persisted")
+	}
+}
+
+func TestInvestigationStore_RunningInterruptedByRestart(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "investigations.jsonl")
+	store, err := NewInvestigationStore(path, 10)
+	if err != nil {
+		t.Fatalf("open store: %v", err)
+	}
+	now := time.Now().UTC()
+	for _, inv := range []*Investigation{
+		{ID: "abc", Status: investigationRunning},
+		{ID: "submitting", Status: investigationPending},
+		{ID: "submitted", Status: investigationPending, SubmittedAt: now},
+	} {
+		if err := store.Save(inv); err != nil {
+			t.Fatalf("save: %v", err)
+		}
+	}
+	_ = store.Close()
+
+	store, err = NewInvestigationStore(path, 10)
+	if err != nil {
+		t.Fatalf("reopen store: %v", err)
+	}
+	defer func() { _ = store.Close() }()
+
+	if got, _ := store.Get("abc"); got.Status != investigationFailed || got.Error == "" {
+		t.Fatalf("expected running investigation to be reloaded as failed, got %+v", got)
+	}
+	if got, _ := store.Get("submitting"); got.Status != investigationFailed || got.Error == "" {
+		t.Fatalf("expected investigation interrupted while submitted to be reloaded as failed, got %+v", got)
+	}
+	if got, _ := store.Get("submitted"); got.Status != investigationPending {
+		t.Fatalf("expected submitted investigation to stay pending, got %+v", got)
+	}
+}
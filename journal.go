@@ -0,0 +1,257 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// journalCompactThreshold is the minimum number of records in the journal file
+// before compaction is considered.
+const journalCompactThreshold = 1000
+
+// journalMaxLine is the largest journal record accepted on replay (payloads are capped at 1 MB).
+const journalMaxLine = 4 << 20
+
+// journalRecord is a single line in the journal file.
+type journalRecord struct {
+	Op      string               `json:"op"`
+	ID      uint64               `json:"id"`
+	Time    time.Time            `json:"time,omitzero"`
+	Payload *AlertmanagerPayload `json:"payload,omitempty"`
+	Routes  []string             `json:"routes,omitempty"`
+}
+
+// journalEntry is a payload that was appended to the journal but not yet acknowledged.
+// Routes limits a replayed dead letter to the routes it failed on.
+type journalEntry struct {
+	ID         uint64
+	EnqueuedAt time.Time
+	Payload    *AlertmanagerPayload
+	Routes     []string
+}
+
+// Journal is an append-only write-ahead log that persists queued payloads across restarts.
+// Payloads are appended on enqueue and acknowledged once forwarded; acknowledged records
+// are dropped when the file is compacted.
+type Journal struct {
+	mu      sync.Mutex
+	path    string
+	f       *os.File
+	nextID  uint64
+	pending map[uint64]journalEntry
+	records int
+}
+
+// OpenJournal opens or creates the journal at path, loads unacknowledged entries
+// and compacts the file.
+func OpenJournal(path string) (*Journal, error) {
+	j := &Journal{
+		path:    path,
+		nextID:  1,
+		pending: make(map[uint64]journalEntry),
+	}
+	if err := j.load(); err != nil {
+		return nil, err
+	}
+	if err := j.compact(); err != nil {
+		return nil, err
+	}
+	return j, nil
+}
+
+// load replays the journal file into the pending set. Unreadable lines, such as a
+// record truncated by a crash, are skipped with a warning.
+func (j *Journal) load() error {
+	f, err := os.Open(j.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("open journal: %w", err)
+	}
+	defer func() { _ = f.Close() }()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), journalMaxLine)
+	line := 0
+	for scanner.Scan() {
+		line++
+		var rec journalRecord
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			slog.Warn("skipping unreadable journal record", "path", j.path, "line", line, "error", err)
+			continue
+		}
+		j.apply(rec)
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("read journal: %w", err)
+	}
+	return nil
+}
+
+// apply updates the in-memory state with a single record.
+func (j *Journal) apply(rec journalRecord) {
+	switch rec.Op {
+	case "enqueue":
+		if rec.Payload != nil {
+			j.pending[rec.ID] = journalEntry{ID: rec.ID, EnqueuedAt: rec.Time, Payload: rec.Payload, Routes: rec.Routes}
+		}
+	case "ack":
+		delete(j.pending, rec.ID)
+	}
+	if rec.ID >= j.nextID {
+		j.nextID = rec.ID + 1
+	}
+}
+
+// Pending returns the unacknowledged entries in the order they were appended.
+func (j *Journal) Pending() []journalEntry {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	entries := make([]journalEntry, 0, len(j.pending))
+	for _, e := range j.pending {
+		entries = append(entries, e)
+	}
+	sort.Slice(entries, func(a, b int) bool { return entries[a].ID < entries[b].ID })
+	return entries
+}
+
+// Append durably records a payload, limited to routes if any are given, and returns its
+// journal ID.
+func (j *Journal) Append(payload *AlertmanagerPayload, routes ...string) (uint64, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	id := j.nextID
+	rec := journalRecord{Op: "enqueue", ID: id, Time: time.Now().UTC(), Payload: payload, Routes: routes}
+	if err := j.write(rec, true); err != nil {
+		return 0, err
+	}
+	j.nextID++
+	j.pending[id] = journalEntry{ID: id, EnqueuedAt: rec.Time, Payload: payload, Routes: routes}
+	return id, nil
+}
+
+// Ack marks a payload as delivered and compacts the journal when most records are stale.
+func (j *Journal) Ack(id uint64) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if _, ok := j.pending[id]; !ok {
+		return nil
+	}
+	// Acks are not synced: losing one only causes a duplicate delivery after a crash.
+	if err := j.write(journalRecord{Op: "ack", ID: id}, false); err != nil {
+		return err
+	}
+	delete(j.pending, id)
+
+	if j.records >= journalCompactThreshold && j.records > 2*len(j.pending) {
+		return j.compact()
+	}
+	return nil
+}
+
+// write appends a record to the journal file, optionally syncing it to disk.
+func (j *Journal) write(rec journalRecord, durable bool) error {
+	if j.f == nil {
+		return errors.New("journal closed")
+	}
+	line, err := json.Marshal(rec)
+	if err != nil {
+		return fmt.Errorf("marshal journal record: %w", err)
+	}
+	if _, err := j.f.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("write journal: %w", err)
+	}
+	j.records++
+	if durable {
+		if err := j.f.Sync(); err != nil {
+			return fmt.Errorf("sync journal: %w", err)
+		}
+	}
+	return nil
+}
+
+// compact rewrites the journal with only the pending entries and reopens it for appending.
+// The caller must hold j.mu or have exclusive access.
+func (j *Journal) compact() error {
+	entries := make([]journalEntry, 0, len(j.pending))
+	for _, e := range j.pending {
+		entries = append(entries, e)
+	}
+	sort.Slice(entries, func(a, b int) bool { return entries[a].ID < entries[b].ID })
+
+	tmpPath := j.path + ".tmp"
+	if err := writeJournalFile(tmpPath, entries); err != nil {
+		return err
+	}
+	if j.f != nil {
+		_ = j.f.Close()
+		j.f = nil
+	}
+	if err := os.Rename(tmpPath, j.path); err != nil {
+		return fmt.Errorf("replace journal: %w", err)
+	}
+
+	f, err := os.OpenFile(j.path, os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return fmt.Errorf("reopen journal: %w", err)
+	}
+	j.f = f
+	j.records = len(entries)
+	return nil
+}
+
+// writeJournalFile writes enqueue records for entries to path and syncs the file.
+func writeJournalFile(path string, entries []journalEntry) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+	if err != nil {
+		return fmt.Errorf("create journal: %w", err)
+	}
+	w := bufio.NewWriter(f)
+	enc := json.NewEncoder(w)
+	for _, e := range entries {
+		rec := journalRecord{Op: "enqueue", ID: e.ID, Time: e.EnqueuedAt, Payload: e.Payload, Routes: e.Routes}
+		if err := enc.Encode(rec); err != nil {
+			_ = f.Close()
+			return fmt.Errorf("write journal: %w", err)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		_ = f.Close()
+		return fmt.Errorf("write journal: %w", err)
+	}
+	if err := f.Sync(); err != nil {
+		_ = f.Close()
+		return fmt.Errorf("sync journal: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("close journal: %w", err)
+	}
+	return nil
+}
+
+// Close closes the journal file. Pending entries remain on disk for the next start.
+func (j *Journal) Close() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if j.f == nil {
+		return nil
+	}
+	err := j.f.Close()
+	j.f = nil
+	if err != nil {
+		return fmt.Errorf("close journal: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestJournal_ReplayPending(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "queue.journal")
+	j, err := OpenJournal(path)
+	if err != nil {
+		t.Fatalf("open journal: %v", err)
+	}
+
+	first, err := j.Append(&AlertmanagerPayload{GroupKey: "first"})
+	if err != nil {
+		t.Fatalf("append: %v", err)
+	}
+	if _, err := j.Append(&AlertmanagerPayload{GroupKey: "second"}); err != nil {
+		t.Fatalf("append: %v", err)
+	}
+	if err := j.Ack(first); err != nil {
+		t.Fatalf("ack: %v", err)
+	}
+	if err := j.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+
+	j, err = OpenJournal(path)
+	if err != nil {
+		t.Fatalf("reopen journal: %v", err)
+	}
+	defer func() { _ = j.Close() }()
+
+	pending := j.Pending()
+	if len(pending) != 1 {
+		t.Fatalf("expected 1 pending entry, got %d", len(pending))
+	}
+	if pending[0].Payload.GroupKey != "second" {
+		t.Fatalf("expected pending entry %q, got %q", "second", pending[0].Payload.GroupKey)
+	}
+
+	// New IDs must not collide with replayed ones.
+	id, err := j.Append(&AlertmanagerPayload{GroupKey: "third"})
+	if err != nil {
+		t.Fatalf("append: %v", err)
+	}
+	if id <= pending[0].ID {
+		t.Fatalf("expected new id greater than %d, got %d", pending[0].ID, id)
+	}
+}
+
+func TestJournal_SkipsTruncatedRecord(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "queue.journal")
+	content := `{"op":"enqueue","id":1,"payload":{"groupKey":"ok"}}` + "\n" + `{"op":"enqueue","id":2,"payl`
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("write journal: %v", err)
+	}
+
+	j, err := OpenJournal(path)
+	if err != nil {
+		t.Fatalf("open journal: %v", err)
+	}
+	defer func() { _ = j.Close() }()
+
+	pending := j.Pending()
+	if len(pending) != 1 || pending[0].Payload.GroupKey != "ok" {
+		t.Fatalf("expected only the intact entry, got %+v", pending)
+	}
+}
+
+func TestJournal_Compaction(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "queue.journal")
+	j, err := OpenJournal(path)
+	if err != nil {
+		t.Fatalf("open journal: %v", err)
+	}
+	defer func() { _ = j.Close() }()
+
+	for range journalCompactThreshold {
+		id, err := j.Append(&AlertmanagerPayload{GroupKey: "g"})
+		if err != nil {
+			t.Fatalf("append: %v", err)
+		}
+		if err := j.Ack(id); err != nil {
+			t.Fatalf("ack: %v", err)
+		}
+	}
+	if _, err := j.Append(&AlertmanagerPayload{GroupKey: "kept"}); err != nil {
+		t.Fatalf("append: %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read journal: %v", err)
+	}
+	if lines := strings.Count(string(data), "\n"); lines >= journalCompactThreshold {
+		t.Fatalf("expected journal to be compacted, got %d lines", lines)
+	}
+	if !strings.Contains(string(data), `"kept"`) {
+		t.Fatal("expected pending entry to survive compaction")
+	}
+}
@@ -3,10 +3,14 @@ package main
 import (
 	"context"
 	"errors"
+	"flag"
+	"fmt"
 	"log/slog"
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
+	"strings"
 	"syscall"
 	"time"
 )
@@ -16,55 +20,51 @@ func main() {
 	// Structured JSON logging.
 	slog.SetDefault(slog.New(slog.NewJSONHandler(os.Stdout, nil)))
 
-	// Load configuration from environment variables.
-	listenAddr := envOr("LISTEN_ADDR", ":8080")
-	openclawURL := os.Getenv("OPENCLAW_URL")
-	openclawToken := os.Getenv("OPENCLAW_TOKEN")
-	openclawModel := envOr("OPENCLAW_MODEL", "openclaw:main")
-	webhookToken := os.Getenv("WEBHOOK_TOKEN")
+	configPath := parseFlags()
 
-	if openclawURL == "" {
-		slog.Error("OPENCLAW_URL is required")
+	// Load configuration from environment variables and the configuration file.
+	cfg, err := loadConfig(configPath)
+	if err != nil {
+		slog.Error("invalid configuration", "error", err)
 		os.Exit(1)
 	}
-	if openclawToken == "" {
-		slog.Error("OPENCLAW_TOKEN is required")
-		os.Exit(1)
-	}
-
-	slog.Info("starting alertstoopenclaw", //nolint:gosec // G706: structured slog, not string interpolation.
-		"listen_addr", listenAddr,
-		"openclaw_url", openclawURL,
-		"openclaw_model", openclawModel,
-		"webhook_auth", webhookToken != "",
-	)
+	logConfig(cfg)
 
 	// Create components.
-	client := NewOpenClawClient(openclawURL, openclawToken, openclawModel)
-	queue := NewAlertQueue(client)
-	queue.Start()
-
-	mux := NewMux(queue, webhookToken)
-	server := &http.Server{
-		Addr:         listenAddr,
-		Handler:      mux,
-		ReadTimeout:  10 * time.Second,
-		WriteTimeout: 10 * time.Second,
-		IdleTimeout:  120 * time.Second,
+	svc, err := newService(cfg)
+	if err != nil {
+		slog.Error("failed to start", "error", err)
+		os.Exit(1)
 	}
+	svc.queue.Start()
+
+	server := newServer(cfg.ListenAddr, svc)
 
 	// Graceful shutdown on SIGINT/SIGTERM.
 	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
 	defer stop()
 
+	// Reload certificates on SIGHUP or when the files change.
+	if svc.tls != nil {
+		go svc.tls.Run(ctx, cfg.WatchInterval)
+	}
 	go func() {
-		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		if err := listen(server); err != nil && !errors.Is(err, http.ErrServerClosed) {
 			slog.Error("server error", "error", err)
 			stop()
 		}
 	}()
 
-	slog.Info("server started", "addr", listenAddr)
+	slog.Info("server started", "addr", cfg.ListenAddr, "tls", svc.tls != nil)
+
+	// Reload routes and templates on SIGHUP or when the configuration files change.
+	go newConfigReloader(cfg, svc.queue, svc.breakers, svc.backends).Run(ctx, cfg.WatchInterval)
+
+	// Check the health of the OpenClaw backends.
+	go svc.backends.Run(ctx, cfg.OpenClawHealthInterval)
+
+	// Abandon asynchronous investigations whose callback never arrives.
+	go watchPending(ctx, svc.store, cfg.OpenClawAsyncTimeout)
 
 	<-ctx.Done()
 	slog.Info("shutting down")
@@ -75,11 +75,207 @@ func main() {
 	_ = server.Shutdown(shutdownCtx)
 
 	// Drain the alert queue.
-	queue.Stop()
+	svc.Close()
 
 	slog.Info("shutdown complete")
 }
 
+// newServer creates the HTTP server for the service's handler, with the service's TLS
+// configuration if it has one.
+func newServer(addr string, svc *service) *http.Server {
+	server := &http.Server{
+		Addr:         addr,
+		Handler:      svc.handler,
+		ReadTimeout:  10 * time.Second,
+		WriteTimeout: 10 * time.Second,
+		IdleTimeout:  120 * time.Second,
+	}
+	if svc.tls != nil {
+		server.TLSConfig = svc.tls.ServerConfig()
+	}
+	return server
+}
+
+// listen serves HTTPS if the server has a TLS configuration, and plain HTTP otherwise.
+func listen(server *http.Server) error {
+	if server.TLSConfig != nil {
+		return server.ListenAndServeTLS("", "")
+	}
+	return server.ListenAndServe()
+}
+
+// parseFlags parses the command line and returns the configuration file path. With
+// -check-config it validates the configuration and exits.
+func parseFlags() string {
+	configPath := flag.String("config", os.Getenv("CONFIG_FILE"),
+		"JSON configuration file overriding environment variables")
+	check := flag.Bool("check-config", false,
+		"validate the configuration, prompt templates and routes, then exit")
+	flag.Parse()
+
+	if *check {
+		if err := checkConfig(*configPath); err != nil {
+			fmt.Fprintf(os.Stderr, "invalid configuration: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Println("configuration OK")
+		os.Exit(0)
+	}
+	return *configPath
+}
+
+// logConfig logs the effective settings, without secrets.
+func logConfig(cfg *config) {
+	slog.Info("starting alertstoopenclaw", //nolint:gosec // G706: structured slog, not string interpolation.
+		"config_file", cfg.ConfigFile,
+		"listen_addr", cfg.ListenAddr,
+		"openclaw_url", cfg.OpenClawURL,
+		"openclaw_model", cfg.OpenClawModel,
+		"openclaw_ca_file", cfg.OpenClawCAFile,
+		"openclaw_client_cert", cfg.OpenClawCertFile != "",
+		"openclaw_proxy", cfg.OpenClawProxyURL != "",
+		"openclaw_backends", len(cfg.OpenClawBackends),
+		"openclaw_balance", cfg.OpenClawBalance,
+		"openclaw_retry_attempts", cfg.OpenClawRetryAttempts,
+		"openclaw_retry_base_delay", cfg.OpenClawRetryBaseDelay,
+		"openclaw_retry_max_delay", cfg.OpenClawRetryMaxDelay,
+		"openclaw_circuit_threshold", cfg.OpenClawCircuitThreshold,
+		"openclaw_circuit_cooldown", cfg.OpenClawCircuitCooldown,
+		"openclaw_async", cfg.OpenClawAsync,
+		"openclaw_callback_url", cfg.OpenClawCallbackURL,
+		"openclaw_callback_auth", cfg.OpenClawCallbackToken != "",
+		"openclaw_async_timeout", cfg.OpenClawAsyncTimeout,
+		"openclaw_stream", cfg.OpenClawStream,
+		"openclaw_stream_idle_timeout", cfg.OpenClawStreamIdle,
+		"webhook_auth", cfg.WebhookToken != "",
+		"webhook_tokens", len(cfg.WebhookTokens),
+		"webhook_tokens_file", cfg.WebhookTokensFile,
+		"tls", cfg.TLSCertFile != "",
+		"tls_client_auth", cfg.TLSClientCAFile != "",
+		"webhook_signatures", len(cfg.WebhookHMACSecrets) > 0,
+		"admin_auth", cfg.AdminToken != "",
+		"queue_journal", cfg.JournalPath,
+		"queue_workers", cfg.QueueWorkers,
+		"queue_serialize_label", cfg.QueueSerializeLabel,
+		"dedup_ttl", cfg.DedupTTL,
+		"priority_label", cfg.PriorityLabel,
+		"priority_classes", cfg.PriorityClasses,
+		"forward_resolved", cfg.ForwardResolved,
+		"prompt_template_dir", cfg.TemplateDir,
+		"routes_file", cfg.RoutesFile,
+		"investigations_path", cfg.InvestigationsPath,
+		"dead_letter_path", cfg.DeadLetterPath,
+	)
+	if cfg.AdminToken == "" {
+		slog.Warn("ADMIN_TOKEN not set, investigation and dead-letter APIs are disabled")
+	}
+}
+
+// service holds the long-lived components wired together from the configuration.
+type service struct {
+	queue    *AlertQueue
+	journal  *Journal
+	store    *InvestigationStore
+	dead     *DeadLetterStore
+	breakers *CircuitBreakers
+	backends *Backends
+	handler  http.Handler
+	tls      *listenerTLS
+}
+
+// newService loads the templates and routes and opens the stores the queue and HTTP
+// handlers need. The queue is not started.
+func newService(cfg *config) (*service, error) {
+	templates, err := LoadPromptTemplates(cfg.TemplateDir)
+	if err != nil {
+		return nil, fmt.Errorf("invalid prompt templates: %w", err)
+	}
+	slog.Info("loaded prompt templates", "templates", templates.Names())
+
+	breakers := NewCircuitBreakers(cfg.OpenClawCircuitThreshold, cfg.OpenClawCircuitCooldown)
+	backends := NewBackends(cfg.OpenClawEjectThreshold, cfg.OpenClawEjectDuration, cfg.OpenClawHealthPath)
+	router, err := buildRouter(cfg, templates, breakers, backends, nil)
+	if err != nil {
+		return nil, fmt.Errorf("invalid routes: %w", err)
+	}
+	generic, err := compileGenericSources(cfg.GenericSources)
+	if err != nil {
+		return nil, err
+	}
+	tokens, err := buildTokenSet(cfg, router)
+	if err != nil {
+		return nil, err
+	}
+
+	svc := &service{breakers: breakers, backends: backends}
+	if cfg.TLSCertFile != "" {
+		if svc.tls, err = newListenerTLS(cfg.listenerTLS()); err != nil {
+			return nil, err
+		}
+	}
+	if svc.store, err = NewInvestigationStore(cfg.InvestigationsPath, cfg.InvestigationsRetention); err != nil {
+		return nil, fmt.Errorf("open investigation store: %w", err)
+	}
+	if svc.dead, err = NewDeadLetterStore(cfg.DeadLetterPath, cfg.DeadLetterRetention); err != nil {
+		_ = svc.store.Close()
+		return nil, fmt.Errorf("open dead-letter store: %w", err)
+	}
+
+	queueOpts := []QueueOption{
+		WithRouter(router), WithInvestigationStore(svc.store), WithCallerPolicy(tokens), WithDeadLetters(svc.dead),
+		WithPriorityClasses(NewPriorityClasses(cfg.PriorityLabel, cfg.PriorityClasses, cfg.PriorityAging)),
+		WithWorkers(cfg.QueueWorkers), WithSerializationLabel(cfg.QueueSerializeLabel),
+	}
+	if cfg.JournalPath != "" {
+		if svc.journal, err = OpenJournal(cfg.JournalPath); err != nil {
+			_ = svc.store.Close()
+			_ = svc.dead.Close()
+			return nil, fmt.Errorf("open queue journal: %w", err)
+		}
+		queueOpts = append(queueOpts, WithJournal(svc.journal))
+	}
+	if cfg.DedupTTL > 0 {
+		queueOpts = append(queueOpts, WithDeduplicator(NewDeduplicator(cfg.DedupTTL)))
+	}
+	svc.queue = NewAlertQueue(nil, queueOpts...)
+	backends.Install(router.Pools()...)
+	svc.handler = NewMux(svc.queue, cfg.WebhookToken, svc.muxOptions(cfg, generic, tokens)...)
+	return svc, nil
+}
+
+// muxOptions returns the HTTP handler options for the configuration and the service's stores.
+func (s *service) muxOptions(cfg *config, generic map[string]*genericSource, tokens *TokenSet) []MuxOption {
+	opts := []MuxOption{
+		WithAdminToken(cfg.AdminToken), WithInvestigationAPI(s.store), WithDeadLetterAPI(s.dead),
+		WithGenericSources(generic), WithWebhookTokens(tokens), WithCircuitStatus(s.breakers),
+		WithBackendStatus(s.backends), WithCallbackToken(cfg.OpenClawCallbackToken),
+	}
+	if cfg.ForwardResolved {
+		opts = append(opts, WithForwardResolved())
+	}
+	if len(cfg.WebhookHMACSecrets) > 0 {
+		opts = append(opts, WithSignatureVerifier(NewSignatureVerifier(
+			cfg.SignatureHeader, cfg.TimestampHeader, cfg.MaxSkew, cfg.WebhookHMACSecrets)))
+	}
+	return opts
+}
+
+// Close drains the queue and closes the journal, investigation store and dead-letter store.
+func (s *service) Close() {
+	s.queue.Stop()
+	if s.journal != nil {
+		if err := s.journal.Close(); err != nil {
+			slog.Error("failed to close queue journal", "error", err)
+		}
+	}
+	if err := s.store.Close(); err != nil {
+		slog.Error("failed to close investigation store", "error", err)
+	}
+	if err := s.dead.Close(); err != nil {
+		slog.Error("failed to close dead-letter store", "error", err)
+	}
+}
+
 // envOr returns the value of the environment variable or the fallback if empty.
 func envOr(key, fallback string) string {
 	if v := os.Getenv(key); v != "" {
@@ -87,3 +283,53 @@ func envOr(key, fallback string) string {
 	}
 	return fallback
 }
+
+// envList splits the environment variable on commas, dropping empty entries.
+func envList(key string) []string {
+	var list []string
+	for _, v := range strings.Split(os.Getenv(key), ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			list = append(list, v)
+		}
+	}
+	return list
+}
+
+// envInt parses the environment variable as an integer, returning fallback if empty.
+func envInt(key string, fallback int) (int, error) {
+	v := os.Getenv(key)
+	if v == "" {
+		return fallback, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", key, err)
+	}
+	return n, nil
+}
+
+// envBool parses the environment variable as a boolean, returning fallback if empty.
+func envBool(key string, fallback bool) (bool, error) {
+	v := os.Getenv(key)
+	if v == "" {
+		return fallback, nil
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		return false, fmt.Errorf("%s: %w", key, err)
+	}
+	return b, nil
+}
+
+// envDuration parses the environment variable as a duration, returning fallback if empty.
+func envDuration(key string, fallback time.Duration) (time.Duration, error) {
+	v := os.Getenv(key)
+	if v == "" {
+		return fallback, nil
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", key, err)
+	}
+	return d, nil
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"testing"
+	"time"
 )
 
 func TestEnvOr(t *testing.T) {
@@ -53,3 +54,19 @@ func TestEnvOr(t *testing.T) {
 func strPtr(s string) *string {
 	return &s
 }
+
+func TestEnvDuration(t *testing.T) {
+	// Not parallel: t.Setenv modifies process environment.
+	t.Setenv("TEST_ENVDURATION_SET", "90s")
+	t.Setenv("TEST_ENVDURATION_BAD", "soon")
+
+	if got, err := envDuration("TEST_ENVDURATION_SET", time.Minute); err != nil || got != 90*time.Second {
+		t.Fatalf("envDuration(set) = %v, %v, want 90s", got, err)
+	}
+	if got, err := envDuration("TEST_ENVDURATION_UNSET", time.Minute); err != nil || got != time.Minute {
+		t.Fatalf("envDuration(unset) = %v, %v, want 1m", got, err)
+	}
+	if _, err := envDuration("TEST_ENVDURATION_BAD", time.Minute); err == nil {
+		t.Fatal("expected error for invalid duration")
+	}
+}
@@ -0,0 +1,414 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// metricsContentType is the Prometheus text exposition format served on /metrics.
+const metricsContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// Histogram buckets in seconds. OpenClaw investigations routinely take tens of seconds,
+// and a payload may wait behind several of them in the queue.
+var (
+	openclawLatencyBuckets = []float64{0.1, 0.25, 0.5, 1, 2.5, 5, 10, 20, 30, 60, 120}
+	queueWaitBuckets       = []float64{0.01, 0.1, 1, 5, 15, 30, 60, 300, 900, 3600}
+)
+
+// metrics holds the process-wide metrics exported on /metrics.
+var metrics = newBridgeMetrics()
+
+// bridgeMetrics are the service's own metrics. Queue gauges are read from the queue
+// when /metrics is scraped rather than tracked here.
+type bridgeMetrics struct {
+	webhooksReceived    *counterVec
+	webhookCallers      *counterVec
+	payloads            *counterVec
+	deduplicated        *counterVec
+	forwards            *counterVec
+	forbidden           *counterVec
+	deadLetters         *counterVec
+	asyncInvestigations *counterVec
+	forwardAttempts     *counterVec
+	forwardRetries      *counterVec
+	requestErrors       *counterVec
+	streamChunks        *counterVec
+	backendRequests     *counterVec
+	backendEjections    *counterVec
+	circuitTransitions  *counterVec
+	openclawLatency     *histogramVec
+	queueWait           *histogramVec
+}
+
+// newBridgeMetrics creates the service metrics with no recorded values.
+func newBridgeMetrics() *bridgeMetrics {
+	return &bridgeMetrics{
+		webhooksReceived: newCounterVec("alertstoopenclaw_webhooks_received_total",
+			"Webhook requests received, by source and HTTP response code.", "source", "code"),
+		webhookCallers: newCounterVec("alertstoopenclaw_webhook_caller_requests_total",
+			"Authenticated webhook requests, by caller and HTTP response code.", "caller", "code"),
+		payloads: newCounterVec("alertstoopenclaw_payloads_total",
+			"Webhook payloads by outcome: ignored, forbidden, enqueued or dropped.", "outcome"),
+		deduplicated: newCounterVec("alertstoopenclaw_payloads_deduplicated_total",
+			"Queued payloads skipped because their alerts were already forwarded."),
+		forwards: newCounterVec("alertstoopenclaw_forwards_total",
+			"Payloads forwarded to a route, by route and result.", "route", "result"),
+		forbidden: newCounterVec("alertstoopenclaw_forwards_forbidden_total",
+			"Matched routes skipped because the payload's caller may not reach them.", "caller", "route"),
+		deadLetters: newCounterVec("alertstoopenclaw_dead_letter_events_total",
+			"Dead letters added, replayed, purged or rejected at the retention limit.", "event"),
+		asyncInvestigations: newCounterVec("alertstoopenclaw_async_investigations_total",
+			"Asynchronous investigations submitted, succeeded, failed or abandoned without a callback.", "event"),
+		forwardAttempts: newCounterVec("alertstoopenclaw_forward_attempts_total",
+			"HTTP requests sent to OpenClaw, including retries."),
+		forwardRetries: newCounterVec("alertstoopenclaw_forward_retries_total",
+			"HTTP requests to OpenClaw that retried a failed attempt."),
+		requestErrors: newCounterVec("alertstoopenclaw_openclaw_request_errors_total",
+			"Failed HTTP requests to OpenClaw, by error kind.", "kind"),
+		streamChunks: newCounterVec("alertstoopenclaw_openclaw_stream_chunks_total",
+			"Chunks received in streamed OpenClaw answers."),
+		backendRequests: newCounterVec("alertstoopenclaw_backend_requests_total",
+			"HTTP requests to OpenClaw by backend and result: success or the error kind.", "backend", "result"),
+		backendEjections: newCounterVec("alertstoopenclaw_backend_ejections_total",
+			"Backends ejected from the pool after consecutive failed requests.", "backend"),
+		circuitTransitions: newCounterVec("alertstoopenclaw_openclaw_circuit_transitions_total",
+			"OpenClaw circuit breaker state changes, by host and new state.", "host", "state"),
+		openclawLatency: newHistogramVec("alertstoopenclaw_openclaw_request_duration_seconds",
+			"Duration of individual HTTP requests to OpenClaw.", openclawLatencyBuckets),
+		queueWait: newHistogramVec("alertstoopenclaw_queue_wait_seconds",
+			"Time from a payload being queued until processing starts, by priority class.", queueWaitBuckets, "class"),
+	}
+}
+
+// write renders all metrics in the Prometheus text format.
+func (m *bridgeMetrics) write(w io.Writer) {
+	m.webhooksReceived.write(w)
+	m.webhookCallers.write(w)
+	m.payloads.write(w)
+	m.deduplicated.write(w)
+	m.forwards.write(w)
+	m.forbidden.write(w)
+	m.deadLetters.write(w)
+	m.asyncInvestigations.write(w)
+	m.forwardAttempts.write(w)
+	m.forwardRetries.write(w)
+	m.requestErrors.write(w)
+	m.streamChunks.write(w)
+	m.backendRequests.write(w)
+	m.backendEjections.write(w)
+	m.circuitTransitions.write(w)
+	m.openclawLatency.write(w)
+	m.queueWait.write(w)
+}
+
+// counterVec is a counter partitioned by label values. A counter without labels is
+// always exported, starting at zero.
+type counterVec struct {
+	name   string
+	help   string
+	labels []string
+
+	mu     sync.Mutex
+	values map[string]*counterSample
+}
+
+// counterSample is the value of one label combination of a counter.
+type counterSample struct {
+	labelValues []string
+	value       float64
+}
+
+// newCounterVec creates a counter with the given label names.
+func newCounterVec(name, help string, labels ...string) *counterVec {
+	return &counterVec{name: name, help: help, labels: labels, values: make(map[string]*counterSample)}
+}
+
+// Inc adds one to the counter for the label values.
+func (c *counterVec) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// Add adds v to the counter for the label values, which must match the label names.
+func (c *counterVec) Add(v float64, labelValues ...string) {
+	key := strings.Join(labelValues, "\xff")
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	s, ok := c.values[key]
+	if !ok {
+		s = &counterSample{labelValues: labelValues}
+		c.values[key] = s
+	}
+	s.value += v
+}
+
+// Value returns the current value for the label values.
+func (c *counterVec) Value(labelValues ...string) float64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if s, ok := c.values[strings.Join(labelValues, "\xff")]; ok {
+		return s.value
+	}
+	return 0
+}
+
+// write renders the counter, its samples sorted by label values.
+func (c *counterVec) write(w io.Writer) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	writeHeader(w, c.name, c.help, "counter")
+	if len(c.labels) == 0 && len(c.values) == 0 {
+		_, _ = fmt.Fprintf(w, "%s 0\n", c.name)
+		return
+	}
+	for _, key := range sortedKeys(c.values) {
+		s := c.values[key]
+		_, _ = fmt.Fprintf(w, "%s%s %s\n", c.name, formatLabels(c.labels, s.labelValues), formatFloat(s.value))
+	}
+}
+
+// histogramVec is a histogram with fixed upper bounds, partitioned by label values.
+type histogramVec struct {
+	name    string
+	help    string
+	buckets []float64
+	labels  []string
+
+	mu     sync.Mutex
+	values map[string]*histogramSample
+}
+
+// histogramSample holds the observations of one label combination of a histogram.
+type histogramSample struct {
+	labelValues []string
+	counts      []uint64
+	sum         float64
+	count       uint64
+}
+
+// newHistogramVec creates a histogram with the given bucket upper bounds, in increasing order.
+func newHistogramVec(name, help string, buckets []float64, labels ...string) *histogramVec {
+	return &histogramVec{
+		name:    name,
+		help:    help,
+		buckets: buckets,
+		labels:  labels,
+		values:  make(map[string]*histogramSample),
+	}
+}
+
+// Observe records a value for the label values.
+func (h *histogramVec) Observe(v float64, labelValues ...string) {
+	key := strings.Join(labelValues, "\xff")
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	s, ok := h.values[key]
+	if !ok {
+		s = &histogramSample{labelValues: labelValues, counts: make([]uint64, len(h.buckets))}
+		h.values[key] = s
+	}
+	for i, upper := range h.buckets {
+		if v <= upper {
+			s.counts[i]++
+		}
+	}
+	s.sum += v
+	s.count++
+}
+
+// write renders the histogram as cumulative buckets plus _sum and _count series.
+func (h *histogramVec) write(w io.Writer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	writeHeader(w, h.name, h.help, "histogram")
+	samples := h.values
+	if len(h.labels) == 0 && len(samples) == 0 {
+		samples = map[string]*histogramSample{"": {counts: make([]uint64, len(h.buckets))}}
+	}
+	bounds := append(append([]float64(nil), h.buckets...), math.Inf(1))
+	bucketLabels := append(append([]string(nil), h.labels...), "le")
+	for _, key := range sortedKeys(samples) {
+		s := samples[key]
+		for i, upper := range bounds {
+			count := s.count
+			if i < len(s.counts) {
+				count = s.counts[i]
+			}
+			values := append(append([]string(nil), s.labelValues...), formatFloat(upper))
+			_, _ = fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, formatLabels(bucketLabels, values), count)
+		}
+		labels := formatLabels(h.labels, s.labelValues)
+		_, _ = fmt.Fprintf(w, "%s_sum%s %s\n", h.name, labels, formatFloat(s.sum))
+		_, _ = fmt.Fprintf(w, "%s_count%s %d\n", h.name, labels, s.count)
+	}
+}
+
+// writeGauge renders a gauge with a single unlabelled value.
+func writeGauge(w io.Writer, name, help string, v float64) {
+	writeHeader(w, name, help, "gauge")
+	_, _ = fmt.Fprintf(w, "%s %s\n", name, formatFloat(v))
+}
+
+// writeHeader renders the HELP and TYPE lines of a metric.
+func writeHeader(w io.Writer, name, help, typ string) {
+	_, _ = fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+}
+
+// formatLabels renders a label set such as {route="db",result="succeeded"}, or "" if empty.
+func formatLabels(names, values []string) string {
+	if len(names) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, name := range names {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		value := ""
+		if i < len(values) {
+			value = values[i]
+		}
+		b.WriteString(name)
+		b.WriteString(`="`)
+		b.WriteString(escapeLabelValue(value))
+		b.WriteByte('"')
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+// labelValueEscaper escapes backslashes, double quotes and newlines in label values.
+var labelValueEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// escapeLabelValue escapes a label value for the text format.
+func escapeLabelValue(v string) string {
+	return labelValueEscaper.Replace(v)
+}
+
+// formatFloat renders a sample value, using +Inf for positive infinity.
+func formatFloat(v float64) string {
+	if math.IsInf(v, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// sortedKeys returns the keys of a sample map in sorted order.
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// metricsHandler serves the service metrics plus the current queue, circuit breaker and
+// backend gauges.
+func metricsHandler(queue *AlertQueue, breakers *CircuitBreakers, backends *Backends) http.HandlerFunc {
+	return func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", metricsContentType)
+		metrics.write(w)
+
+		stats := queue.Stats()
+		writeGauge(w, "alertstoopenclaw_queue_depth", "Payloads waiting in the queue.", float64(stats.Depth))
+		writeGauge(w, "alertstoopenclaw_queue_capacity",
+			"Number of queued payloads after which new groups are rejected.", float64(stats.Capacity))
+		writeGauge(w, "alertstoopenclaw_queue_in_flight", "Payloads being processed by the workers.", float64(stats.InFlight))
+		writeGauge(w, "alertstoopenclaw_queue_workers", "Number of queue workers.", float64(stats.Workers))
+		writeHeader(w, "alertstoopenclaw_queue_merged_total",
+			"Payloads merged into a queued payload of the same group.", "counter")
+		_, _ = fmt.Fprintf(w, "alertstoopenclaw_queue_merged_total %d\n", stats.Merged)
+		writeGauge(w, "alertstoopenclaw_dead_letters", "Payloads kept in the dead letters.", float64(stats.DeadLetters))
+		writeHeader(w, "alertstoopenclaw_queue_class_depth", "Payloads waiting in the queue, by priority class.", "gauge")
+		for _, c := range stats.Classes {
+			_, _ = fmt.Fprintf(w, "alertstoopenclaw_queue_class_depth%s %d\n",
+				formatLabels([]string{"class"}, []string{c.Class}), c.Depth)
+		}
+		writeCircuitStates(w, breakers)
+		writeBackendStates(w, backends)
+	}
+}
+
+// writeBackendStates renders the health, ejection and in-flight requests of each backend
+// of the pool.
+func writeBackendStates(w io.Writer, backends *Backends) {
+	states := backends.States()
+	gauges := []struct {
+		name, help string
+		value      func(BackendStatus) float64
+	}{
+		{"alertstoopenclaw_backend_healthy", "Whether the backend passed its last health check.",
+			func(s BackendStatus) float64 { return boolValue(s.Healthy) }},
+		{"alertstoopenclaw_backend_ejected", "Whether the backend is ejected after consecutive failures.",
+			func(s BackendStatus) float64 { return boolValue(s.Ejected) }},
+		{"alertstoopenclaw_backend_in_flight", "HTTP requests in progress to the backend.",
+			func(s BackendStatus) float64 { return float64(s.InFlight) }},
+	}
+	for _, g := range gauges {
+		writeHeader(w, g.name, g.help, "gauge")
+		for _, s := range states {
+			_, _ = fmt.Fprintf(w, "%s%s %s\n", g.name, formatLabels([]string{"backend"}, []string{s.Name}),
+				formatFloat(g.value(s)))
+		}
+	}
+}
+
+// boolValue returns 1 for true and 0 for false.
+func boolValue(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// writeCircuitStates renders one series per OpenClaw host and circuit state, set to 1
+// for the current state and 0 for the others.
+func writeCircuitStates(w io.Writer, breakers *CircuitBreakers) {
+	writeHeader(w, "alertstoopenclaw_openclaw_circuit_state",
+		"OpenClaw circuit breaker state by host: 1 for the current state, 0 otherwise.", "gauge")
+	for _, c := range breakers.States() {
+		for _, state := range circuitStates {
+			v := 0
+			if c.State == state {
+				v = 1
+			}
+			_, _ = fmt.Fprintf(w, "alertstoopenclaw_openclaw_circuit_state%s %d\n",
+				formatLabels([]string{"host", "state"}, []string{c.Host, state.String()}), v)
+		}
+	}
+}
+
+// statusRecorder captures the status code written by a handler.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+// WriteHeader records the status code before writing it.
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// countWebhooks counts the requests handled by next by source and response code.
+func countWebhooks(source string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next(rec, r)
+		metrics.webhooksReceived.Inc(source, strconv.Itoa(rec.status))
+	}
+}
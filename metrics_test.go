@@ -0,0 +1,106 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCounterVec_Write(t *testing.T) {
+	t.Parallel()
+
+	c := newCounterVec("test_total", "A test counter.", "route", "result")
+	c.Inc("db", "succeeded")
+	c.Add(2, "db", "succeeded")
+	c.Inc(`we"ird`, "failed")
+
+	var b strings.Builder
+	c.write(&b)
+
+	want := "# HELP test_total A test counter.\n" +
+		"# TYPE test_total counter\n" +
+		"test_total{route=\"db\",result=\"succeeded\"} 3\n" +
+		"test_total{route=\"we\\\"ird\",result=\"failed\"} 1\n"
+	if b.String() != want {
+		t.Fatalf("unexpected output:\n%s\nwant:\n%s", b.String(), want)
+	}
+	if got := c.Value("db", "succeeded"); got != 3 {
+		t.Fatalf("expected value 3, got %v", got)
+	}
+}
+
+func TestCounterVec_WriteUnlabelledZero(t *testing.T) {
+	t.Parallel()
+
+	var b strings.Builder
+	newCounterVec("test_total", "A test counter.").write(&b)
+	if !strings.HasSuffix(b.String(), "\ntest_total 0\n") {
+		t.Fatalf("expected zero sample, got:\n%s", b.String())
+	}
+}
+
+func TestHistogramVec_Write(t *testing.T) {
+	t.Parallel()
+
+	h := newHistogramVec("test_seconds", "A test histogram.", []float64{0.5, 1})
+	h.Observe(0.25)
+	h.Observe(0.75)
+	h.Observe(3)
+
+	var b strings.Builder
+	h.write(&b)
+
+	want := "# HELP test_seconds A test histogram.\n" +
+		"# TYPE test_seconds histogram\n" +
+		"test_seconds_bucket{le=\"0.5\"} 1\n" +
+		"test_seconds_bucket{le=\"1\"} 2\n" +
+		"test_seconds_bucket{le=\"+Inf\"} 3\n" +
+		"test_seconds_sum 4\n" +
+		"test_seconds_count 3\n"
+	if b.String() != want {
+		t.Fatalf("unexpected output:\n%s\nwant:\n%s", b.String(), want)
+	}
+}
+
+func TestMetricsEndpoint(t *testing.T) {
+	t.Parallel()
+
+	client := NewOpenClawClient("http://localhost", "token", "model")
+	queue := NewAlertQueue(client, WithCapacity(7))
+	t.Cleanup(queue.Stop)
+	mux := NewMux(queue, "")
+
+	before := metrics.webhooksReceived.Value("alertmanager", "400")
+	req := httptest.NewRequest(http.MethodPost, "/webhook", strings.NewReader("{invalid"))
+	mux.ServeHTTP(httptest.NewRecorder(), req)
+	if got := metrics.webhooksReceived.Value("alertmanager", "400"); got != before+1 {
+		t.Fatalf("expected 400 counter to increase by 1, got %v -> %v", before, got)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", w.Code)
+	}
+	if ct := w.Header().Get("Content-Type"); ct != metricsContentType {
+		t.Fatalf("unexpected content type %q", ct)
+	}
+	body := w.Body.String()
+	for _, want := range []string{
+		"# TYPE alertstoopenclaw_webhooks_received_total counter\n",
+		`alertstoopenclaw_webhooks_received_total{source="alertmanager",code="400"} `,
+		"alertstoopenclaw_queue_depth 0\n",
+		"alertstoopenclaw_queue_capacity 7\n",
+		`alertstoopenclaw_queue_class_depth{class="other"} 0` + "\n",
+		"# TYPE alertstoopenclaw_openclaw_request_duration_seconds histogram\n",
+		"# TYPE alertstoopenclaw_queue_wait_seconds histogram\n",
+		"alertstoopenclaw_forward_retries_total ",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("metrics output missing %q", want)
+		}
+	}
+}
@@ -3,39 +3,145 @@ package main
 import (
 	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
 	"net/http"
+	"strings"
 	"time"
 )
 
-// OpenClawClient sends alert prompts to an OpenClaw instance.
+// OpenClawClient sends alert prompts to an OpenClaw instance, or to the backends of a
+// pool. The base URL, token and model apply without a pool; with one, the token and
+// model are the defaults for backends that set none.
 type OpenClawClient struct {
-	baseURL string
-	token   string
-	model   string
-	client  *http.Client
-}
-
-// NewOpenClawClient creates a client with a 30-second timeout.
-func NewOpenClawClient(baseURL, token, model string) *OpenClawClient {
-	return &OpenClawClient{
-		baseURL: baseURL,
-		token:   token,
-		model:   model,
+	baseURL          string
+	token            string
+	model            string
+	templates        *PromptTemplates
+	firingTemplate   string
+	resolvedTemplate string
+	client           *http.Client
+	breakers         *CircuitBreakers
+	retry            RetryPolicy
+	pool             *BackendPool
+	backends         []*clientBackend
+	callbackURL      string
+	streamIdle       time.Duration
+}
+
+// ClientOption configures optional OpenClawClient behaviour.
+type ClientOption func(*OpenClawClient)
+
+// WithPromptTemplates renders prompts with t instead of the built-in templates.
+func WithPromptTemplates(t *PromptTemplates) ClientOption {
+	return func(c *OpenClawClient) {
+		c.templates = t
+	}
+}
+
+// WithTemplates selects the templates used for firing and resolved payloads.
+func WithTemplates(firing, resolved string) ClientOption {
+	return func(c *OpenClawClient) {
+		c.firingTemplate = firing
+		c.resolvedTemplate = resolved
+	}
+}
+
+// WithTransport sends requests through rt instead of http.DefaultTransport.
+func WithTransport(rt http.RoundTripper) ClientOption {
+	return func(c *OpenClawClient) {
+		c.client.Transport = rt
+	}
+}
+
+// WithRetryPolicy sets how often and how long Forward retries failed requests.
+func WithRetryPolicy(p RetryPolicy) ClientOption {
+	return func(c *OpenClawClient) {
+		c.retry = p
+	}
+}
+
+// WithCircuitBreakers sends requests through the circuit breaker for each backend's host.
+func WithCircuitBreakers(breakers *CircuitBreakers) ClientOption {
+	return func(c *OpenClawClient) {
+		c.breakers = breakers
+	}
+}
+
+// WithBackendPool sends requests to the backends of pool instead of the base URL.
+func WithBackendPool(pool *BackendPool) ClientOption {
+	return func(c *OpenClawClient) {
+		c.pool = pool
+	}
+}
+
+// WithAsyncCallback submits investigations asynchronously: each request carries an
+// investigation ID and the URL under callbackURL that OpenClaw posts the result to, and
+// a 2xx answer only acknowledges the submission.
+func WithAsyncCallback(callbackURL string) ClientOption {
+	return func(c *OpenClawClient) {
+		c.callbackURL = strings.TrimSuffix(callbackURL, "/")
+	}
+}
+
+// WithStreaming requests answers as server-sent event streams. Instead of the 30-second
+// total timeout, a request fails once idleTimeout passes without data, so an answer may
+// take as long as OpenClaw keeps sending it.
+func WithStreaming(idleTimeout time.Duration) ClientOption {
+	return func(c *OpenClawClient) {
+		c.streamIdle = idleTimeout
+	}
+}
+
+// NewOpenClawClient creates a client with a 30-second timeout, or an idle timeout when
+// streaming.
+func NewOpenClawClient(baseURL, token, model string, opts ...ClientOption) *OpenClawClient {
+	c := &OpenClawClient{
+		baseURL:          baseURL,
+		token:            token,
+		model:            model,
+		templates:        defaultPromptTemplates,
+		firingTemplate:   firingTemplateName,
+		resolvedTemplate: resolvedTemplateName,
+		retry:            defaultRetryPolicy,
 		client: &http.Client{
 			Timeout: 30 * time.Second,
 		},
 	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	if c.streamIdle > 0 {
+		c.client.Timeout = 0
+	}
+	if c.pool != nil {
+		c.backends = c.pool.backendsFor(token, model, c.breakers)
+	} else {
+		c.backends = []*clientBackend{{
+			name:    backendName(baseURL),
+			url:     baseURL,
+			token:   token,
+			model:   model,
+			breaker: c.breakers.For(baseURL),
+			state:   &backendState{name: backendName(baseURL), url: baseURL, healthy: true},
+		}}
+	}
+	return c
 }
 
 // chatRequest is the request body for the OpenClaw chat completions API.
 type chatRequest struct {
-	Model    string        `json:"model"`
-	Messages []chatMessage `json:"messages"`
-	Stream   bool          `json:"stream"`
+	Model         string             `json:"model"`
+	Messages      []chatMessage      `json:"messages"`
+	Stream        bool               `json:"stream"`
+	StreamOptions *chatStreamOptions `json:"stream_options,omitempty"`
+	User          string             `json:"user,omitempty"`
+	Metadata      map[string]string  `json:"metadata,omitempty"`
 }
 
 // chatMessage represents a single message in the OpenClaw chat API request.
@@ -44,93 +150,330 @@ type chatMessage struct {
 	Content string `json:"content"`
 }
 
-// buildPrompt creates the structured prompt from an Alertmanager payload.
-func buildPrompt(payload *AlertmanagerPayload) (string, error) {
-	raw, err := json.MarshalIndent(payload, "", "  ")
-	if err != nil {
-		return "", fmt.Errorf("marshal payload: %w", err)
-	}
+// chatResponse is the response body of the OpenClaw chat completions API.
+type chatResponse struct {
+	ID      string       `json:"id,omitempty"`
+	Model   string       `json:"model,omitempty"`
+	Created int64        `json:"created,omitempty"`
+	Choices []chatChoice `json:"choices"`
+	Usage   *chatUsage   `json:"usage,omitempty"`
+}
+
+// chatChoice is one completion choice in a chat completions response.
+type chatChoice struct {
+	Index        int         `json:"index"`
+	Message      chatMessage `json:"message"`
+	FinishReason string      `json:"finish_reason,omitempty"`
+}
+
+// chatUsage reports token usage for a chat completions request.
+type chatUsage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+}
 
-	prompt := fmt.Sprintf(`You received the following Grafana Alertmanager webhook payload:
+// maxResponseSize caps how much of a successful OpenClaw response is parsed.
+const maxResponseSize = 10 << 20
+
+// errorSnippetSize caps how much of an error response body is kept for logs and dead letters.
+const errorSnippetSize = 512
+
+// ForwardResult describes a forwarding attempt: the prompt sent, the backend and model of
+// the last request, how many requests were made and, on success, the parsed OpenClaw response.
+// In async mode it also holds the investigation ID that OpenClaw's callback refers to.
+type ForwardResult struct {
+	InvestigationID string
+	Prompt          string
+	Backend         string
+	Model           string
+	Attempts        int
+	StartedAt       time.Time
+	FinishedAt      time.Time
+	Response        *chatResponse
+	AttemptLog      []ForwardAttempt
+}
 
-`+"```json\n%s\n```"+`
+// ForwardAttempt records one HTTP request to OpenClaw. For a failed request it holds the
+// error kind and, for a non-2xx response, the status code and the start of the response body.
+type ForwardAttempt struct {
+	StartedAt  time.Time `json:"started_at"`
+	FinishedAt time.Time `json:"finished_at"`
+	Backend    string    `json:"backend,omitempty"`
+	Kind       string    `json:"kind,omitempty"`
+	Status     int       `json:"status,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	Response   string    `json:"response,omitempty"`
+}
+
+// newForwardAttempt records a request to backend that started at start and ended with err.
+func newForwardAttempt(backend string, start time.Time, err error) ForwardAttempt {
+	a := ForwardAttempt{StartedAt: start, FinishedAt: time.Now().UTC(), Backend: backend}
+	if err == nil {
+		return a
+	}
+	a.Error = err.Error()
+	a.Kind = errorKindOf(err).String()
+	var reqErr *requestError
+	if errors.As(err, &reqErr) {
+		a.Status = reqErr.status
+		a.Response = reqErr.body
+	}
+	return a
+}
 
-Investigate the alert(s) above. Try to identify the root cause and resolve the issue if possible.
-If you cannot resolve it, provide a detailed diagnosis and suggest remediation steps.
-Report your findings and the current status (resolved, in-progress, or needs-manual-intervention).`, raw)
+// buildPrompt renders the prompt for a payload: the resolved template for resolved
+// payloads, the firing template otherwise.
+func (c *OpenClawClient) buildPrompt(payload *AlertmanagerPayload) (string, error) {
+	name := c.firingTemplate
+	if payload.Status == "resolved" {
+		name = c.resolvedTemplate
+	}
+	return c.templates.Render(name, payload)
+}
 
-	return prompt, nil
+// sessionUser derives the OpenAI-compatible user field from the alert group, so that
+// every notification for a group, including its resolution, lands in the same OpenClaw session.
+func sessionUser(payload *AlertmanagerPayload) string {
+	sum := sha256.Sum256([]byte(groupKey(payload)))
+	return "alertstoopenclaw:" + hex.EncodeToString(sum[:8])
 }
 
-// doRequest sends a single HTTP request to OpenClaw and returns nil on success.
-func (c *OpenClawClient) doRequest(ctx context.Context, url string, body []byte, attempt int) error {
+// doRequest sends a single HTTP request to OpenClaw and returns the parsed response on success.
+// A 2xx response whose body cannot be parsed is still a success, with a nil response.
+// A streamed answer is assembled from its chunks, reporting progress to the progress
+// function of ctx. Failures are returned as a *requestError classifying them.
+func (c *OpenClawClient) doRequest(
+	ctx context.Context, b *clientBackend, body []byte, attempt int,
+) (*chatResponse, error) {
+	var idle *idleTimer
+	if c.streamIdle > 0 {
+		ctx, idle = startIdleTimer(ctx, c.streamIdle)
+		defer idle.stop()
+	}
+	url := b.url + "/v1/chat/completions"
 	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
 	if err != nil {
-		return fmt.Errorf("create request: %w", err)
+		return nil, fmt.Errorf("create request: %w", err)
 	}
 	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", "Bearer "+c.token)
+	req.Header.Set("Authorization", "Bearer "+b.token)
+
+	start := time.Now()
+	defer func() { metrics.openclawLatency.Observe(time.Since(start).Seconds()) }()
 
 	resp, err := c.client.Do(req) //nolint:gosec // G704: URL is from server config, not user input.
 	if err != nil {
-		slog.Warn("openclaw request error", "attempt", attempt, "error", err)
-		return fmt.Errorf("request failed: %w", err)
+		return nil, transportFailure(b, attempt, idleCause(ctx, err))
 	}
 
 	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
-		_, _ = io.Copy(io.Discard, resp.Body)
-		_ = resp.Body.Close()
-		return nil
+		defer func() {
+			_, _ = io.Copy(io.Discard, resp.Body)
+			_ = resp.Body.Close()
+		}()
+		var r io.Reader = resp.Body
+		if idle != nil {
+			r = idle.reader(r)
+		}
+		// A stream is limited by the size of its assembled answer rather than of its body.
+		if isEventStream(resp) {
+			return c.readStream(ctx, r, b, attempt)
+		}
+		var parsed chatResponse
+		if err := json.NewDecoder(io.LimitReader(r, maxResponseSize)).Decode(&parsed); err != nil {
+			slog.Warn("could not parse openclaw response", "backend", b.name, "attempt", attempt, "error", err)
+			return nil, nil
+		}
+		return &parsed, nil
 	}
 
-	// Read up to 512 bytes of the error response body for logging.
-	errBody, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	// Read the start of the error response body for logging.
+	errBody, _ := io.ReadAll(io.LimitReader(resp.Body, errorSnippetSize))
 	_ = resp.Body.Close()
 
+	reqErr := newStatusError(resp, string(errBody), time.Now())
 	//nolint:gosec // G706: structured slog key-value, not string interpolation.
-	slog.Warn("openclaw non-2xx response", "attempt", attempt, "status", resp.StatusCode, "body", string(errBody))
-	return fmt.Errorf("openclaw returned status %d", resp.StatusCode)
+	slog.Warn("openclaw non-2xx response", "backend", b.name, "attempt", attempt, "status", resp.StatusCode,
+		"kind", reqErr.kind.String(), "body", string(errBody))
+	metrics.requestErrors.Inc(reqErr.kind.String())
+	return nil, reqErr
 }
 
-// Forward sends the alert payload to OpenClaw with up to 3 retries and exponential backoff.
-func (c *OpenClawClient) Forward(ctx context.Context, payload *AlertmanagerPayload) error {
-	prompt, err := buildPrompt(payload)
-	if err != nil {
-		return fmt.Errorf("build prompt: %w", err)
+// readStream reads a streamed answer from r. A connection that drops or goes quiet
+// mid-stream fails like one that fails before the response.
+func (c *OpenClawClient) readStream(
+	ctx context.Context, r io.Reader, b *clientBackend, attempt int,
+) (*chatResponse, error) {
+	parsed, err := readStream(r, newProgressReporter(ctx, b, attempt))
+	var reqErr *requestError
+	switch {
+	case err == nil:
+		return parsed, nil
+	case errors.As(err, &reqErr):
+		slog.Warn("openclaw stream error", "backend", b.name, "attempt", attempt, "error", err)
+		metrics.requestErrors.Inc(reqErr.kind.String())
+		return nil, reqErr
+	default:
+		return nil, transportFailure(b, attempt, idleCause(ctx, err))
 	}
+}
 
-	reqBody := chatRequest{
-		Model: c.model,
-		Messages: []chatMessage{
-			{Role: "user", Content: prompt},
-		},
-		Stream: false,
-	}
+// transportFailure classifies, logs and counts a request that failed without a complete response.
+func transportFailure(b *clientBackend, attempt int, err error) *requestError {
+	reqErr := newTransportError(err)
+	slog.Warn("openclaw request error", "backend", b.name, "attempt", attempt, "kind", reqErr.kind.String(), "error", err)
+	metrics.requestErrors.Inc(reqErr.kind.String())
+	return reqErr
+}
 
-	bodyBytes, err := json.Marshal(reqBody)
+// Forward sends the alert payload to OpenClaw, retrying transport errors, timeouts, rate
+// limiting and server errors with full-jitter exponential backoff, up to the attempts of
+// the client's retry policy. Client and authentication errors are not retried. A
+// Retry-After header on a 429 or 503 response sets the wait, up to the policy's maximum delay.
+// With a backend pool, each request goes to the backend picked by the pool's strategy,
+// and a failed request is retried on another available backend without waiting.
+// Resolved payloads are sent with a closing prompt instead of an investigation request.
+// With a circuit breaker, requests wait while the circuit is open, and failures caused
+// by the host being down do not count as attempts, so the payload is held until the
+// host recovers or ctx is cancelled. The result is non-nil whenever a request was
+// attempted, including on failure. In async mode every request for the payload carries
+// the same investigation ID, the one set with WithInvestigationID if any.
+func (c *OpenClawClient) Forward(ctx context.Context, payload *AlertmanagerPayload) (*ForwardResult, error) {
+	prompt, err := c.buildPrompt(payload)
 	if err != nil {
-		return fmt.Errorf("marshal request: %w", err)
+		return nil, fmt.Errorf("build prompt: %w", err)
 	}
 
-	url := c.baseURL + "/v1/chat/completions"
+	user := sessionUser(payload)
+	result := &ForwardResult{Prompt: prompt, Model: c.model, StartedAt: time.Now().UTC()}
+	defer func() { result.FinishedAt = time.Now().UTC() }()
+	metadata := c.asyncMetadata(ctx, result)
 
 	var lastErr error
-	for attempt := range 3 {
-		if attempt > 0 {
-			backoff := time.Duration(1<<(attempt-1)) * time.Second //nolint:gosec // G115: attempt is 1 or 2, no overflow.
-			slog.Info("retrying openclaw request", "attempt", attempt+1, "backoff", backoff)
+	var last *clientBackend
+	held := false
+	tried := make(map[*clientBackend]bool, len(c.backends))
+	for failed := 0; failed < c.retry.Attempts; {
+		b := c.pick(tried)
+		if failed > 0 && !held && b == last {
+			backoff := c.retry.delay(failed, lastErr)
+			slog.Info("retrying openclaw request", "backend", b.name, "attempt", result.Attempts+1, "backoff", backoff)
 			select {
 			case <-time.After(backoff):
 			case <-ctx.Done():
-				return fmt.Errorf("context cancelled during backoff: %w", ctx.Err())
+				return result, fmt.Errorf("context cancelled during backoff: %w", ctx.Err())
 			}
 		}
+		body, err := json.Marshal(chatRequest{
+			Model:         b.model,
+			Messages:      []chatMessage{{Role: "user", Content: prompt}},
+			Stream:        c.streamIdle > 0,
+			StreamOptions: c.streamOptions(),
+			User:          user,
+			Metadata:      metadata,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("marshal request: %w", err)
+		}
 
-		lastErr = c.doRequest(ctx, url, bodyBytes, attempt+1)
-		if lastErr == nil {
-			return nil
+		tried[b], last = true, b
+		if held, lastErr = c.attempt(ctx, b, body, result); lastErr == nil {
+			return result, nil
+		}
+		if ctx.Err() != nil {
+			return result, fmt.Errorf("openclaw request cancelled: %w", lastErr)
+		}
+		if kind := errorKindOf(lastErr); !kind.retryable() {
+			return result, fmt.Errorf("openclaw request failed with %s, not retrying: %w", kind, lastErr)
+		}
+		if !held {
+			failed++
 		}
 	}
 
-	return fmt.Errorf("openclaw request failed after 3 attempts: %w", lastErr)
+	return result, fmt.Errorf("openclaw request failed after %d attempts: %w", result.Attempts, lastErr)
+}
+
+// Async reports whether the client submits investigations in async mode.
+func (c *OpenClawClient) Async() bool {
+	return c.callbackURL != ""
+}
+
+// streamOptions returns the stream options of a request, or nil when not streaming.
+func (c *OpenClawClient) streamOptions() *chatStreamOptions {
+	if c.streamIdle <= 0 {
+		return nil
+	}
+	return &chatStreamOptions{IncludeUsage: true}
+}
+
+// asyncMetadata assigns the result the investigation ID of ctx, or a new one, in async
+// mode and returns the request metadata telling OpenClaw where to report completion. It
+// returns nil otherwise.
+func (c *OpenClawClient) asyncMetadata(ctx context.Context, result *ForwardResult) map[string]string {
+	if c.callbackURL == "" {
+		return nil
+	}
+	result.InvestigationID = firstNonEmpty(investigationIDFrom(ctx), newID())
+	return map[string]string{
+		"investigation_id": result.InvestigationID,
+		"callback_url":     c.callbackURL + callbackPath + result.InvestigationID,
+	}
+}
+
+// pick returns the backend for the next request of a forward that already tried the
+// backends in tried.
+func (c *OpenClawClient) pick(tried map[*clientBackend]bool) *clientBackend {
+	if c.pool == nil {
+		return c.backends[0]
+	}
+	return c.pool.pick(c.backends, tried)
+}
+
+// attempt sends one request to b once its circuit breaker lets it through and records it
+// in result. It reports whether the request failed because the host is down, in which
+// case the failure does not count against the payload's attempts.
+func (c *OpenClawClient) attempt(
+	ctx context.Context, b *clientBackend, body []byte, result *ForwardResult,
+) (bool, error) {
+	probe, err := b.breaker.acquire(ctx)
+	if err != nil {
+		return false, fmt.Errorf("wait for open circuit: %w", err)
+	}
+
+	result.Attempts++
+	result.Backend, result.Model = b.name, b.model
+	metrics.forwardAttempts.Inc()
+	if result.Attempts > 1 {
+		metrics.forwardRetries.Inc()
+	}
+	b.state.inFlight.Add(1)
+	start := time.Now().UTC()
+	result.Response, err = c.doRequest(ctx, b, body, result.Attempts)
+	b.state.inFlight.Add(-1)
+	result.AttemptLog = append(result.AttemptLog, newForwardAttempt(b.name, start, err))
+	if err != nil && ctx.Err() != nil {
+		b.breaker.release(probe)
+		return false, err
+	}
+	metrics.backendRequests.Inc(b.name, requestOutcome(err))
+	c.registry().record(b.state, err)
+	return b.breaker.record(probe, err), err
+}
+
+// registry returns the backend states of the client's pool, or nil without a pool.
+func (c *OpenClawClient) registry() *Backends {
+	if c.pool == nil {
+		return nil
+	}
+	return c.pool.registry
+}
+
+// requestOutcome returns "success" for a nil error and the error kind otherwise.
+func requestOutcome(err error) string {
+	if err == nil {
+		return "success"
+	}
+	return errorKindOf(err).String()
 }
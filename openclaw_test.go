@@ -7,6 +7,7 @@ import (
 	"strings"
 	"sync/atomic"
 	"testing"
+	"time"
 )
 
 func TestBuildPrompt(t *testing.T) {
@@ -27,7 +28,8 @@ func TestBuildPrompt(t *testing.T) {
 		CommonLabels: map[string]string{"alertname": "HighCPU"},
 	}
 
-	prompt, err := buildPrompt(payload)
+	client := NewOpenClawClient("http://localhost", "token", "model")
+	prompt, err := client.buildPrompt(payload)
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -40,6 +42,44 @@ func TestBuildPrompt(t *testing.T) {
 	}
 }
 
+func TestBuildResolvedPrompt(t *testing.T) {
+	t.Parallel()
+
+	payload := &AlertmanagerPayload{
+		Status:       "resolved",
+		Alerts:       []Alert{{Status: "resolved", Labels: map[string]string{"alertname": "HighCPU"}}},
+		CommonLabels: map[string]string{"alertname": "HighCPU"},
+	}
+
+	client := NewOpenClawClient("http://localhost", "token", "model")
+	prompt, err := client.buildPrompt(payload)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if !strings.Contains(prompt, `"alertname": "HighCPU"`) {
+		t.Error("prompt should contain alert JSON")
+	}
+	if !strings.Contains(prompt, "closing summary") {
+		t.Error("prompt should ask for a closing summary")
+	}
+}
+
+func TestSessionUser(t *testing.T) {
+	t.Parallel()
+
+	firing := &AlertmanagerPayload{GroupKey: `{}:{alertname="HighCPU"}`, Status: "firing"}
+	resolved := &AlertmanagerPayload{GroupKey: `{}:{alertname="HighCPU"}`, Status: "resolved"}
+	other := &AlertmanagerPayload{GroupKey: `{}:{alertname="DiskFull"}`, Status: "firing"}
+
+	if sessionUser(firing) != sessionUser(resolved) {
+		t.Fatal("expected firing and resolved notifications of a group to share a session")
+	}
+	if sessionUser(firing) == sessionUser(other) {
+		t.Fatal("expected different groups to use different sessions")
+	}
+}
+
 func TestForward_Success(t *testing.T) {
 	t.Parallel()
 
@@ -55,11 +95,51 @@ func TestForward_Success(t *testing.T) {
 		CommonLabels: map[string]string{"alertname": "Test"},
 	}
 
-	if err := client.Forward(context.Background(), payload); err != nil {
+	if _, err := client.Forward(context.Background(), payload); err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
 }
 
+func TestForward_CapturesResponse(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"id":"chatcmpl-1","choices":[{"index":0,` +
+			`"message":{"role":"assistant","content":"Root cause: disk full"},"finish_reason":"stop"}],` +
+			`"usage":{"prompt_tokens":100,"completion_tokens":20,"total_tokens":120}}`))
+	}))
+	defer server.Close()
+
+	client := NewOpenClawClient(server.URL, "token", "test-model")
+	payload := &AlertmanagerPayload{
+		Status:       "firing",
+		Alerts:       []Alert{{Status: "firing", Labels: map[string]string{"alertname": "Test"}}},
+		CommonLabels: map[string]string{"alertname": "Test"},
+	}
+
+	result, err := client.Forward(context.Background(), payload)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result.Attempts != 1 || result.Model != "test-model" || result.Prompt == "" {
+		t.Fatalf("unexpected result: %+v", result)
+	}
+	if result.Response == nil || len(result.Response.Choices) != 1 {
+		t.Fatalf("expected parsed response, got %+v", result.Response)
+	}
+	choice := result.Response.Choices[0]
+	if choice.Message.Content != "Root cause: disk full" || choice.FinishReason != "stop" {
+		t.Fatalf("unexpected choice: %+v", choice)
+	}
+	if result.Response.Usage == nil || result.Response.Usage.TotalTokens != 120 {
+		t.Fatalf("unexpected usage: %+v", result.Response.Usage)
+	}
+	if result.FinishedAt.Before(result.StartedAt) {
+		t.Fatal("expected finish time after start time")
+	}
+}
+
 func TestForward_Retry(t *testing.T) {
 	t.Parallel()
 
@@ -81,7 +161,7 @@ func TestForward_Retry(t *testing.T) {
 		CommonLabels: map[string]string{"alertname": "Test"},
 	}
 
-	if err := client.Forward(context.Background(), payload); err != nil {
+	if _, err := client.Forward(context.Background(), payload); err != nil {
 		t.Fatalf("expected success after retries, got: %v", err)
 	}
 
@@ -107,7 +187,7 @@ func TestForward_AllRetriesFail(t *testing.T) {
 		CommonLabels: map[string]string{"alertname": "Test"},
 	}
 
-	err := client.Forward(context.Background(), payload)
+	_, err := client.Forward(context.Background(), payload)
 	if err == nil {
 		t.Fatal("expected error after all retries fail")
 	}
@@ -140,7 +220,7 @@ func TestForward_ContextCancelled(t *testing.T) {
 	ctx, cancel := context.WithCancel(context.Background())
 	cancel() // Cancel immediately.
 
-	err := client.Forward(ctx, payload)
+	_, err := client.Forward(ctx, payload)
 	if err == nil {
 		t.Fatal("expected error with cancelled context")
 	}
@@ -150,3 +230,78 @@ func TestForward_ContextCancelled(t *testing.T) {
 		t.Fatalf("expected at most 1 request with cancelled context, got %d", got)
 	}
 }
+
+func TestForward_ClientErrorNotRetried(t *testing.T) {
+	t.Parallel()
+
+	var count atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		count.Add(1)
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer server.Close()
+
+	client := NewOpenClawClient(server.URL, "token", "test-model")
+	payload := &AlertmanagerPayload{Status: "firing", CommonLabels: map[string]string{"alertname": "Test"}}
+
+	result, err := client.Forward(context.Background(), payload)
+	if err == nil || !strings.Contains(err.Error(), "auth_error") {
+		t.Fatalf("expected a permanent auth error, got %v", err)
+	}
+	if got := count.Load(); got != 1 {
+		t.Fatalf("expected 1 request, got %d", got)
+	}
+	if kind := result.AttemptLog[0].Kind; kind != "auth_error" {
+		t.Fatalf("expected the attempt to record its error kind, got %q", kind)
+	}
+}
+
+func TestForward_RetryAfter(t *testing.T) {
+	t.Parallel()
+
+	var count atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		if count.Add(1) == 1 {
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	policy := RetryPolicy{Attempts: 2, BaseDelay: time.Millisecond, MaxDelay: 5 * time.Second}
+	client := NewOpenClawClient(server.URL, "token", "test-model", WithRetryPolicy(policy))
+	payload := &AlertmanagerPayload{Status: "firing", CommonLabels: map[string]string{"alertname": "Test"}}
+
+	result, err := client.Forward(context.Background(), payload)
+	if err != nil {
+		t.Fatalf("expected success after the rate limit, got: %v", err)
+	}
+	if wait := result.AttemptLog[1].StartedAt.Sub(result.AttemptLog[0].FinishedAt); wait < 900*time.Millisecond {
+		t.Fatalf("expected the retry to wait for Retry-After, waited %s", wait)
+	}
+}
+
+func TestForward_ConfiguredAttempts(t *testing.T) {
+	t.Parallel()
+
+	var count atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		count.Add(1)
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer server.Close()
+
+	policy := RetryPolicy{Attempts: 5, BaseDelay: time.Millisecond, MaxDelay: 10 * time.Millisecond}
+	client := NewOpenClawClient(server.URL, "token", "test-model", WithRetryPolicy(policy))
+	payload := &AlertmanagerPayload{Status: "firing", CommonLabels: map[string]string{"alertname": "Test"}}
+
+	_, err := client.Forward(context.Background(), payload)
+	if err == nil || !strings.Contains(err.Error(), "after 5 attempts") {
+		t.Fatalf("expected failure after 5 attempts, got %v", err)
+	}
+	if got := count.Load(); got != 5 {
+		t.Fatalf("expected 5 requests, got %d", got)
+	}
+}
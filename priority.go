@@ -0,0 +1,91 @@
+package main
+
+import (
+	"slices"
+	"time"
+)
+
+// Priority defaults: classes are taken from the severity label, and a payload moves up
+// one class for every two minutes it waits.
+const (
+	defaultPriorityLabel = "severity"
+	defaultPriorityAging = 2 * time.Minute
+)
+
+// otherPriorityClass is the lowest class. It holds payloads without the priority label
+// or with a value that is not listed.
+const otherPriorityClass = "other"
+
+// defaultPriorityClasses are the priority classes, from highest to lowest.
+var defaultPriorityClasses = []string{"critical", "warning", "info"}
+
+// PriorityClasses assigns queued payloads to priority classes by the value of a label.
+// The queue processes higher classes first. To keep a steady stream of urgent payloads
+// from starving the others, a payload counts as one class higher for every aging
+// interval it has waited. A nil *PriorityClasses puts every payload in one class.
+type PriorityClasses struct {
+	label   string
+	classes []string
+	aging   time.Duration
+}
+
+// NewPriorityClasses creates priority classes from the values of label, listed from
+// highest to lowest priority. An aging interval of zero disables aging.
+func NewPriorityClasses(label string, classes []string, aging time.Duration) *PriorityClasses {
+	return &PriorityClasses{label: label, classes: classes, aging: aging}
+}
+
+// Names returns the class names from highest to lowest priority, ending with "other".
+func (p *PriorityClasses) Names() []string {
+	if p == nil {
+		return []string{otherPriorityClass}
+	}
+	return append(slices.Clip(p.classes), otherPriorityClass)
+}
+
+// name returns the name of a class returned by class.
+func (p *PriorityClasses) name(class int) string {
+	return p.Names()[class]
+}
+
+// class returns the index of the payload's class; lower indexes are more urgent. The
+// label is looked up in the common and group labels like a route matcher. If neither has
+// it, the most urgent class among the payload's alerts is used, so a group of mixed
+// severities is treated by its most severe alert.
+func (p *PriorityClasses) class(payload *AlertmanagerPayload) int {
+	if p == nil {
+		return 0
+	}
+	v, ok := payload.CommonLabels[p.label]
+	if !ok {
+		v, ok = payload.GroupLabels[p.label]
+	}
+	if ok {
+		return p.index(v)
+	}
+	best := len(p.classes)
+	for _, a := range payload.Alerts {
+		if v, ok := a.Labels[p.label]; ok {
+			best = min(best, p.index(v))
+		}
+	}
+	return best
+}
+
+// index returns the index of a label value, or that of the "other" class.
+func (p *PriorityClasses) index(value string) int {
+	if i := slices.Index(p.classes, value); i >= 0 {
+		return i
+	}
+	return len(p.classes)
+}
+
+// rank returns the effective class of a payload that has waited for waited: its class,
+// raised by one for every aging interval. Ranks may become negative, so a payload that
+// has waited long enough is processed before newer payloads of every class.
+func (p *PriorityClasses) rank(class int, waited time.Duration) int {
+	if p == nil || p.aging <= 0 {
+		return class
+	}
+	return class - int(waited/p.aging)
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPriorityClasses_Class(t *testing.T) {
+	t.Parallel()
+
+	p := NewPriorityClasses("severity", defaultPriorityClasses, 0)
+	tests := []struct {
+		name    string
+		payload *AlertmanagerPayload
+		want    string
+	}{
+		{
+			name:    "common label",
+			payload: &AlertmanagerPayload{CommonLabels: map[string]string{"severity": "critical"}},
+			want:    "critical",
+		},
+		{
+			name:    "group label",
+			payload: &AlertmanagerPayload{GroupLabels: map[string]string{"severity": "info"}},
+			want:    "info",
+		},
+		{
+			name: "most severe alert",
+			payload: &AlertmanagerPayload{Alerts: []Alert{
+				{Labels: map[string]string{"severity": "info"}},
+				{Labels: map[string]string{"severity": "warning"}},
+				{Labels: map[string]string{}},
+			}},
+			want: "warning",
+		},
+		{
+			name:    "unlisted value",
+			payload: &AlertmanagerPayload{CommonLabels: map[string]string{"severity": "page"}},
+			want:    otherPriorityClass,
+		},
+		{name: "no label", payload: &AlertmanagerPayload{}, want: otherPriorityClass},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			if got := p.name(p.class(tt.payload)); got != tt.want {
+				t.Fatalf("expected class %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestAlertQueue_Priority(t *testing.T) {
+	t.Parallel()
+
+	received := make(chan string, 4)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		received <- string(body)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	client := NewOpenClawClient(server.URL, "token", "model")
+	priority := NewPriorityClasses("severity", defaultPriorityClasses, time.Hour)
+	// Not started: payloads accumulate until all have been enqueued.
+	queue := NewAlertQueue(client, WithPriorityClasses(priority))
+
+	for key, severity := range map[string]string{"Unlabelled": "", "Info": "info", "Warning": "warning"} {
+		labels := map[string]string{"alertname": key}
+		if severity != "" {
+			labels["severity"] = severity
+		}
+		queue.Enqueue(&AlertmanagerPayload{GroupKey: key, CommonLabels: labels})
+	}
+	queue.Enqueue(&AlertmanagerPayload{
+		GroupKey:     "Critical",
+		CommonLabels: map[string]string{"alertname": "Critical", "severity": "critical"},
+	})
+
+	stats := queue.Stats()
+	for i, want := range []int{1, 1, 1, 1} {
+		if stats.Classes[i].Depth != want {
+			t.Fatalf("expected one payload per class, got %+v", stats.Classes)
+		}
+	}
+
+	queue.Start()
+	defer queue.Stop()
+
+	for _, want := range []string{"Critical", "Warning", "Info", "Unlabelled"} {
+		select {
+		case body := <-received:
+			if !strings.Contains(body, want) {
+				t.Fatalf("expected payload %q next, got %s", want, body)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for alerts to be processed")
+		}
+	}
+}
+
+func TestAlertQueue_PriorityAging(t *testing.T) {
+	t.Parallel()
+
+	priority := NewPriorityClasses("severity", defaultPriorityClasses, time.Minute)
+	queue := NewAlertQueue(nil, WithPriorityClasses(priority))
+	defer queue.Stop()
+
+	now := time.Now()
+	push := func(key, severity string, waited time.Duration) {
+		payload := &AlertmanagerPayload{GroupKey: key, CommonLabels: map[string]string{"severity": severity}}
+		queue.push(0, payload, nil, now.Add(-waited))
+	}
+	// Info has waited three aging intervals and outranks a new critical payload; the
+	// warning has aged to the critical class, and wins the tie with it by being older.
+	push("critical", "critical", 0)
+	push("warning", "warning", 90*time.Second)
+	push("info", "info", 3*time.Minute)
+
+	for _, want := range []string{"info", "warning", "critical"} {
+		item, ok := queue.next()
+		if !ok || item.payload.GroupKey != want {
+			t.Fatalf("expected %q next, got %+v", want, item)
+		}
+	}
+}
+
+func TestConfig_ValidatePriority(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		cfg     config
+		wantErr bool
+	}{
+		{name: "defaults", cfg: config{PriorityClasses: defaultPriorityClasses, PriorityAging: defaultPriorityAging}},
+		{name: "no classes", cfg: config{}},
+		{name: "empty class", cfg: config{PriorityClasses: []string{"critical", ""}}, wantErr: true},
+		{name: "reserved class", cfg: config{PriorityClasses: []string{otherPriorityClass}}, wantErr: true},
+		{name: "duplicate class", cfg: config{PriorityClasses: []string{"p1", "p2", "p1"}}, wantErr: true},
+		{name: "negative aging", cfg: config{PriorityAging: -time.Second}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			if err := tt.cfg.validatePriority(); (err != nil) != tt.wantErr {
+				t.Fatalf("expected error=%v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
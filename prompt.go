@@ -0,0 +1,231 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// Built-in prompt template names, used for firing and resolved payloads unless a route selects another.
+const (
+	firingTemplateName   = "firing"
+	resolvedTemplateName = "resolved"
+)
+
+// promptTemplateExt is the file extension of prompt templates in the template directory.
+const promptTemplateExt = ".tmpl"
+
+// defaultFiringTemplate asks OpenClaw to investigate the payload.
+const defaultFiringTemplate = "You received the following {{ .SourceName }} webhook payload:\n\n" +
+	"```json\n{{ json . }}\n```\n\n" +
+	"Investigate the alert(s) above. Try to identify the root cause and resolve the issue if possible.\n" +
+	"If you cannot resolve it, provide a detailed diagnosis and suggest remediation steps.\n" +
+	"Report your findings and the current status (resolved, in-progress, or needs-manual-intervention)."
+
+// defaultResolvedTemplate tells OpenClaw that a previously reported alert group has cleared.
+const defaultResolvedTemplate = "The alert group you were asked to investigate has resolved. " +
+	"{{ .SourceName }} sent:\n\n" +
+	"```json\n{{ json . }}\n```\n\n" +
+	"The alert is no longer firing. Stop any investigation or remediation still in progress for it.\n" +
+	"Write a short closing summary: the likely root cause, what was done, and whether any follow-up is needed."
+
+// defaultPromptTemplates holds only the built-in templates.
+var defaultPromptTemplates = mustDefaultPromptTemplates()
+
+// PromptTemplates is a set of named text/template prompt templates rendered with an
+// *AlertmanagerPayload as data.
+type PromptTemplates struct {
+	root *template.Template
+}
+
+// templateFuncs returns the helper functions available to prompt templates.
+func templateFuncs() template.FuncMap {
+	return template.FuncMap{
+		"label":      lookupLabel,
+		"annotation": lookupAnnotation,
+		"formatTime": formatTime,
+		"truncate":   truncate,
+		"json":       toJSON,
+		"join":       strings.Join,
+		"upper":      strings.ToUpper,
+		"lower":      strings.ToLower,
+		"default":    defaultValue,
+	}
+}
+
+// mustDefaultPromptTemplates parses the built-in templates and panics if they are invalid.
+func mustDefaultPromptTemplates() *PromptTemplates {
+	root := template.New("").Funcs(templateFuncs())
+	template.Must(root.New(firingTemplateName).Parse(defaultFiringTemplate))
+	template.Must(root.New(resolvedTemplateName).Parse(defaultResolvedTemplate))
+	return &PromptTemplates{root: root}
+}
+
+// LoadPromptTemplates returns the built-in templates plus every *.tmpl file in dir,
+// named after the file without its extension. Files named firing.tmpl or resolved.tmpl
+// replace the built-in templates. Every template is rendered against a sample payload
+// so that errors surface at startup rather than when an alert arrives.
+func LoadPromptTemplates(dir string) (*PromptTemplates, error) {
+	t := mustDefaultPromptTemplates()
+	if dir == "" {
+		return t, nil
+	}
+
+	paths, err := filepath.Glob(filepath.Join(dir, "*"+promptTemplateExt))
+	if err != nil {
+		return nil, fmt.Errorf("list prompt templates: %w", err)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		content, err := os.ReadFile(path) //nolint:gosec // G304: path comes from server config.
+		if err != nil {
+			return nil, fmt.Errorf("read prompt template: %w", err)
+		}
+		name := strings.TrimSuffix(filepath.Base(path), promptTemplateExt)
+		if _, err := t.root.New(name).Parse(string(content)); err != nil {
+			return nil, fmt.Errorf("parse prompt template %s: %w", path, err)
+		}
+	}
+
+	if err := t.validate(); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// validate renders every template against a sample payload.
+func (t *PromptTemplates) validate() error {
+	sample := samplePayload()
+	for _, name := range t.Names() {
+		if _, err := t.Render(name, sample); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Names returns the names of all templates in the set, sorted.
+func (t *PromptTemplates) Names() []string {
+	var names []string
+	for _, tmpl := range t.root.Templates() {
+		if tmpl.Name() != "" {
+			names = append(names, tmpl.Name())
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Has reports whether the set contains a template with the given name.
+func (t *PromptTemplates) Has(name string) bool {
+	return t.root.Lookup(name) != nil
+}
+
+// Render executes the named template with the payload as data.
+func (t *PromptTemplates) Render(name string, payload *AlertmanagerPayload) (string, error) {
+	var buf bytes.Buffer
+	if err := t.root.ExecuteTemplate(&buf, name, payload); err != nil {
+		return "", fmt.Errorf("render prompt template %q: %w", name, err)
+	}
+	return buf.String(), nil
+}
+
+// samplePayload returns a representative payload used to validate templates.
+func samplePayload() *AlertmanagerPayload {
+	labels := map[string]string{"alertname": "SampleAlert", "severity": "warning", "instance": "server1"}
+	annotations := map[string]string{"summary": "Sample alert", "description": "Sample description"}
+	return &AlertmanagerPayload{
+		Version:  "4",
+		GroupKey: `{}:{alertname="SampleAlert"}`,
+		Status:   "firing",
+		Receiver: "alertstoopenclaw",
+		Alerts: []Alert{{
+			Status:      "firing",
+			Labels:      labels,
+			Annotations: annotations,
+			StartsAt:    "2026-01-01T00:00:00Z",
+			EndsAt:      "0001-01-01T00:00:00Z",
+			Fingerprint: "0000000000000000",
+		}},
+		GroupLabels:       map[string]string{"alertname": "SampleAlert"},
+		CommonLabels:      labels,
+		CommonAnnotations: annotations,
+		ExternalURL:       "http://grafana:3000",
+	}
+}
+
+// lookupLabel returns a label of a payload (common labels, then group labels) or of a single alert.
+func lookupLabel(name string, v any) string {
+	switch x := v.(type) {
+	case *AlertmanagerPayload:
+		if value, ok := x.CommonLabels[name]; ok {
+			return value
+		}
+		return x.GroupLabels[name]
+	case Alert:
+		return x.Labels[name]
+	case map[string]string:
+		return x[name]
+	default:
+		return ""
+	}
+}
+
+// lookupAnnotation returns a common annotation of a payload or an annotation of a single alert.
+func lookupAnnotation(name string, v any) string {
+	switch x := v.(type) {
+	case *AlertmanagerPayload:
+		return x.CommonAnnotations[name]
+	case Alert:
+		return x.Annotations[name]
+	case map[string]string:
+		return x[name]
+	default:
+		return ""
+	}
+}
+
+// formatTime reformats an RFC 3339 timestamp with a Go time layout, returning the
+// input unchanged if it cannot be parsed.
+func formatTime(layout, value string) string {
+	ts, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return value
+	}
+	return ts.Format(layout)
+}
+
+// truncate shortens s to at most n runes, marking the cut with an ellipsis.
+func truncate(n int, s string) string {
+	runes := []rune(s)
+	if n < 0 || len(runes) <= n {
+		return s
+	}
+	if n == 0 {
+		return ""
+	}
+	return string(runes[:n-1]) + "…"
+}
+
+// toJSON renders v as indented JSON.
+func toJSON(v any) (string, error) {
+	raw, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("marshal json: %w", err)
+	}
+	return string(raw), nil
+}
+
+// defaultValue returns value, or def if value is empty.
+func defaultValue(def, value string) string {
+	if value == "" {
+		return def
+	}
+	return value
+}
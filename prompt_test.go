@@ -0,0 +1,156 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDefaultPromptTemplate_MatchesLegacyText(t *testing.T) {
+	t.Parallel()
+
+	payload := samplePayload()
+	raw, err := json.MarshalIndent(payload, "", "  ")
+	if err != nil {
+		t.Fatalf("marshal payload: %v", err)
+	}
+	want := "You received the following Prometheus Alertmanager webhook payload:\n\n" +
+		"```json\n" + string(raw) + "\n```\n\n" +
+		"Investigate the alert(s) above. Try to identify the root cause and resolve the issue if possible.\n" +
+		"If you cannot resolve it, provide a detailed diagnosis and suggest remediation steps.\n" +
+		"Report your findings and the current status (resolved, in-progress, or needs-manual-intervention)."
+
+	got, err := defaultPromptTemplates.Render(firingTemplateName, payload)
+	if err != nil {
+		t.Fatalf("render: %v", err)
+	}
+	if got != want {
+		t.Fatalf("default prompt changed:\n got: %q\nwant: %q", got, want)
+	}
+}
+
+func TestDefaultPromptTemplates_NameTheSource(t *testing.T) {
+	t.Parallel()
+
+	grafana := samplePayload()
+	grafana.Title = "[FIRING:1] SampleAlert"
+	tests := []struct {
+		payload *AlertmanagerPayload
+		want    string
+	}{
+		{payload: samplePayload(), want: "Prometheus Alertmanager"},
+		{payload: grafana, want: "Grafana Alertmanager"},
+		{payload: &AlertmanagerPayload{Origin: payloadSourceDatadog}, want: "Datadog"},
+		{payload: &AlertmanagerPayload{Origin: "generic/uptime-kuma"}, want: "uptime-kuma"},
+	}
+
+	for _, tt := range tests {
+		firing, err := defaultPromptTemplates.Render(firingTemplateName, tt.payload)
+		if err != nil {
+			t.Fatalf("render firing: %v", err)
+		}
+		if !strings.HasPrefix(firing, "You received the following "+tt.want+" webhook payload:") {
+			t.Errorf("expected the firing prompt to name %s, got %q", tt.want, firing)
+		}
+		resolved, err := defaultPromptTemplates.Render(resolvedTemplateName, tt.payload)
+		if err != nil {
+			t.Fatalf("render resolved: %v", err)
+		}
+		if !strings.Contains(resolved, tt.want+" sent:") {
+			t.Errorf("expected the resolved prompt to name %s, got %q", tt.want, resolved)
+		}
+	}
+}
+
+func TestLoadPromptTemplates(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	writeTemplate(t, dir, "firing.tmpl", `Custom: {{ label "alertname" . }}`)
+	writeTemplate(t, dir, "database.tmpl",
+		`DB {{ label "severity" . | upper }} since {{ (index .Alerts 0).StartsAt | formatTime "2006-01-02" }}: `+
+			`{{ annotation "description" . | truncate 6 }} {{ label "team" . | default "unowned" }}`)
+	writeTemplate(t, dir, "ignored.txt", `{{ broken`)
+
+	templates, err := LoadPromptTemplates(dir)
+	if err != nil {
+		t.Fatalf("load templates: %v", err)
+	}
+
+	got, err := templates.Render(firingTemplateName, samplePayload())
+	if err != nil {
+		t.Fatalf("render firing: %v", err)
+	}
+	if got != "Custom: SampleAlert" {
+		t.Fatalf("expected firing template to be overridden, got %q", got)
+	}
+
+	got, err = templates.Render("database", samplePayload())
+	if err != nil {
+		t.Fatalf("render database: %v", err)
+	}
+	if want := "DB WARNING since 2026-01-01: Sampl… unowned"; got != want {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+
+	if !templates.Has(resolvedTemplateName) {
+		t.Fatal("expected built-in resolved template to remain available")
+	}
+}
+
+func TestLoadPromptTemplates_Invalid(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		content string
+		wantErr string
+	}{
+		{name: "parse error", content: `{{ if }}`, wantErr: "parse prompt template"},
+		{name: "unknown field", content: `{{ .NoSuchField }}`, wantErr: "render prompt template"},
+		{name: "unknown function", content: `{{ nosuchfunc . }}`, wantErr: "parse prompt template"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			dir := t.TempDir()
+			writeTemplate(t, dir, "broken.tmpl", tt.content)
+
+			_, err := LoadPromptTemplates(dir)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		n    int
+		in   string
+		want string
+	}{
+		{n: 10, in: "short", want: "short"},
+		{n: 5, in: "exact", want: "exact"},
+		{n: 4, in: "longer", want: "lon…"},
+		{n: 0, in: "gone", want: ""},
+	}
+	for _, tt := range tests {
+		if got := truncate(tt.n, tt.in); got != tt.want {
+			t.Errorf("truncate(%d, %q) = %q, want %q", tt.n, tt.in, got, tt.want)
+		}
+	}
+}
+
+func writeTemplate(t *testing.T, dir, name, content string) {
+	t.Helper()
+	if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o600); err != nil {
+		t.Fatalf("write template: %v", err)
+	}
+}
@@ -2,67 +2,629 @@ package main
 
 import (
 	"context"
+	"errors"
 	"log/slog"
+	"slices"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
-// AlertQueue processes alert payloads sequentially via a single consumer goroutine.
+// defaultQueueCapacity is the number of payloads the queue buffers before rejecting new ones.
+const defaultQueueCapacity = 100
+
+// queueItem is a payload waiting in the queue together with its journal ID. A replayed
+// dead letter is limited to the routes it failed on and has no key, since it never
+// coalesces with other payloads.
+type queueItem struct {
+	id         uint64
+	key        string
+	serial     string
+	class      int
+	payload    *AlertmanagerPayload
+	routes     []string
+	merged     int
+	enqueuedAt time.Time
+}
+
+// QueueStats is a point-in-time snapshot of the queue.
+type QueueStats struct {
+	Depth       int
+	Capacity    int
+	Merged      uint64
+	InFlight    int
+	Workers     int
+	Classes     []ClassDepth
+	DeadLetters int
+}
+
+// ClassDepth is the number of queued payloads in a priority class.
+type ClassDepth struct {
+	Class string
+	Depth int
+}
+
+// AlertQueue processes alert payloads with a pool of worker goroutines, delivering each
+// to the routes its router selects. Payloads of higher priority classes are processed
+// first. Payloads of the same group are processed in order, one at a time. A payload for
+// a group that is still waiting in the queue replaces the queued one.
 type AlertQueue struct {
-	ch       chan *AlertmanagerPayload
-	client   *OpenClawClient
+	mu       sync.Mutex
+	cond     *sync.Cond
+	items    []*queueItem
+	active   map[string]bool
+	capacity int
+	workers  int
+	serialBy string
+	closed   bool
+	merged   uint64
+	router   atomic.Pointer[Router]
+	journal  *Journal
+	dedup    *Deduplicator
+	store    *InvestigationStore
+	dead     *DeadLetterStore
+	tokens   *TokenSet
+	priority *PriorityClasses
 	wg       sync.WaitGroup
 	ctx      context.Context
 	cancel   context.CancelFunc
 	stopOnce sync.Once
 }
 
-// NewAlertQueue creates a buffered queue with capacity 100.
-func NewAlertQueue(client *OpenClawClient) *AlertQueue {
+// QueueOption configures optional AlertQueue behaviour.
+type QueueOption func(*AlertQueue)
+
+// WithCapacity sets the number of queued payloads after which Enqueue rejects new groups.
+func WithCapacity(n int) QueueOption {
+	return func(q *AlertQueue) {
+		q.capacity = n
+	}
+}
+
+// WithRouter delivers payloads to the routes selected by r instead of the queue's client.
+func WithRouter(r *Router) QueueOption {
+	return func(q *AlertQueue) {
+		q.router.Store(r)
+	}
+}
+
+// WithJournal persists queued payloads to j and replays its unacknowledged entries.
+func WithJournal(j *Journal) QueueOption {
+	return func(q *AlertQueue) {
+		q.journal = j
+	}
+}
+
+// WithDeduplicator skips payloads that d reports as already forwarded.
+func WithDeduplicator(d *Deduplicator) QueueOption {
+	return func(q *AlertQueue) {
+		q.dedup = d
+	}
+}
+
+// WithInvestigationStore records the outcome of every forward in s.
+func WithInvestigationStore(s *InvestigationStore) QueueOption {
+	return func(q *AlertQueue) {
+		q.store = s
+	}
+}
+
+// WithDeadLetters keeps payloads that failed on any route in s. If s is persistent, the
+// payload is then acknowledged in the journal; otherwise it also stays in the journal
+// and is replayed on the next start.
+func WithDeadLetters(s *DeadLetterStore) QueueOption {
+	return func(q *AlertQueue) {
+		q.dead = s
+	}
+}
+
+// WithCallerPolicy skips routes that the route policy in tokens forbids for a
+// payload's caller.
+func WithCallerPolicy(tokens *TokenSet) QueueOption {
+	return func(q *AlertQueue) {
+		q.tokens = tokens
+	}
+}
+
+// WithWorkers processes up to n payloads concurrently. Payloads with the same
+// serialization key are still processed one at a time, in the order they were queued.
+func WithWorkers(n int) QueueOption {
+	return func(q *AlertQueue) {
+		q.workers = n
+	}
+}
+
+// WithSerializationLabel serializes payloads by the value of label instead of by group.
+// Payloads without the label are serialized by group.
+func WithSerializationLabel(label string) QueueOption {
+	return func(q *AlertQueue) {
+		q.serialBy = label
+	}
+}
+
+// WithPriorityClasses processes payloads in the order of the priority classes p instead
+// of first in, first out.
+func WithPriorityClasses(p *PriorityClasses) QueueOption {
+	return func(q *AlertQueue) {
+		q.priority = p
+	}
+}
+
+// NewAlertQueue creates a queue with capacity 100 and a single worker that forwards every
+// payload to client, which may be nil if WithRouter is given. When a journal is configured, its pending
+// entries are loaded ahead of new payloads, even if they exceed the capacity.
+func NewAlertQueue(client *OpenClawClient, opts ...QueueOption) *AlertQueue {
 	ctx, cancel := context.WithCancel(context.Background())
-	return &AlertQueue{
-		ch:     make(chan *AlertmanagerPayload, 100),
-		client: client,
-		ctx:    ctx,
-		cancel: cancel,
+	q := &AlertQueue{
+		active:   make(map[string]bool),
+		capacity: defaultQueueCapacity,
+		workers:  1,
+		ctx:      ctx,
+		cancel:   cancel,
 	}
+	q.cond = sync.NewCond(&q.mu)
+	for _, opt := range opts {
+		opt(q)
+	}
+	if q.router.Load() == nil {
+		q.router.Store(newSingleRouter(client))
+	}
+
+	if q.journal != nil {
+		pending := q.journal.Pending()
+		for _, e := range pending {
+			if superseded, merged := q.push(e.ID, e.Payload, e.Routes, e.EnqueuedAt); merged {
+				q.ack(superseded, e.Payload.CommonLabels["alertname"])
+			}
+		}
+		if len(pending) > 0 {
+			slog.Info("replaying journaled alerts", "count", len(pending), "queued", len(q.items))
+		}
+	}
+	return q
 }
 
-// Start launches the consumer goroutine.
+// Start launches the worker goroutines.
 func (q *AlertQueue) Start() {
-	q.wg.Add(1)
-	go func() {
-		defer q.wg.Done()
-		for payload := range q.ch {
-			alertname := payload.CommonLabels["alertname"]
-			slog.Info("processing alert", "alertname", alertname, "status", payload.Status, "alert_count", len(payload.Alerts))
-
-			if err := q.client.Forward(q.ctx, payload); err != nil {
-				slog.Error("failed to forward alert to openclaw", "alertname", alertname, "error", err)
-			} else {
-				slog.Info("alert forwarded to openclaw", "alertname", alertname)
+	for worker := range q.workers {
+		q.wg.Add(1)
+		go func() {
+			defer q.wg.Done()
+			for {
+				item, ok := q.next()
+				if !ok {
+					break
+				}
+				q.process(item)
+				q.done(item)
 			}
+			slog.Info("alert queue worker stopped", "worker", worker)
+		}()
+	}
+}
+
+// next blocks until a payload can be processed and removes the most urgent one from the
+// queue, marking its serialization key as in flight. Returns false once the queue is
+// stopped and empty.
+func (q *AlertQueue) next() (*queueItem, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for {
+		if i := q.pick(); i >= 0 {
+			item := q.items[i]
+			q.items = slices.Delete(q.items, i, i+1)
+			q.active[item.serial] = true
+			return item, true
+		}
+		if q.closed && len(q.items) == 0 {
+			return nil, false
+		}
+		q.cond.Wait()
+	}
+}
+
+// done releases the serialization key of a processed item, so that the next payload
+// with that key can be picked.
+func (q *AlertQueue) done(item *queueItem) {
+	q.mu.Lock()
+	delete(q.active, item.serial)
+	q.mu.Unlock()
+	q.cond.Broadcast()
+}
+
+// pick returns the index of the item with the highest effective priority, taking aging
+// into account, or -1 if no item can be processed. Only the oldest queued item of each
+// serialization key is eligible, and only while no item with that key is in flight.
+// Among equal ranks, the item that has waited longest wins. The caller must hold q.mu.
+func (q *AlertQueue) pick() int {
+	now := time.Now()
+	best, bestRank := -1, 0
+	seen := make(map[string]bool)
+	for i, item := range q.items {
+		blocked := q.active[item.serial] || seen[item.serial]
+		seen[item.serial] = true
+		if blocked {
+			continue
+		}
+		rank := q.priority.rank(item.class, now.Sub(item.enqueuedAt))
+		if best < 0 || rank < bestRank || (rank == bestRank && item.enqueuedAt.Before(q.items[best].enqueuedAt)) {
+			best, bestRank = i, rank
 		}
-		slog.Info("alert queue consumer stopped")
-	}()
+	}
+	return best
+}
+
+// serialKey returns the key of payloads that must be processed in order and never
+// concurrently: the value of the serialization label if the payload has it, and its
+// group otherwise.
+func (q *AlertQueue) serialKey(payload *AlertmanagerPayload) string {
+	if q.serialBy != "" {
+		if v := lookupLabel(q.serialBy, payload); v != "" {
+			return q.serialBy + "\x00" + v
+		}
+	}
+	return groupKey(payload)
 }
 
-// Enqueue adds a payload to the queue. Returns false if the queue is full.
+// process forwards a single payload and acknowledges it in the journal on success.
+// Payloads the deduplicator has already seen are acknowledged without forwarding, and
+// payloads that failed on any route are moved to the dead letters.
+func (q *AlertQueue) process(item *queueItem) {
+	payload := item.payload
+	alertname := payload.CommonLabels["alertname"]
+	class := q.priority.name(item.class)
+	metrics.queueWait.Observe(time.Since(item.enqueuedAt).Seconds(), class)
+
+	if q.dedup != nil && q.dedup.Duplicate(payload) {
+		slog.Info("skipping duplicate alert", "alertname", alertname, "group_key", payload.GroupKey)
+		metrics.deduplicated.Inc()
+		q.ack(item.id, alertname)
+		return
+	}
+
+	slog.Info("processing alert", "alertname", alertname, "status", payload.Status, "source", payload.Source(),
+		"caller", payload.Caller, "priority", class, "alert_count", len(payload.Alerts), "merged_updates", item.merged)
+
+	if failures := q.forward(item); len(failures) > 0 {
+		q.deadLetter(item, failures)
+		return
+	}
+
+	if q.dedup != nil {
+		q.dedup.Record(payload)
+	}
+	q.ack(item.id, alertname)
+}
+
+// forward delivers a payload to every route that matches it and records each attempt.
+// Drop routes consume the payload without forwarding it, and a replayed dead letter
+// skips the routes it did not fail on. It returns the routes that failed.
+func (q *AlertQueue) forward(item *queueItem) []RouteFailure {
+	payload := item.payload
+	alertname := payload.CommonLabels["alertname"]
+
+	var failures []RouteFailure
+	for _, route := range q.router.Load().Match(payload) {
+		if len(item.routes) > 0 && !slices.Contains(item.routes, route.Name) {
+			continue
+		}
+		if route.Drop {
+			slog.Info("alert dropped by route", "alertname", alertname, "route", route.Name)
+			continue
+		}
+		if !q.tokens.AllowsRoute(payload.Caller, route.Name) {
+			slog.Warn("route not allowed for caller", "alertname", alertname, "route", route.Name,
+				"caller", payload.Caller)
+			metrics.forbidden.Inc(payload.Caller, route.Name)
+			continue
+		}
+		inv, result, err := q.investigate(route, item)
+		if err != nil {
+			slog.Error("failed to forward alert to openclaw", "alertname", alertname, "route", route.Name, "error", err)
+			metrics.forwards.Inc(route.Name, investigationFailed)
+			failures = append(failures, newRouteFailure(route.Name, result, err))
+			continue
+		}
+		metrics.forwards.Inc(route.Name, investigationSucceeded)
+		if inv.Status == investigationPending {
+			metrics.asyncInvestigations.Inc("submitted")
+			slog.Info("alert submitted to openclaw", "alertname", alertname, "route", route.Name, "id", inv.ID)
+			continue
+		}
+		slog.Info("alert forwarded to openclaw", "alertname", alertname, "route", route.Name)
+	}
+	return failures
+}
+
+// investigate forwards a payload to a route and records the investigation under an ID
+// drawn beforehand. In async mode a pending record is saved before the request, since
+// OpenClaw may call back before the request returns.
+func (q *AlertQueue) investigate(route *Route, item *queueItem) (*Investigation, *ForwardResult, error) {
+	id := newID()
+	ctx := WithInvestigationID(WithStreamProgress(q.ctx, q.progress(id, route.Name, item)), id)
+	if !route.client.Async() {
+		result, err := route.client.Forward(ctx, item.payload)
+		inv := newInvestigation(id, route.Name, item, result, err)
+		q.record(inv)
+		return inv, result, err
+	}
+
+	q.record(newPendingInvestigation(id, route.Name, item))
+	result, err := route.client.Forward(ctx, item.payload)
+	inv := newInvestigation(id, route.Name, item, result, err)
+	q.recordSubmit(inv)
+	return inv, result, err
+}
+
+// recordSubmit merges the outcome of submitting an async investigation into the record
+// saved before the request, or saves it if that record is gone.
+func (q *AlertQueue) recordSubmit(inv *Investigation) {
+	if q.store == nil {
+		return
+	}
+	_, err := q.store.Update(inv.ID, mergeSubmit(inv))
+	if errors.Is(err, errInvestigationNotFound) {
+		err = q.store.Save(inv)
+	}
+	if err != nil {
+		slog.Error("failed to save investigation", "id", inv.ID, "error", err)
+	}
+}
+
+// progress returns the function that republishes a streamed answer while it arrives,
+// as the running investigation with the given ID.
+func (q *AlertQueue) progress(id, route string, item *queueItem) func(StreamProgress) {
+	startedAt := time.Now().UTC()
+	return func(p StreamProgress) {
+		q.record(&Investigation{
+			ID:         id,
+			Route:      route,
+			Status:     investigationRunning,
+			EnqueuedAt: item.enqueuedAt,
+			StartedAt:  startedAt,
+			Backend:    p.Backend,
+			Model:      p.Model,
+			Attempts:   p.Attempt,
+			Payload:    item.payload,
+			Response:   p.Response,
+		})
+		slog.Info("openclaw answer in progress", "id", id, "route", route, "backend", p.Backend,
+			"attempt", p.Attempt, "chunks", p.Chunks)
+	}
+}
+
+// deadLetter moves a payload that failed on some route to the dead letters and, if they
+// are persistent, acknowledges it in the journal. Payloads interrupted by shutdown, or
+// refused by a full dead-letter store, are left in the journal for replay on the next start.
+func (q *AlertQueue) deadLetter(item *queueItem, failures []RouteFailure) {
+	alertname := item.payload.CommonLabels["alertname"]
+	if q.dead == nil || q.ctx.Err() != nil {
+		return
+	}
+
+	d := &DeadLetter{
+		ID:         newID(),
+		FailedAt:   time.Now().UTC(),
+		EnqueuedAt: item.enqueuedAt,
+		Payload:    item.payload,
+		Failures:   failures,
+	}
+	if err := q.dead.Add(d); err != nil {
+		slog.Error("failed to save dead letter", "alertname", alertname, "id", d.ID, "error", err)
+		return
+	}
+	metrics.deadLetters.Inc("added")
+	slog.Warn("alert moved to dead letters", "alertname", alertname, "id", d.ID, "failed_routes", len(failures))
+	if q.dead.Persistent() {
+		q.ack(item.id, alertname)
+	}
+}
+
+// SetRouter replaces the routing tree and returns the previous one. Payloads already
+// queued are delivered with the new routes; a payload that is being forwarded finishes
+// with the previous ones.
+func (q *AlertQueue) SetRouter(r *Router) *Router {
+	return q.router.Swap(r)
+}
+
+// Router returns the current routing tree.
+func (q *AlertQueue) Router() *Router {
+	return q.router.Load()
+}
+
+// record saves an investigation if the queue has a store.
+func (q *AlertQueue) record(inv *Investigation) {
+	if q.store == nil {
+		return
+	}
+	if err := q.store.Save(inv); err != nil {
+		slog.Error("failed to save investigation", "id", inv.ID, "error", err)
+	}
+}
+
+// ack removes a processed or superseded payload from the journal.
+func (q *AlertQueue) ack(id uint64, alertname string) {
+	if q.journal == nil {
+		return
+	}
+	if err := q.journal.Ack(id); err != nil {
+		slog.Error("failed to acknowledge alert in journal", "alertname", alertname, "error", err)
+	}
+}
+
+// Enqueue adds a payload to the queue, replacing a queued payload of the same group.
+// Returns false if the queue is full, stopped, or the payload could not be journaled.
+// The payload is journaled before the queue is locked, so that disk latency never holds
+// up other webhooks or the workers; if the queue rejects it after all, the journal entry
+// is acknowledged again.
 func (q *AlertQueue) Enqueue(payload *AlertmanagerPayload) bool {
-	select {
-	case q.ch <- payload:
-		return true
-	default:
-		slog.Warn("alert queue full, dropping alert", "alertname", payload.CommonLabels["alertname"])
+	return q.enqueue(payload, nil)
+}
+
+// Replay adds the payload of a dead letter to the queue, to be forwarded only to the
+// given routes, those it failed on. Unlike Enqueue, it never replaces a queued payload
+// and is never replaced, so a stale dead letter can't displace a newer update of its
+// group. It is still processed in order with the other payloads of its group.
+func (q *AlertQueue) Replay(payload *AlertmanagerPayload, routes []string) bool {
+	return q.enqueue(payload, routes)
+}
+
+// enqueue journals and queues a payload, limited to routes if any are given.
+func (q *AlertQueue) enqueue(payload *AlertmanagerPayload, routes []string) bool {
+	alertname := payload.CommonLabels["alertname"]
+	key := itemKey(payload, routes)
+
+	q.mu.Lock()
+	admitted := q.admits(key, alertname)
+	q.mu.Unlock()
+	if !admitted {
 		return false
 	}
+
+	var id uint64
+	if q.journal != nil {
+		var err error
+		if id, err = q.journal.Append(payload, routes...); err != nil {
+			slog.Error("failed to write alert to journal", "alertname", alertname, "error", err)
+			return false
+		}
+	}
+
+	q.mu.Lock()
+	admitted = q.admits(key, alertname)
+	superseded, merged := uint64(0), false
+	if admitted {
+		superseded, merged = q.push(id, payload, routes, time.Now().UTC())
+	}
+	q.mu.Unlock()
+
+	switch {
+	case !admitted:
+		q.ack(id, alertname)
+	case merged:
+		q.ack(superseded, alertname)
+	}
+	return admitted
+}
+
+// admits reports whether the queue accepts a payload with the given key: it must not be
+// stopped, and a payload that does not merge into a queued one needs a free slot.
+// The caller must hold q.mu.
+func (q *AlertQueue) admits(key, alertname string) bool {
+	if q.closed {
+		slog.Warn("alert queue stopped, dropping alert", "alertname", alertname)
+		return false
+	}
+	if q.find(key) == nil && len(q.items) >= q.capacity {
+		slog.Warn("alert queue full, dropping alert", "alertname", alertname)
+		return false
+	}
+	return true
+}
+
+// push appends a payload or merges it into a queued item of the same group. A merged
+// item takes the priority class of the new payload but keeps its enqueue time. If the
+// payload was merged, push returns the journal ID of the payload it replaced, which the
+// caller acknowledges once it no longer holds q.mu. A payload limited to routes is
+// always appended.
+// The caller must hold q.mu or have exclusive access.
+func (q *AlertQueue) push(
+	id uint64, payload *AlertmanagerPayload, routes []string, enqueuedAt time.Time,
+) (uint64, bool) {
+	key := itemKey(payload, routes)
+	serial := q.serialKey(payload)
+	class := q.priority.class(payload)
+	existing := q.find(key)
+	if existing == nil {
+		q.items = append(q.items, &queueItem{
+			id: id, key: key, serial: serial, class: class, payload: payload, routes: routes, enqueuedAt: enqueuedAt,
+		})
+		q.cond.Broadcast()
+		return 0, false
+	}
+
+	supersededID := existing.id
+	existing.id = id
+	existing.serial = serial
+	existing.class = class
+	existing.payload = payload
+	existing.merged++
+	q.merged++
+
+	slog.Info("merged alert update into queued payload", "alertname", payload.CommonLabels["alertname"],
+		"group_key", payload.GroupKey, "merged_updates", existing.merged)
+	return supersededID, true
+}
+
+// queueKey identifies the group a queued payload coalesces with. Payloads from
+// different callers never coalesce, since they may be subject to different route policies.
+func queueKey(payload *AlertmanagerPayload) string {
+	if payload.Caller == "" {
+		return groupKey(payload)
+	}
+	return payload.Caller + "\x00" + groupKey(payload)
+}
+
+// itemKey returns the queue key of a payload, or "" for one limited to routes, which
+// never coalesces.
+func itemKey(payload *AlertmanagerPayload, routes []string) string {
+	if len(routes) > 0 {
+		return ""
+	}
+	return queueKey(payload)
+}
+
+// find returns the queued item for a group key, or nil if the group is not queued or
+// the key is empty.
+func (q *AlertQueue) find(key string) *queueItem {
+	if key == "" {
+		return nil
+	}
+	for _, item := range q.items {
+		if item.key == key {
+			return item
+		}
+	}
+	return nil
+}
+
+// Stats returns the current queue depth, in total and per priority class from highest
+// to lowest, the number of payloads being processed, the capacity, the number of workers
+// and the total number of merged updates.
+func (q *AlertQueue) Stats() QueueStats {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	names := q.priority.Names()
+	classes := make([]ClassDepth, len(names))
+	for i, name := range names {
+		classes[i].Class = name
+	}
+	for _, item := range q.items {
+		classes[item.class].Depth++
+	}
+	return QueueStats{
+		Depth:       len(q.items),
+		Capacity:    q.capacity,
+		Merged:      q.merged,
+		InFlight:    len(q.active),
+		Workers:     q.workers,
+		Classes:     classes,
+		DeadLetters: q.dead.Len(),
+	}
 }
 
-// Stop cancels in-flight operations, closes the channel, and waits for the consumer to drain.
+// Stop cancels in-flight operations, stops accepting payloads, and waits for the workers to drain.
+// Journaled payloads that were not forwarded are replayed on the next start.
 func (q *AlertQueue) Stop() {
 	q.stopOnce.Do(func() {
 		q.cancel()
-		slog.Info("draining alert queue", "remaining", len(q.ch))
-		close(q.ch)
+		q.mu.Lock()
+		q.closed = true
+		slog.Info("draining alert queue", "remaining", len(q.items))
+		q.cond.Broadcast()
+		q.mu.Unlock()
 	})
 	q.wg.Wait()
 }
@@ -1,8 +1,13 @@
 package main
 
 import (
+	"encoding/json"
+	"io"
 	"net/http"
 	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 )
@@ -58,3 +63,344 @@ func TestAlertQueue_Enqueue(t *testing.T) {
 		t.Fatal("timed out waiting for alert to be processed")
 	}
 }
+
+func TestAlertQueue_JournalReplay(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "queue.journal")
+	journal, err := OpenJournal(path)
+	if err != nil {
+		t.Fatalf("open journal: %v", err)
+	}
+	if _, err := journal.Append(&AlertmanagerPayload{
+		Status:       "firing",
+		CommonLabels: map[string]string{"alertname": "Replayed"},
+	}); err != nil {
+		t.Fatalf("append: %v", err)
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	client := NewOpenClawClient(server.URL, "token", "model")
+	queue := NewAlertQueue(client, WithJournal(journal))
+	queue.Start()
+	defer queue.Stop()
+
+	// The replayed alert is acknowledged once forwarded.
+	deadline := time.Now().Add(5 * time.Second)
+	for len(journal.Pending()) != 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for replayed alert to be acknowledged")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestAlertQueue_JournalsOutsideQueueLock(t *testing.T) {
+	t.Parallel()
+
+	journal, err := OpenJournal(filepath.Join(t.TempDir(), "queue.journal"))
+	if err != nil {
+		t.Fatalf("open journal: %v", err)
+	}
+	defer func() { _ = journal.Close() }()
+	queue := NewAlertQueue(NewOpenClawClient("http://localhost", "token", "model"), WithJournal(journal))
+
+	// Hold the journal as a slow disk would.
+	journal.mu.Lock()
+	enqueued := make(chan bool)
+	go func() {
+		enqueued <- queue.Enqueue(&AlertmanagerPayload{Status: "firing", GroupKey: "slow"})
+	}()
+
+	stats := make(chan QueueStats)
+	go func() { stats <- queue.Stats() }()
+	select {
+	case <-stats:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the queue to stay available while the journal is busy")
+	}
+
+	// The queue stops while the payload is journaled, so it is rejected and acknowledged again.
+	queue.Stop()
+	journal.mu.Unlock()
+	if <-enqueued {
+		t.Fatal("expected a payload enqueued after stop to be rejected")
+	}
+	if pending := journal.Pending(); len(pending) != 0 {
+		t.Fatalf("expected the rejected payload to be acknowledged, got %d pending", len(pending))
+	}
+}
+
+func TestAlertQueue_Deduplication(t *testing.T) {
+	t.Parallel()
+
+	var count atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		count.Add(1)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	client := NewOpenClawClient(server.URL, "token", "model")
+	queue := NewAlertQueue(client, WithDeduplicator(NewDeduplicator(time.Hour)))
+	defer queue.Stop()
+
+	// Processed synchronously so the queue cannot coalesce the payloads first.
+	// The repeat is skipped; the third payload adds a fingerprint and is forwarded.
+	queue.process(&queueItem{payload: dedupPayload("a")})
+	queue.process(&queueItem{payload: dedupPayload("a")})
+	queue.process(&queueItem{payload: dedupPayload("a", "b")})
+
+	if got := count.Load(); got != 2 {
+		t.Fatalf("expected 2 forwarded payloads, got %d", got)
+	}
+}
+
+func TestAlertQueue_CoalescesSameGroup(t *testing.T) {
+	t.Parallel()
+
+	received := make(chan string, 3)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		received <- string(body)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	client := NewOpenClawClient(server.URL, "token", "model")
+	// Not started: payloads accumulate until all updates have been enqueued.
+	queue := NewAlertQueue(client)
+
+	queue.Enqueue(&AlertmanagerPayload{GroupKey: "a", CommonLabels: map[string]string{"alertname": "First"}})
+	queue.Enqueue(&AlertmanagerPayload{GroupKey: "b", CommonLabels: map[string]string{"alertname": "Other"}})
+	queue.Enqueue(&AlertmanagerPayload{GroupKey: "a", CommonLabels: map[string]string{"alertname": "Latest"}})
+
+	stats := queue.Stats()
+	if stats.Depth != 2 || stats.Merged != 1 {
+		t.Fatalf("expected depth 2 with 1 merge, got %+v", stats)
+	}
+
+	queue.Start()
+	defer queue.Stop()
+
+	// The merged update keeps the position of the first payload for its group.
+	for _, want := range []string{"Latest", "Other"} {
+		select {
+		case body := <-received:
+			if !strings.Contains(body, want) {
+				t.Fatalf("expected payload %q next, got %s", want, body)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for alerts to be processed")
+		}
+	}
+}
+
+func TestAlertQueue_Routing(t *testing.T) {
+	t.Parallel()
+
+	models := make(chan string, 2)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req chatRequest
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		models <- req.Model
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	cfg := RouteConfig{Routes: []RouteConfig{
+		{Name: "info", Matchers: []string{"severity=info"}, Drop: true},
+		{Name: "db", Matchers: []string{"team=db"}, Model: "openclaw:db"},
+	}}
+	router, err := NewRouter(cfg, server.URL, "token", "openclaw:main", defaultPromptTemplates)
+	if err != nil {
+		t.Fatalf("NewRouter: %v", err)
+	}
+	queue := NewAlertQueue(nil, WithRouter(router))
+	defer queue.Stop()
+
+	queue.process(&queueItem{payload: &AlertmanagerPayload{
+		Status:       "firing",
+		CommonLabels: map[string]string{"alertname": "Noise", "severity": "info"},
+	}})
+	queue.process(&queueItem{payload: &AlertmanagerPayload{
+		Status:       "firing",
+		CommonLabels: map[string]string{"alertname": "SlowQueries", "team": "db"},
+	}})
+
+	if len(models) != 1 {
+		t.Fatalf("expected exactly 1 forwarded payload, got %d", len(models))
+	}
+	if got := <-models; got != "openclaw:db" {
+		t.Fatalf("expected db route model, got %q", got)
+	}
+}
+
+func TestAlertQueue_RecordsInvestigations(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte(`{"choices":[{"message":{"role":"assistant","content":"done"},"finish_reason":"stop"}]}`))
+	}))
+	defer server.Close()
+
+	store, err := NewInvestigationStore("", 10)
+	if err != nil {
+		t.Fatalf("open store: %v", err)
+	}
+	client := NewOpenClawClient(server.URL, "token", "model")
+	queue := NewAlertQueue(client, WithInvestigationStore(store))
+	defer queue.Stop()
+
+	payload := &AlertmanagerPayload{Status: "firing", CommonLabels: map[string]string{"alertname": "Test"}}
+	queue.process(&queueItem{payload: payload, enqueuedAt: time.Now()})
+
+	list := store.List()
+	if len(list) != 1 {
+		t.Fatalf("expected 1 investigation, got %d", len(list))
+	}
+	inv := list[0]
+	if inv.Status != investigationSucceeded || inv.Route != "root" || inv.Payload != payload {
+		t.Fatalf("unexpected investigation: %+v", inv)
+	}
+	if inv.Response == nil || inv.Response.Choices[0].Message.Content != "done" {
+		t.Fatalf("expected response to be captured, got %+v", inv.Response)
+	}
+}
+
+func TestAlertQueue_WorkersSerializeGroups(t *testing.T) {
+	t.Parallel()
+
+	started := make(chan string, 3)
+	release := map[string]chan struct{}{"First": make(chan struct{}), "Other": make(chan struct{})}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		for name, ch := range release {
+			if strings.Contains(string(body), name) {
+				started <- name
+				<-ch
+			}
+		}
+		if strings.Contains(string(body), "Second") {
+			started <- "Second"
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+	defer close(release["Other"])
+
+	client := NewOpenClawClient(server.URL, "token", "model")
+	queue := NewAlertQueue(client, WithWorkers(2))
+	defer queue.Stop()
+
+	queue.Enqueue(&AlertmanagerPayload{GroupKey: "a", CommonLabels: map[string]string{"alertname": "First"}})
+	queue.Enqueue(&AlertmanagerPayload{GroupKey: "b", CommonLabels: map[string]string{"alertname": "Other"}})
+	queue.Start()
+
+	// Both groups are forwarded concurrently.
+	got := map[string]bool{}
+	for range 2 {
+		select {
+		case name := <-started:
+			got[name] = true
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out waiting for concurrent forwards, got %v", got)
+		}
+	}
+	if stats := queue.Stats(); stats.InFlight != 2 || stats.Workers != 2 {
+		t.Fatalf("expected 2 payloads in flight on 2 workers, got %+v", stats)
+	}
+
+	// An update for the group in flight waits for it, although a worker frees up.
+	queue.Enqueue(&AlertmanagerPayload{GroupKey: "a", CommonLabels: map[string]string{"alertname": "Second"}})
+	select {
+	case name := <-started:
+		t.Fatalf("expected the update to wait for its group, got %q", name)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	close(release["First"])
+	select {
+	case name := <-started:
+		if name != "Second" {
+			t.Fatalf("expected the update next, got %q", name)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the update")
+	}
+}
+
+func TestAlertQueue_SerialKey(t *testing.T) {
+	t.Parallel()
+
+	byGroup := NewAlertQueue(nil)
+	byService := NewAlertQueue(nil, WithSerializationLabel("service"))
+	defer byGroup.Stop()
+	defer byService.Stop()
+
+	db1 := &AlertmanagerPayload{GroupKey: "1", CommonLabels: map[string]string{"service": "db"}}
+	db2 := &AlertmanagerPayload{GroupKey: "2", GroupLabels: map[string]string{"service": "db"}}
+	unlabelled := &AlertmanagerPayload{GroupKey: "3"}
+
+	if byGroup.serialKey(db1) == byGroup.serialKey(db2) {
+		t.Fatal("expected different groups to be independent by default")
+	}
+	if byService.serialKey(db1) != byService.serialKey(db2) {
+		t.Fatal("expected groups of the same service to be serialized")
+	}
+	if byService.serialKey(unlabelled) != groupKey(unlabelled) {
+		t.Fatalf("expected a payload without the label to be serialized by group, got %q", byService.serialKey(unlabelled))
+	}
+}
+
+func TestAlertQueue_RepublishesStreamProgress(t *testing.T) {
+	t.Parallel()
+
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		_, _ = io.WriteString(w, "data: {\"choices\":[{\"index\":0,\"delta\":{\"content\":\"Checking disks\"}}]}\n\n")
+		w.(http.Flusher).Flush()
+		<-release
+		_, _ = io.WriteString(w, "data: {\"choices\":[{\"index\":0,\"delta\":{\"content\":\": full\"}}]}\n\ndata: [DONE]\n\n")
+	}))
+	defer server.Close()
+
+	store, err := NewInvestigationStore("", 10)
+	if err != nil {
+		t.Fatalf("open store: %v", err)
+	}
+	client := NewOpenClawClient(server.URL, "token", "model", WithStreaming(5*time.Second))
+	queue := NewAlertQueue(client, WithInvestigationStore(store))
+	defer queue.Stop()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		queue.process(&queueItem{payload: &AlertmanagerPayload{Status: "firing"}, enqueuedAt: time.Now()})
+	}()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for len(store.List()) == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	list := store.List()
+	if len(list) != 1 || list[0].Status != investigationRunning ||
+		newInvestigationView(list[0]).ResponseText != "Checking disks" {
+		t.Fatalf("expected a running investigation with the partial answer, got %+v", list)
+	}
+	close(release)
+	<-done
+
+	inv, _ := store.Get(list[0].ID)
+	if inv.Status != investigationSucceeded || newInvestigationView(inv).ResponseText != "Checking disks: full" {
+		t.Fatalf("expected the running investigation to complete, got %+v", inv)
+	}
+	if n := len(store.List()); n != 1 {
+		t.Fatalf("expected 1 investigation, got %d", n)
+	}
+}
@@ -0,0 +1,264 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// configReloader rebuilds the prompt templates and routing tree when the configuration
+// changes and swaps the new router into the queue. Payloads already queued are kept and
+// are delivered with the new routes; a payload being forwarded finishes with the old ones.
+type configReloader struct {
+	queue    *AlertQueue
+	breakers *CircuitBreakers
+	backends *Backends
+
+	mu      sync.Mutex
+	current *config
+	stamp   string
+}
+
+// newConfigReloader creates a reloader for the running configuration cfg. Rebuilt routes
+// keep using the circuit breakers in breakers and the backend states in backends, either
+// of which may be nil.
+func newConfigReloader(
+	cfg *config, queue *AlertQueue, breakers *CircuitBreakers, backends *Backends,
+) *configReloader {
+	return &configReloader{
+		queue: queue, breakers: breakers, backends: backends, current: cfg, stamp: filesStamp(watchedFiles(cfg)),
+	}
+}
+
+// Reload reads the configuration again and, if it is valid, swaps in the new routes and
+// templates. On error the running configuration is left unchanged. Settings that only
+// take effect at startup are logged if they changed.
+func (r *configReloader) Reload() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	cfg, err := loadConfig(r.current.ConfigFile)
+	if err != nil {
+		return err
+	}
+	restart := restartRequired(r.current, cfg)
+	if err := r.keepAsyncMode(cfg); err != nil {
+		return err
+	}
+	templates, err := LoadPromptTemplates(cfg.TemplateDir)
+	if err != nil {
+		return err
+	}
+	router, err := buildRouter(cfg, templates, r.breakers, r.backends, r.queue.Router())
+	if err != nil {
+		return err
+	}
+	if err := r.queue.tokens.CheckRoutes(router); err != nil {
+		return err
+	}
+
+	for _, setting := range restart {
+		slog.Warn("configuration change requires a restart", "setting", setting)
+	}
+	r.current = r.current.withReloaded(cfg)
+	r.stamp = filesStamp(watchedFiles(r.current))
+
+	previous := r.queue.SetRouter(router)
+	r.backends.Install(router.Pools()...)
+	if previous != nil && previous.transport != router.transport {
+		previous.closeIdleConnections()
+	}
+	slog.Info("configuration reloaded", "templates", templates.Names())
+	return nil
+}
+
+// keepAsyncMode sets cfg to the running async mode, callback token and timeout: the
+// callback route and the watcher for pending investigations only start with the process.
+// It fails if the rest of cfg does not fit that mode.
+func (r *configReloader) keepAsyncMode(cfg *config) error {
+	cfg.OpenClawAsync = r.current.OpenClawAsync
+	cfg.OpenClawCallbackToken = r.current.OpenClawCallbackToken
+	cfg.OpenClawAsyncTimeout = r.current.OpenClawAsyncTimeout
+	if err := cfg.validateAsync(); err != nil {
+		return err
+	}
+	return cfg.validateStream()
+}
+
+// withReloaded returns a copy of c with the settings that take effect on reload taken
+// from cfg.
+func (c *config) withReloaded(cfg *config) *config {
+	next := *c
+	next.OpenClawURL = cfg.OpenClawURL
+	next.OpenClawToken = cfg.OpenClawToken
+	next.OpenClawModel = cfg.OpenClawModel
+	next.OpenClawCAFile = cfg.OpenClawCAFile
+	next.OpenClawCertFile = cfg.OpenClawCertFile
+	next.OpenClawKeyFile = cfg.OpenClawKeyFile
+	next.OpenClawServerName = cfg.OpenClawServerName
+	next.OpenClawProxyURL = cfg.OpenClawProxyURL
+	next.OpenClawMaxIdleConns = cfg.OpenClawMaxIdleConns
+	next.OpenClawMaxIdlePerHost = cfg.OpenClawMaxIdlePerHost
+	next.OpenClawMaxConnsPerHost = cfg.OpenClawMaxConnsPerHost
+	next.OpenClawIdleConnTimeout = cfg.OpenClawIdleConnTimeout
+	next.OpenClawBackends = cfg.OpenClawBackends
+	next.OpenClawBalance = cfg.OpenClawBalance
+	next.OpenClawRetryAttempts = cfg.OpenClawRetryAttempts
+	next.OpenClawRetryBaseDelay = cfg.OpenClawRetryBaseDelay
+	next.OpenClawRetryMaxDelay = cfg.OpenClawRetryMaxDelay
+	next.OpenClawCallbackURL = cfg.OpenClawCallbackURL
+	next.OpenClawStream = cfg.OpenClawStream
+	next.OpenClawStreamIdle = cfg.OpenClawStreamIdle
+	next.TemplateDir = cfg.TemplateDir
+	next.RoutesFile = cfg.RoutesFile
+	next.Routes = cfg.Routes
+	return &next
+}
+
+// Run reloads on SIGHUP and, if interval is positive, whenever the configuration file,
+// routes file, a prompt template or an OpenClaw client certificate file changes. It returns when ctx is done.
+func (r *configReloader) Run(ctx context.Context, interval time.Duration) {
+	watch(ctx, interval, r.changed, r.reload)
+}
+
+// watch calls reload on SIGHUP and, if interval is positive, whenever changed reports a
+// change when polled. It returns when ctx is done.
+func watch(ctx context.Context, interval time.Duration, changed func() bool, reload func(trigger string)) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	var tick <-chan time.Time
+	if interval > 0 {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+			reload("signal")
+		case <-tick:
+			if changed() {
+				reload("file change")
+			}
+		}
+	}
+}
+
+// reload calls Reload and logs the outcome.
+func (r *configReloader) reload(trigger string) {
+	slog.Info("reloading configuration", "trigger", trigger)
+	if err := r.Reload(); err != nil {
+		slog.Error("configuration reload failed, keeping previous configuration", "error", err)
+	}
+}
+
+// changed reports whether any watched file changed since the last check or reload.
+// A failed reload is not retried until the files change again.
+func (r *configReloader) changed() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stamp := filesStamp(watchedFiles(r.current))
+	if stamp == r.stamp {
+		return false
+	}
+	r.stamp = stamp
+	return true
+}
+
+// watchedFiles returns the files whose changes trigger a reload.
+func watchedFiles(cfg *config) []string {
+	var paths []string
+	if cfg.ConfigFile != "" {
+		paths = append(paths, cfg.ConfigFile)
+	}
+	if cfg.RoutesFile != "" {
+		paths = append(paths, cfg.RoutesFile)
+	}
+	paths = append(paths, cfg.transport().files()...)
+	if cfg.TemplateDir != "" {
+		templates, _ := filepath.Glob(filepath.Join(cfg.TemplateDir, "*"+promptTemplateExt))
+		paths = append(paths, templates...)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// filesStamp summarizes the size and modification time of files, so that a change to
+// any of them, or a file being added or removed, changes the stamp.
+func filesStamp(paths []string) string {
+	var b strings.Builder
+	for _, path := range paths {
+		b.WriteString(path)
+		if info, err := os.Stat(path); err == nil {
+			_, _ = fmt.Fprintf(&b, ":%d:%d", info.Size(), info.ModTime().UnixNano())
+		}
+		b.WriteByte('\n')
+	}
+	return b.String()
+}
+
+// restartRequired returns the settings that differ between old and new but are only
+// read at startup.
+func restartRequired(old, next *config) []string {
+	settings := []struct {
+		name    string
+		changed bool
+	}{
+		{"listen_addr", old.ListenAddr != next.ListenAddr},
+		{"webhook_token", old.WebhookToken != next.WebhookToken},
+		{"webhook_tokens", !reflect.DeepEqual(old.WebhookTokens, next.WebhookTokens)},
+		{"webhook_tokens_file", old.WebhookTokensFile != next.WebhookTokensFile},
+		{"webhook_hmac_secrets", !slices.Equal(old.WebhookHMACSecrets, next.WebhookHMACSecrets)},
+		{"webhook_signature_header", old.SignatureHeader != next.SignatureHeader},
+		{"webhook_timestamp_header", old.TimestampHeader != next.TimestampHeader},
+		{"webhook_max_skew", old.MaxSkew != next.MaxSkew},
+		{"admin_token", old.AdminToken != next.AdminToken},
+		{"tls", !reflect.DeepEqual(old.listenerTLS(), next.listenerTLS())},
+		{"queue_journal_path", old.JournalPath != next.JournalPath},
+		{"queue_workers", old.QueueWorkers != next.QueueWorkers},
+		{"queue_serialize_label", old.QueueSerializeLabel != next.QueueSerializeLabel},
+		{"investigations_path", old.InvestigationsPath != next.InvestigationsPath},
+		{"investigations_retention", old.InvestigationsRetention != next.InvestigationsRetention},
+		{"dead_letter_path", old.DeadLetterPath != next.DeadLetterPath},
+		{"dead_letter_retention", old.DeadLetterRetention != next.DeadLetterRetention},
+		{"dedup_ttl", old.DedupTTL != next.DedupTTL},
+		{"priority_label", old.PriorityLabel != next.PriorityLabel},
+		{"priority_classes", !slices.Equal(old.PriorityClasses, next.PriorityClasses)},
+		{"priority_aging", old.PriorityAging != next.PriorityAging},
+		{"forward_resolved", old.ForwardResolved != next.ForwardResolved},
+		{"openclaw_health_interval", old.OpenClawHealthInterval != next.OpenClawHealthInterval},
+		{"openclaw_health_path", old.OpenClawHealthPath != next.OpenClawHealthPath},
+		{"openclaw_eject_threshold", old.OpenClawEjectThreshold != next.OpenClawEjectThreshold},
+		{"openclaw_eject_duration", old.OpenClawEjectDuration != next.OpenClawEjectDuration},
+		{"openclaw_circuit_threshold", old.OpenClawCircuitThreshold != next.OpenClawCircuitThreshold},
+		{"openclaw_circuit_cooldown", old.OpenClawCircuitCooldown != next.OpenClawCircuitCooldown},
+		{"openclaw_async", old.OpenClawAsync != next.OpenClawAsync},
+		{"openclaw_callback_token", old.OpenClawCallbackToken != next.OpenClawCallbackToken},
+		{"openclaw_async_timeout", old.OpenClawAsyncTimeout != next.OpenClawAsyncTimeout},
+		{"config_watch_interval", old.WatchInterval != next.WatchInterval},
+		{"generic_sources", !reflect.DeepEqual(old.GenericSources, next.GenericSources)},
+	}
+	var changed []string
+	for _, s := range settings {
+		if s.changed {
+			changed = append(changed, s.name)
+		}
+	}
+	return changed
+}
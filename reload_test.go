@@ -0,0 +1,209 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestConfigReloader_Reload(t *testing.T) {
+	t.Parallel()
+
+	models := make(chan string, 4)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req chatRequest
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		models <- req.Model
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	path := writeConfig(t, `{"openclaw_url": "`+server.URL+`", "openclaw_token": "t", "openclaw_model": "before"}`)
+	cfg, err := loadConfig(path)
+	if err != nil {
+		t.Fatalf("loadConfig: %v", err)
+	}
+	router, err := buildRouter(cfg, defaultPromptTemplates, nil, nil, nil)
+	if err != nil {
+		t.Fatalf("buildRouter: %v", err)
+	}
+	queue := NewAlertQueue(nil, WithRouter(router))
+	defer queue.Stop()
+	reloader := newConfigReloader(cfg, queue, nil, nil)
+
+	// A payload queued before the reload is delivered with the new routes.
+	payload := &AlertmanagerPayload{Status: "firing", CommonLabels: map[string]string{"alertname": "Test"}}
+	if !queue.Enqueue(payload) {
+		t.Fatal("expected enqueue to succeed")
+	}
+
+	rewrite := func(content string) {
+		t.Helper()
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatalf("write config: %v", err)
+		}
+		// Make the change visible even on filesystems with coarse timestamps.
+		later := time.Now().Add(time.Minute)
+		if err := os.Chtimes(path, later, later); err != nil {
+			t.Fatalf("chtimes: %v", err)
+		}
+	}
+
+	rewrite(`{"openclaw_url": "` + server.URL + `", "openclaw_token": "t",
+		"openclaw_model": "after", "listen_addr": ":1"}`)
+	if !reloader.changed() {
+		t.Fatal("expected config file change to be detected")
+	}
+	if reloader.changed() {
+		t.Fatal("expected no change on second check")
+	}
+	if err := reloader.Reload(); err != nil {
+		t.Fatalf("Reload: %v", err)
+	}
+
+	queue.Start()
+	select {
+	case got := <-models:
+		if got != "after" {
+			t.Fatalf("expected reloaded model, got %q", got)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for queued alert")
+	}
+	if reloader.current.ListenAddr != cfg.ListenAddr {
+		t.Fatalf("expected listen address to require a restart, got %q", reloader.current.ListenAddr)
+	}
+
+	// An invalid configuration keeps the previous routes.
+	rewrite(`{"openclaw_url": "` + server.URL + `", "openclaw_token": "t", "openclaw_modle": "broken"}`)
+	if err := reloader.Reload(); err == nil {
+		t.Fatal("expected reload of invalid configuration to fail")
+	}
+	if !queue.Enqueue(payload) {
+		t.Fatal("expected enqueue to succeed")
+	}
+	select {
+	case got := <-models:
+		if got != "after" {
+			t.Fatalf("expected previous model to be kept, got %q", got)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for queued alert")
+	}
+}
+
+func TestConfigReloader_KeepsAsyncMode(t *testing.T) {
+	t.Parallel()
+
+	path := writeConfig(t, `{"openclaw_url": "http://openclaw", "openclaw_token": "t"}`)
+	cfg, err := loadConfig(path)
+	if err != nil {
+		t.Fatalf("loadConfig: %v", err)
+	}
+	router, err := buildRouter(cfg, defaultPromptTemplates, nil, nil, nil)
+	if err != nil {
+		t.Fatalf("buildRouter: %v", err)
+	}
+	queue := NewAlertQueue(nil, WithRouter(router))
+	defer queue.Stop()
+	reloader := newConfigReloader(cfg, queue, nil, nil)
+
+	// The callback route was not registered at startup, so async mode stays off.
+	if err := os.WriteFile(path, []byte(`{"openclaw_url": "http://openclaw", "openclaw_token": "t",
+		"openclaw_async": true, "openclaw_callback_url": "http://bridge", "openclaw_callback_token": "c",
+		"openclaw_async_timeout": "1h"}`), 0o600); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+	if err := reloader.Reload(); err != nil {
+		t.Fatalf("Reload: %v", err)
+	}
+	if reloader.current.OpenClawAsync {
+		t.Fatal("expected async mode to require a restart")
+	}
+	if got := queue.Router().root.client.callbackURL; got != "" {
+		t.Fatalf("expected reloaded routes to stay synchronous, got callback URL %q", got)
+	}
+
+	// Running in async mode, a configuration without a callback URL is rejected.
+	reloader.current.OpenClawAsync = true
+	reloader.current.OpenClawCallbackToken = "c"
+	reloader.current.OpenClawAsyncTimeout = time.Hour
+	if err := os.WriteFile(path, []byte(`{"openclaw_url": "http://openclaw", "openclaw_token": "t"}`), 0o600); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+	if err := reloader.Reload(); err == nil {
+		t.Fatal("expected reload without a callback URL to fail in async mode")
+	}
+}
+
+func TestConfigReloader_RejectedReloadKeepsBackends(t *testing.T) {
+	t.Parallel()
+
+	path := writeConfig(t, `{"openclaw_backends": [{"name": "primary", "url": "http://primary"}], "openclaw_token": "t"}`)
+	cfg, err := loadConfig(path)
+	if err != nil {
+		t.Fatalf("loadConfig: %v", err)
+	}
+	backends := NewBackends(0, 0, defaultHealthPath)
+	router, err := buildRouter(cfg, defaultPromptTemplates, nil, backends, nil)
+	if err != nil {
+		t.Fatalf("buildRouter: %v", err)
+	}
+	backends.Install(router.Pools()...)
+	queue := NewAlertQueue(nil, WithRouter(router))
+	defer queue.Stop()
+	reloader := newConfigReloader(cfg, queue, nil, backends)
+
+	// The new backends are valid, but the routes are not, so the reload is rejected after
+	// the pool was built.
+	if err := os.WriteFile(path, []byte(`{"openclaw_backends": [{"name": "standby", "url": "http://standby"}],
+		"openclaw_token": "t", "routes": {"routes": [{"name": "db", "template": "missing"}]}}`), 0o600); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+	if err := reloader.Reload(); err == nil {
+		t.Fatal("expected reload of invalid routes to fail")
+	}
+	if states := backends.States(); len(states) != 1 || states[0].Name != "primary" {
+		t.Fatalf("expected the running backends to stay registered, got %+v", states)
+	}
+}
+
+func TestConfigReloader_ReusesTransport(t *testing.T) {
+	t.Parallel()
+
+	path := writeConfig(t, `{"openclaw_url": "http://openclaw", "openclaw_token": "t", "openclaw_model": "before"}`)
+	cfg, err := loadConfig(path)
+	if err != nil {
+		t.Fatalf("loadConfig: %v", err)
+	}
+	router, err := buildRouter(cfg, defaultPromptTemplates, nil, nil, nil)
+	if err != nil {
+		t.Fatalf("buildRouter: %v", err)
+	}
+	queue := NewAlertQueue(nil, WithRouter(router))
+	defer queue.Stop()
+	reloader := newConfigReloader(cfg, queue, nil, nil)
+
+	reload := func(content string) *Router {
+		t.Helper()
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatalf("write config: %v", err)
+		}
+		if err := reloader.Reload(); err != nil {
+			t.Fatalf("Reload: %v", err)
+		}
+		return queue.Router()
+	}
+
+	next := reload(`{"openclaw_url": "http://openclaw", "openclaw_token": "t", "openclaw_model": "after"}`)
+	if next == router || next.transport != router.transport {
+		t.Fatal("expected a new router sharing the unchanged transport")
+	}
+	changed := reload(`{"openclaw_url": "http://openclaw", "openclaw_token": "t", "openclaw_max_idle_conns": 5}`)
+	if changed.transport == next.transport || changed.transport.MaxIdleConns != 5 {
+		t.Fatal("expected a new transport for changed connection settings")
+	}
+}
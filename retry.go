@@ -0,0 +1,180 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Retry defaults: three attempts, with full-jitter backoff starting at one second and
+// waits, including those requested by Retry-After, capped at 30 seconds.
+const (
+	defaultRetryAttempts  = 3
+	defaultRetryBaseDelay = time.Second
+	defaultRetryMaxDelay  = 30 * time.Second
+)
+
+// errorKind classifies a failed OpenClaw request.
+type errorKind int
+
+// Error kinds. Transport errors, timeouts, rate limiting and server errors are retried;
+// client and authentication errors are permanent.
+const (
+	errorTransport errorKind = iota
+	errorTimeout
+	errorRateLimited
+	errorServer
+	errorClient
+	errorAuth
+)
+
+// String returns the kind name used in logs, metrics and attempt logs.
+func (k errorKind) String() string {
+	switch k {
+	case errorTimeout:
+		return "timeout"
+	case errorRateLimited:
+		return "rate_limited"
+	case errorServer:
+		return "server_error"
+	case errorClient:
+		return "client_error"
+	case errorAuth:
+		return "auth_error"
+	default:
+		return "transport"
+	}
+}
+
+// retryable reports whether a request that failed with this kind may succeed if sent again.
+func (k errorKind) retryable() bool {
+	return k != errorClient && k != errorAuth
+}
+
+// requestError is returned for an OpenClaw request that failed, either without a response
+// or with a non-2xx one. For a response it holds the status code, the start of the body
+// and the delay requested by a Retry-After header.
+type requestError struct {
+	kind       errorKind
+	status     int
+	body       string
+	retryAfter time.Duration
+	err        error
+}
+
+// Error describes the failure.
+func (e *requestError) Error() string {
+	switch {
+	case e.status != 0:
+		return fmt.Sprintf("openclaw returned status %d", e.status)
+	case e.kind == errorTimeout:
+		return fmt.Sprintf("request timed out: %v", e.err)
+	default:
+		return fmt.Sprintf("request failed: %v", e.err)
+	}
+}
+
+// Unwrap returns the transport error, if any.
+func (e *requestError) Unwrap() error {
+	return e.err
+}
+
+// newTransportError classifies an error returned by http.Client.Do or while reading a
+// streamed answer.
+func newTransportError(err error) *requestError {
+	var netErr net.Error
+	timeout := errors.Is(err, context.DeadlineExceeded) || errors.Is(err, errStreamIdle)
+	if timeout || errors.As(err, &netErr) && netErr.Timeout() {
+		return &requestError{kind: errorTimeout, err: err}
+	}
+	return &requestError{kind: errorTransport, err: err}
+}
+
+// newStatusError classifies a non-2xx response. now is used to convert a Retry-After date
+// into a delay.
+func newStatusError(resp *http.Response, body string, now time.Time) *requestError {
+	e := &requestError{status: resp.StatusCode, body: body}
+	switch {
+	case resp.StatusCode == http.StatusTooManyRequests:
+		e.kind = errorRateLimited
+	case resp.StatusCode == http.StatusRequestTimeout || resp.StatusCode == http.StatusGatewayTimeout:
+		e.kind = errorTimeout
+	case resp.StatusCode >= http.StatusInternalServerError:
+		e.kind = errorServer
+	case resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden:
+		e.kind = errorAuth
+	default:
+		e.kind = errorClient
+	}
+	if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusServiceUnavailable {
+		e.retryAfter = parseRetryAfter(resp.Header.Get("Retry-After"), now)
+	}
+	return e
+}
+
+// parseRetryAfter parses a Retry-After value given in seconds or as an HTTP date. It
+// returns zero if the value is missing, invalid or in the past.
+func parseRetryAfter(v string, now time.Time) time.Duration {
+	if v == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(v); err == nil {
+		return max(time.Duration(secs)*time.Second, 0)
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		return max(t.Sub(now), 0)
+	}
+	return 0
+}
+
+// errorKindOf returns the kind of a request error. Errors not produced by doRequest count
+// as transport errors.
+func errorKindOf(err error) errorKind {
+	var reqErr *requestError
+	if errors.As(err, &reqErr) {
+		return reqErr.kind
+	}
+	return errorTransport
+}
+
+// RetryPolicy controls how often and how long Forward retries a failed request.
+type RetryPolicy struct {
+	// Attempts is the maximum number of requests per payload, including the first.
+	Attempts int
+	// BaseDelay is the upper bound of the wait before the first retry; it doubles for
+	// each further retry.
+	BaseDelay time.Duration
+	// MaxDelay caps the wait before a retry, including one requested by Retry-After.
+	MaxDelay time.Duration
+}
+
+// defaultRetryPolicy is used by clients created without WithRetryPolicy.
+var defaultRetryPolicy = RetryPolicy{
+	Attempts:  defaultRetryAttempts,
+	BaseDelay: defaultRetryBaseDelay,
+	MaxDelay:  defaultRetryMaxDelay,
+}
+
+// delay returns the wait before the retry that follows failed failed requests. A
+// Retry-After delay on the last error is honoured up to MaxDelay; otherwise the wait is
+// drawn uniformly from zero to BaseDelay doubled for each earlier failure, capped at MaxDelay.
+func (p RetryPolicy) delay(failed int, lastErr error) time.Duration {
+	var reqErr *requestError
+	if errors.As(lastErr, &reqErr) && reqErr.retryAfter > 0 {
+		return min(reqErr.retryAfter, p.MaxDelay)
+	}
+	ceiling := p.BaseDelay
+	for i := 1; i < failed && ceiling < p.MaxDelay; i++ {
+		ceiling *= 2
+	}
+	ceiling = min(ceiling, p.MaxDelay)
+	if ceiling <= 0 {
+		return 0
+	}
+	return rand.N(ceiling + 1) //nolint:gosec // G404: jitter needs no cryptographic randomness.
+}
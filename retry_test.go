@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestNewStatusError_Kinds(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		status    int
+		kind      errorKind
+		retryable bool
+	}{
+		{http.StatusBadRequest, errorClient, false},
+		{http.StatusNotFound, errorClient, false},
+		{http.StatusUnauthorized, errorAuth, false},
+		{http.StatusForbidden, errorAuth, false},
+		{http.StatusRequestTimeout, errorTimeout, true},
+		{http.StatusTooManyRequests, errorRateLimited, true},
+		{http.StatusInternalServerError, errorServer, true},
+		{http.StatusServiceUnavailable, errorServer, true},
+		{http.StatusGatewayTimeout, errorTimeout, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(http.StatusText(tt.status), func(t *testing.T) {
+			t.Parallel()
+
+			err := newStatusError(&http.Response{StatusCode: tt.status}, "", time.Now())
+			if err.kind != tt.kind || err.kind.retryable() != tt.retryable {
+				t.Fatalf("expected %s (retryable=%v), got %s", tt.kind, tt.retryable, err.kind)
+			}
+		})
+	}
+}
+
+func TestNewTransportError_Timeout(t *testing.T) {
+	t.Parallel()
+
+	if got := newTransportError(context.DeadlineExceeded).kind; got != errorTimeout {
+		t.Fatalf("expected timeout, got %s", got)
+	}
+	err := newTransportError(errors.New("connection refused"))
+	if err.kind != errorTransport || !errors.Is(err, err.err) {
+		t.Fatalf("expected a transport error wrapping the cause, got %s", err.kind)
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		value string
+		want  time.Duration
+	}{
+		{"", 0},
+		{"120", 2 * time.Minute},
+		{"-5", 0},
+		{"soon", 0},
+		{"Thu, 01 Jan 2026 00:00:30 GMT", 30 * time.Second},
+		{"Wed, 31 Dec 2025 23:59:00 GMT", 0},
+	}
+
+	for _, tt := range tests {
+		if got := parseRetryAfter(tt.value, now); got != tt.want {
+			t.Errorf("parseRetryAfter(%q) = %s, want %s", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestRetryPolicy_Delay(t *testing.T) {
+	t.Parallel()
+
+	p := RetryPolicy{Attempts: 10, BaseDelay: 100 * time.Millisecond, MaxDelay: time.Second}
+	ceilings := map[int]time.Duration{1: 100 * time.Millisecond, 3: 400 * time.Millisecond, 8: time.Second}
+	for failed, ceiling := range ceilings {
+		for range 50 {
+			if d := p.delay(failed, errors.New("boom")); d < 0 || d > ceiling {
+				t.Fatalf("delay after %d failures = %s, want at most %s", failed, d, ceiling)
+			}
+		}
+	}
+
+	limited := &requestError{kind: errorRateLimited, status: http.StatusTooManyRequests}
+	limited.retryAfter = 500 * time.Millisecond
+	if d := p.delay(1, limited); d != 500*time.Millisecond {
+		t.Fatalf("expected Retry-After to be honoured, got %s", d)
+	}
+	limited.retryAfter = time.Hour
+	if d := p.delay(1, limited); d != time.Second {
+		t.Fatalf("expected Retry-After capped at the maximum delay, got %s", d)
+	}
+}
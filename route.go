@@ -0,0 +1,353 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// RouteConfig is one node of the routing tree as written in the routes file. Unset
+// destination fields are inherited from the parent route; the root inherits them from
+// the environment.
+type RouteConfig struct {
+	Name             string        `json:"name,omitempty"`
+	Matchers         []string      `json:"matchers,omitempty"`
+	Continue         bool          `json:"continue,omitempty"`
+	Drop             bool          `json:"drop,omitempty"`
+	URL              string        `json:"url,omitempty"`
+	Token            string        `json:"token,omitempty"`
+	Model            string        `json:"model,omitempty"`
+	Template         string        `json:"template,omitempty"`
+	ResolvedTemplate string        `json:"resolved_template,omitempty"`
+	Routes           []RouteConfig `json:"routes,omitempty"`
+}
+
+// Route is a compiled routing tree node with the OpenClaw client it forwards to.
+type Route struct {
+	Name     string
+	Drop     bool
+	matchers []*Matcher
+	cont     bool
+	client   *OpenClawClient
+	children []*Route
+}
+
+// Router selects the routes a payload is delivered to.
+type Router struct {
+	root         *Route
+	pools        []*BackendPool
+	transport    *http.Transport
+	transportKey string
+}
+
+// matchType is the comparison performed by a Matcher.
+type matchType string
+
+// Matcher operators, as in Alertmanager.
+const (
+	matchEqual     matchType = "="
+	matchNotEqual  matchType = "!="
+	matchRegexp    matchType = "=~"
+	matchNotRegexp matchType = "!~"
+)
+
+// Matcher tests one label against a value or a fully anchored regular expression.
+type Matcher struct {
+	Name  string
+	Type  matchType
+	Value string
+	re    *regexp.Regexp
+}
+
+// matcherPattern splits a matcher into label name, operator and value.
+var matcherPattern = regexp.MustCompile(`^\s*([a-zA-Z_][a-zA-Z0-9_]*)\s*(=~|!~|!=|=)\s*(.*?)\s*$`)
+
+// ParseMatcher parses a matcher such as team="db", severity!=info or instance=~"db-.*".
+func ParseMatcher(s string) (*Matcher, error) {
+	parts := matcherPattern.FindStringSubmatch(s)
+	if parts == nil {
+		return nil, fmt.Errorf("invalid matcher %q", s)
+	}
+	value := parts[3]
+	if strings.HasPrefix(value, `"`) {
+		unquoted, err := strconv.Unquote(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid matcher %q: bad quoted value", s)
+		}
+		value = unquoted
+	}
+
+	m := &Matcher{Name: parts[1], Type: matchType(parts[2]), Value: value}
+	if m.Type == matchRegexp || m.Type == matchNotRegexp {
+		re, err := regexp.Compile("^(?:" + value + ")$")
+		if err != nil {
+			return nil, fmt.Errorf("invalid matcher %q: %w", s, err)
+		}
+		m.re = re
+	}
+	return m, nil
+}
+
+// Matches reports whether the label set satisfies the matcher. A missing label matches as "".
+func (m *Matcher) Matches(labels map[string]string) bool {
+	v := labels[m.Name]
+	switch m.Type {
+	case matchEqual:
+		return v == m.Value
+	case matchNotEqual:
+		return v != m.Value
+	case matchRegexp:
+		return m.re.MatchString(v)
+	case matchNotRegexp:
+		return !m.re.MatchString(v)
+	}
+	return false
+}
+
+// String returns the matcher in its textual form.
+func (m *Matcher) String() string {
+	return m.Name + string(m.Type) + strconv.Quote(m.Value)
+}
+
+// LoadRouteConfig reads a routing tree from a JSON file, rejecting unknown fields.
+func LoadRouteConfig(path string) (RouteConfig, error) {
+	data, err := os.ReadFile(path) //nolint:gosec // G304: path comes from server config.
+	if err != nil {
+		return RouteConfig{}, fmt.Errorf("read routes file: %w", err)
+	}
+	var cfg RouteConfig
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&cfg); err != nil {
+		return RouteConfig{}, fmt.Errorf("parse routes file %s: %w", path, err)
+	}
+	return cfg, nil
+}
+
+// routeDefaults are the destination settings a route inherits from its parent. A route
+// without its own URL sends to the parent's backend pool, if any.
+type routeDefaults struct {
+	url, token, model, template, resolvedTemplate string
+	pool                                          *BackendPool
+}
+
+// NewRouter compiles a routing tree. The root route matches every payload and inherits
+// the given OpenClaw settings; every non-drop route must end up with a URL and token,
+// and its templates must exist in templates. Every route's client is created with opts.
+func NewRouter(
+	cfg RouteConfig, url, token, model string, templates *PromptTemplates, opts ...ClientOption,
+) (*Router, error) {
+	return newRouter(cfg, routeDefaults{url: url, token: token, model: model}, templates, opts)
+}
+
+// NewPoolRouter compiles a routing tree like NewRouter, except that routes without their
+// own URL send to the backends of pool. token and model apply to backends that set none.
+func NewPoolRouter(
+	cfg RouteConfig, pool *BackendPool, token, model string, templates *PromptTemplates, opts ...ClientOption,
+) (*Router, error) {
+	return newRouter(cfg, routeDefaults{pool: pool, token: token, model: model}, templates, opts)
+}
+
+// newRouter compiles a routing tree whose root inherits defaults and the built-in templates.
+// Route names must be unique.
+func newRouter(
+	cfg RouteConfig, defaults routeDefaults, templates *PromptTemplates, opts []ClientOption,
+) (*Router, error) {
+	if len(cfg.Matchers) > 0 {
+		return nil, errors.New("root route must not have matchers")
+	}
+	if cfg.Name == "" {
+		cfg.Name = "root"
+	}
+	defaults.template = firingTemplateName
+	defaults.resolvedTemplate = resolvedTemplateName
+	root, err := compileRoute(cfg, defaults, templates, opts)
+	if err != nil {
+		return nil, err
+	}
+	router := &Router{root: root}
+	if err := router.checkNames(); err != nil {
+		return nil, err
+	}
+	if defaults.pool != nil {
+		router.pools = []*BackendPool{defaults.pool}
+	}
+	return router, nil
+}
+
+// Pools returns the backend pools the router's routes send to.
+func (rt *Router) Pools() []*BackendPool {
+	return rt.pools
+}
+
+// Names returns the names of every route in the tree, parents before their children.
+func (rt *Router) Names() []string {
+	var names []string
+	var walk func(r *Route)
+	walk = func(r *Route) {
+		names = append(names, r.Name)
+		for _, child := range r.children {
+			walk(child)
+		}
+	}
+	walk(rt.root)
+	return names
+}
+
+// checkNames rejects a tree in which two routes have the same name, since caller route
+// policies, dead letters and metrics refer to routes by name.
+func (rt *Router) checkNames() error {
+	seen := make(map[string]bool)
+	for _, name := range rt.Names() {
+		if seen[name] {
+			return fmt.Errorf("duplicate route name %q", name)
+		}
+		seen[name] = true
+	}
+	return nil
+}
+
+// closeIdleConnections closes the idle connections of the router's transport, once the
+// router is replaced by one with a different transport. Requests still in flight finish,
+// and their connections close after the transport's idle timeout.
+func (rt *Router) closeIdleConnections() {
+	if rt.transport != nil {
+		rt.transport.CloseIdleConnections()
+	}
+}
+
+// newSingleRouter returns a router that delivers every payload to client.
+func newSingleRouter(client *OpenClawClient) *Router {
+	return &Router{root: &Route{Name: "root", client: client}}
+}
+
+// compileRoute validates a route and its children and builds their clients.
+func compileRoute(
+	cfg RouteConfig, parent routeDefaults, templates *PromptTemplates, opts []ClientOption,
+) (*Route, error) {
+	d := routeDefaults{
+		url:              firstNonEmpty(cfg.URL, parent.url),
+		token:            firstNonEmpty(cfg.Token, parent.token),
+		model:            firstNonEmpty(cfg.Model, parent.model),
+		template:         firstNonEmpty(cfg.Template, parent.template),
+		resolvedTemplate: firstNonEmpty(cfg.ResolvedTemplate, parent.resolvedTemplate),
+		pool:             parent.pool,
+	}
+	if cfg.URL != "" {
+		d.pool = nil
+	}
+	r := &Route{Name: cfg.Name, Drop: cfg.Drop, cont: cfg.Continue}
+
+	for _, s := range cfg.Matchers {
+		m, err := ParseMatcher(s)
+		if err != nil {
+			return nil, fmt.Errorf("route %q: %w", cfg.Name, err)
+		}
+		r.matchers = append(r.matchers, m)
+	}
+
+	if !r.Drop {
+		if err := validateRouteDefaults(cfg.Name, d, templates); err != nil {
+			return nil, err
+		}
+		clientOpts := []ClientOption{WithPromptTemplates(templates), WithTemplates(d.template, d.resolvedTemplate)}
+		if d.pool != nil {
+			clientOpts = append(clientOpts, WithBackendPool(d.pool))
+		}
+		r.client = NewOpenClawClient(d.url, d.token, d.model, slices.Concat(clientOpts, opts)...)
+	}
+
+	for i, child := range cfg.Routes {
+		if child.Name == "" {
+			child.Name = fmt.Sprintf("%s/%d", cfg.Name, i)
+		}
+		c, err := compileRoute(child, d, templates, opts)
+		if err != nil {
+			return nil, err
+		}
+		r.children = append(r.children, c)
+	}
+	return r, nil
+}
+
+// validateRouteDefaults checks that a forwarding route has a destination, a token for
+// each of its backends and known templates.
+func validateRouteDefaults(name string, d routeDefaults, templates *PromptTemplates) error {
+	if d.pool != nil {
+		for _, b := range d.pool.configs {
+			if b.Token == "" && d.token == "" {
+				return fmt.Errorf("route %q: no OpenClaw token configured for backend %q", name, b.Name)
+			}
+		}
+	} else {
+		if d.url == "" {
+			return fmt.Errorf("route %q: no OpenClaw url configured", name)
+		}
+		if d.token == "" {
+			return fmt.Errorf("route %q: no OpenClaw token configured", name)
+		}
+	}
+	for _, tmpl := range []string{d.template, d.resolvedTemplate} {
+		if !templates.Has(tmpl) {
+			return fmt.Errorf("route %q: unknown prompt template %q", name, tmpl)
+		}
+	}
+	return nil
+}
+
+// Match returns the routes a payload is delivered to, matching against its group and
+// common labels plus the __caller__ pseudo-label naming its webhook token. As in
+// Alertmanager, children are tried in order and the first match wins unless it sets
+// continue; a route with no matching children matches itself.
+func (rt *Router) Match(payload *AlertmanagerPayload) []*Route {
+	labels := make(map[string]string, len(payload.GroupLabels)+len(payload.CommonLabels))
+	for k, v := range payload.GroupLabels {
+		labels[k] = v
+	}
+	for k, v := range payload.CommonLabels {
+		labels[k] = v
+	}
+	if payload.Caller != "" {
+		labels[callerLabel] = payload.Caller
+	}
+	return rt.root.match(labels)
+}
+
+// match returns the deepest matching routes below and including r.
+func (r *Route) match(labels map[string]string) []*Route {
+	for _, m := range r.matchers {
+		if !m.Matches(labels) {
+			return nil
+		}
+	}
+
+	var matched []*Route
+	for _, child := range r.children {
+		m := child.match(labels)
+		matched = append(matched, m...)
+		if len(m) > 0 && !child.cont {
+			break
+		}
+	}
+	if len(matched) == 0 {
+		matched = append(matched, r)
+	}
+	return matched
+}
+
+// firstNonEmpty returns the first non-empty string.
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseMatcher(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		in      string
+		labels  map[string]string
+		want    bool
+		wantErr bool
+	}{
+		{in: "team=db", labels: map[string]string{"team": "db"}, want: true},
+		{in: `team="db"`, labels: map[string]string{"team": "db"}, want: true},
+		{in: "team = db", labels: map[string]string{"team": "net"}, want: false},
+		{in: "severity!=info", labels: map[string]string{"severity": "critical"}, want: true},
+		{in: "severity!=info", labels: map[string]string{"severity": "info"}, want: false},
+		{in: `instance=~"db-.*"`, labels: map[string]string{"instance": "db-1"}, want: true},
+		{in: `instance=~"db-.*"`, labels: map[string]string{"instance": "web-db-1"}, want: false},
+		{in: "instance!~db-.*", labels: map[string]string{"instance": "web-1"}, want: true},
+		{in: `team=""`, labels: map[string]string{}, want: true},
+		{in: "=db", wantErr: true},
+		{in: "team", wantErr: true},
+		{in: "team=~(", wantErr: true},
+		{in: `team="unterminated`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		m, err := ParseMatcher(tt.in)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("ParseMatcher(%q): expected error", tt.in)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseMatcher(%q): unexpected error: %v", tt.in, err)
+			continue
+		}
+		if got := m.Matches(tt.labels); got != tt.want {
+			t.Errorf("%s.Matches(%v) = %v, want %v", m, tt.labels, got, tt.want)
+		}
+	}
+}
+
+func testRouteConfig() RouteConfig {
+	return RouteConfig{
+		Routes: []RouteConfig{
+			{Name: "info", Matchers: []string{"severity=info"}, Drop: true},
+			{
+				Name:     "db",
+				Matchers: []string{"team=db"},
+				URL:      "http://db-agent",
+				Model:    "openclaw:db",
+				Continue: true,
+				Routes: []RouteConfig{
+					{Name: "db-critical", Matchers: []string{"severity=critical"}, Token: "db-token"},
+				},
+			},
+			{Name: "network", Matchers: []string{"team=~net|network"}, Model: "openclaw:net"},
+		},
+	}
+}
+
+func routeNames(routes []*Route) string {
+	names := make([]string, 0, len(routes))
+	for _, r := range routes {
+		names = append(names, r.Name)
+	}
+	return strings.Join(names, ",")
+}
+
+func TestRouter_Match(t *testing.T) {
+	t.Parallel()
+
+	router, err := NewRouter(testRouteConfig(), "http://default", "token", "openclaw:main", defaultPromptTemplates)
+	if err != nil {
+		t.Fatalf("NewRouter: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		common map[string]string
+		group  map[string]string
+		want   string
+	}{
+		{name: "no match falls back to root", common: map[string]string{"team": "web"}, want: "root"},
+		{name: "drop route", common: map[string]string{"severity": "info", "team": "db"}, want: "info"},
+		{name: "nested child", common: map[string]string{"team": "db", "severity": "critical"}, want: "db-critical"},
+		{name: "parent without matching child", common: map[string]string{"team": "db", "severity": "warning"}, want: "db"},
+		{name: "continue also matches later siblings", common: map[string]string{"team": "db"}, want: "db"},
+		{name: "group labels are matched", group: map[string]string{"team": "network"}, want: "network"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			payload := &AlertmanagerPayload{CommonLabels: tt.common, GroupLabels: tt.group}
+			if got := routeNames(router.Match(payload)); got != tt.want {
+				t.Fatalf("Match() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRouter_ContinueMatchesSiblings(t *testing.T) {
+	t.Parallel()
+
+	cfg := RouteConfig{Routes: []RouteConfig{
+		{Name: "audit", Matchers: []string{"team=~.+"}, Continue: true},
+		{Name: "team", Matchers: []string{"team=db"}},
+		{Name: "never", Matchers: []string{"team=db"}},
+	}}
+	router, err := NewRouter(cfg, "http://default", "token", "model", defaultPromptTemplates)
+	if err != nil {
+		t.Fatalf("NewRouter: %v", err)
+	}
+
+	got := routeNames(router.Match(&AlertmanagerPayload{CommonLabels: map[string]string{"team": "db"}}))
+	if got != "audit,team" {
+		t.Fatalf("Match() = %q, want %q", got, "audit,team")
+	}
+}
+
+func TestRouter_Inheritance(t *testing.T) {
+	t.Parallel()
+
+	router, err := NewRouter(testRouteConfig(), "http://default", "token", "openclaw:main", defaultPromptTemplates)
+	if err != nil {
+		t.Fatalf("NewRouter: %v", err)
+	}
+
+	routes := router.Match(&AlertmanagerPayload{CommonLabels: map[string]string{"team": "db", "severity": "critical"}})
+	c := routes[0].client
+	if c.baseURL != "http://db-agent" || c.token != "db-token" || c.model != "openclaw:db" {
+		t.Fatalf("unexpected inherited settings: url=%q token=%q model=%q", c.baseURL, c.token, c.model)
+	}
+}
+
+func TestNewRouter_Invalid(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		cfg     RouteConfig
+		url     string
+		wantErr string
+	}{
+		{
+			name:    "root matchers",
+			cfg:     RouteConfig{Matchers: []string{"team=db"}},
+			url:     "http://default",
+			wantErr: "root route must not have matchers",
+		},
+		{
+			name:    "missing url",
+			cfg:     RouteConfig{Routes: []RouteConfig{{Name: "db", Matchers: []string{"team=db"}}}},
+			wantErr: "no OpenClaw url",
+		},
+		{
+			name:    "unknown template",
+			cfg:     RouteConfig{Routes: []RouteConfig{{Name: "db", Matchers: []string{"team=db"}, Template: "nope"}}},
+			url:     "http://default",
+			wantErr: `unknown prompt template "nope"`,
+		},
+		{
+			name:    "bad matcher",
+			cfg:     RouteConfig{Routes: []RouteConfig{{Name: "db", Matchers: []string{"team=~("}}}},
+			url:     "http://default",
+			wantErr: `route "db": invalid matcher`,
+		},
+		{
+			name: "duplicate name",
+			cfg: RouteConfig{Routes: []RouteConfig{
+				{Name: "db", Matchers: []string{"team=db"}},
+				{Name: "web", Matchers: []string{"team=web"}, Routes: []RouteConfig{{Name: "db"}}},
+			}},
+			url:     "http://default",
+			wantErr: `duplicate route name "db"`,
+		},
+		{
+			name:    "name clashing with a generated one",
+			cfg:     RouteConfig{Routes: []RouteConfig{{Matchers: []string{"team=db"}}, {Name: "root/0"}}},
+			url:     "http://default",
+			wantErr: `duplicate route name "root/0"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := NewRouter(tt.cfg, tt.url, "token", "model", defaultPromptTemplates)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestNewRouter_DropRouteNeedsNoDestination(t *testing.T) {
+	t.Parallel()
+
+	cfg := RouteConfig{Drop: true}
+	if _, err := NewRouter(cfg, "", "", "", defaultPromptTemplates); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestLoadRouteConfig_UnknownField(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "routes.json")
+	if err := os.WriteFile(path, []byte(`{"routes":[{"matcher":["team=db"]}]}`), 0o600); err != nil {
+		t.Fatalf("write routes: %v", err)
+	}
+
+	if _, err := LoadRouteConfig(path); err == nil || !strings.Contains(err.Error(), "unknown field") {
+		t.Fatalf("expected unknown field error, got %v", err)
+	}
+}
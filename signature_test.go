@@ -0,0 +1,153 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func sign(secret, timestamp, body string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	if timestamp != "" {
+		mac.Write([]byte(timestamp + "."))
+	}
+	mac.Write([]byte(body))
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestSignatureVerifier_Verify(t *testing.T) {
+	t.Parallel()
+
+	now := time.Unix(1767225600, 0)
+	ts := strconv.FormatInt(now.Unix(), 10)
+	body := `{"status":"firing","alerts":[]}`
+
+	tests := []struct {
+		name      string
+		signature string
+		timestamp string
+		wantErr   error
+	}{
+		{name: "current secret", signature: sign("new", ts, body), timestamp: ts},
+		{name: "previous secret", signature: sign("old", ts, body), timestamp: ts},
+		{name: "without prefix", signature: strings.TrimPrefix(sign("new", ts, body), "sha256="), timestamp: ts},
+		{name: "unknown secret", signature: sign("other", ts, body), timestamp: ts, wantErr: errBadSignature},
+		{name: "tampered body", signature: sign("new", ts, body+" "), timestamp: ts, wantErr: errBadSignature},
+		{name: "not hex", signature: "sha256=zz", timestamp: ts, wantErr: errBadSignature},
+		{name: "missing signature", timestamp: ts, wantErr: errMissingSignature},
+		{name: "missing timestamp", signature: sign("new", ts, body), wantErr: errMissingTimestamp},
+		{name: "invalid timestamp", signature: sign("new", "soon", body), timestamp: "soon", wantErr: errBadTimestamp},
+		{
+			name:      "replayed",
+			signature: sign("new", "1767225000", body),
+			timestamp: "1767225000",
+			wantErr:   errTimestampSkew,
+		},
+		{
+			name:      "from the future",
+			signature: sign("new", "1767226000", body),
+			timestamp: "1767226000",
+			wantErr:   errTimestampSkew,
+		},
+		{
+			name:      "timestamp not signed",
+			signature: sign("new", "", body),
+			timestamp: ts,
+			wantErr:   errBadSignature,
+		},
+	}
+
+	v := NewSignatureVerifier("X-Signature-256", "X-Signature-Timestamp", 5*time.Minute, []string{"new", "old"})
+	v.now = func() time.Time { return now }
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			h := http.Header{}
+			if tt.signature != "" {
+				h.Set("X-Signature-256", tt.signature)
+			}
+			if tt.timestamp != "" {
+				h.Set("X-Signature-Timestamp", tt.timestamp)
+			}
+			err := v.Verify(h, []byte(body))
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("expected %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestSignatureVerifier_WithoutTimestamp(t *testing.T) {
+	t.Parallel()
+
+	v := NewSignatureVerifier("X-Hub-Signature-256", "", 0, []string{"secret"})
+	h := http.Header{}
+	h.Set("X-Hub-Signature-256", sign("secret", "", "{}"))
+	if err := v.Verify(h, []byte("{}")); err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+}
+
+func TestWebhookHandler_Signature(t *testing.T) {
+	t.Parallel()
+
+	client := NewOpenClawClient("http://localhost", "token", "model")
+	queue := NewAlertQueue(client)
+	defer queue.Stop()
+	verifier := NewSignatureVerifier(defaultSignatureHeader, defaultTimestampHeader, time.Minute, []string{"secret"})
+	mux := NewMux(queue, "", WithSignatureVerifier(verifier))
+
+	body := testPayload(t, "firing")
+	ts := strconv.FormatInt(time.Now().Unix(), 10)
+	post := func(signature string) int {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodPost, "/webhook", strings.NewReader(body))
+		req.Header.Set(defaultSignatureHeader, signature)
+		req.Header.Set(defaultTimestampHeader, ts)
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	if code := post(sign("wrong", ts, body)); code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 for a bad signature, got %d", code)
+	}
+	if code := post(sign("secret", ts, body)); code != http.StatusOK {
+		t.Fatalf("expected 200 for a valid signature, got %d", code)
+	}
+	if depth := queue.Stats().Depth; depth != 1 {
+		t.Fatalf("expected the signed payload to be queued, got depth %d", depth)
+	}
+}
+
+func TestLoadConfig_Signatures(t *testing.T) {
+	// Not parallel: t.Setenv modifies process environment.
+	t.Setenv("OPENCLAW_URL", "http://localhost")
+	t.Setenv("OPENCLAW_TOKEN", "t")
+	t.Setenv("WEBHOOK_HMAC_SECRETS", "new, old")
+
+	cfg, err := loadConfig("")
+	if err != nil {
+		t.Fatalf("loadConfig: %v", err)
+	}
+	if len(cfg.WebhookHMACSecrets) != 2 || cfg.WebhookHMACSecrets[1] != "old" {
+		t.Fatalf("unexpected secrets %q", cfg.WebhookHMACSecrets)
+	}
+	if cfg.SignatureHeader != defaultSignatureHeader || cfg.MaxSkew != defaultMaxSkew {
+		t.Fatalf("unexpected defaults: header=%q skew=%s", cfg.SignatureHeader, cfg.MaxSkew)
+	}
+
+	t.Setenv("WEBHOOK_TOKEN", "token")
+	if _, err := loadConfig(""); err == nil || !strings.Contains(err.Error(), "mutually exclusive") {
+		t.Fatalf("expected token and secrets to be rejected together, got %v", err)
+	}
+}
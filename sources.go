@@ -0,0 +1,325 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Payload sources for the vendor webhook endpoints, served at /webhook/{source}.
+const (
+	payloadSourcePagerDuty = "pagerduty"
+	payloadSourceOpsgenie  = "opsgenie"
+	payloadSourceDatadog   = "datadog"
+)
+
+// payloadDecoder converts a webhook body into the internal alert model.
+type payloadDecoder func(r io.Reader) (*AlertmanagerPayload, error)
+
+// vendorDecoders maps each vendor webhook source to its decoder.
+var vendorDecoders = map[string]payloadDecoder{
+	payloadSourcePagerDuty: decodePagerDuty,
+	payloadSourceOpsgenie:  decodeOpsgenie,
+	payloadSourceDatadog:   decodeDatadog,
+}
+
+// looseString is a JSON string that also accepts a number, since vendors and
+// user-written payload templates are not consistent about quoting IDs and timestamps.
+type looseString string
+
+// UnmarshalJSON accepts a JSON string, number or null.
+func (s *looseString) UnmarshalJSON(b []byte) error {
+	if string(b) == "null" {
+		return nil
+	}
+	var str string
+	if err := json.Unmarshal(b, &str); err == nil {
+		*s = looseString(str)
+		return nil
+	}
+	var n json.Number
+	if err := json.Unmarshal(b, &n); err != nil {
+		return fmt.Errorf("expected a string or number: %w", err)
+	}
+	*s = looseString(n.String())
+	return nil
+}
+
+// pagerDutyWebhook is a PagerDuty V3 webhook for an incident event.
+type pagerDutyWebhook struct {
+	Event struct {
+		EventType  string `json:"event_type"`
+		OccurredAt string `json:"occurred_at"`
+		Data       struct {
+			ID          string         `json:"id"`
+			Number      looseString    `json:"number"`
+			Title       string         `json:"title"`
+			Urgency     string         `json:"urgency"`
+			HTMLURL     string         `json:"html_url"`
+			IncidentKey string         `json:"incident_key"`
+			CreatedAt   string         `json:"created_at"`
+			Service     pagerDutyRef   `json:"service"`
+			Priority    *pagerDutyRef  `json:"priority"`
+			Teams       []pagerDutyRef `json:"teams"`
+		} `json:"data"`
+	} `json:"event"`
+}
+
+// pagerDutyRef is a reference to another PagerDuty object.
+type pagerDutyRef struct {
+	ID      string `json:"id"`
+	Summary string `json:"summary"`
+}
+
+// decodePagerDuty normalizes a PagerDuty V3 incident webhook. Triggered, acknowledged and
+// reopened incidents are firing and resolved incidents are resolved; other event types
+// keep their event type as status and are ignored by the handler.
+func decodePagerDuty(r io.Reader) (*AlertmanagerPayload, error) {
+	var w pagerDutyWebhook
+	if err := json.NewDecoder(r).Decode(&w); err != nil {
+		return nil, fmt.Errorf("decode pagerduty webhook: %w", err)
+	}
+	e, d := w.Event, w.Event.Data
+
+	status := e.EventType
+	switch e.EventType {
+	case "incident.triggered", "incident.acknowledged", "incident.reopened", "incident.escalated":
+		status = "firing"
+	case "incident.resolved":
+		status = "resolved"
+	}
+
+	labels := map[string]string{
+		"alertname": d.Title,
+		"source":    payloadSourcePagerDuty,
+		"service":   d.Service.Summary,
+		"urgency":   d.Urgency,
+	}
+	if d.Priority != nil {
+		labels["priority"] = d.Priority.Summary
+	}
+	if len(d.Teams) > 0 {
+		labels["team"] = d.Teams[0].Summary
+	}
+	annotations := map[string]string{
+		"summary":         d.Title,
+		"url":             d.HTMLURL,
+		"event_type":      e.EventType,
+		"incident_number": string(d.Number),
+	}
+
+	return newVendorPayload(payloadSourcePagerDuty, firstNonEmpty(d.IncidentKey, d.ID), status, Alert{
+		Labels:       labels,
+		Annotations:  annotations,
+		StartsAt:     firstNonEmpty(d.CreatedAt, e.OccurredAt),
+		GeneratorURL: d.HTMLURL,
+		Fingerprint:  d.ID,
+	}), nil
+}
+
+// opsgenieWebhook is an Opsgenie outgoing webhook integration payload.
+type opsgenieWebhook struct {
+	Action string `json:"action"`
+	Alert  struct {
+		AlertID     string            `json:"alertId"`
+		TinyID      looseString       `json:"tinyId"`
+		Alias       string            `json:"alias"`
+		Message     string            `json:"message"`
+		Description string            `json:"description"`
+		Entity      string            `json:"entity"`
+		Source      string            `json:"source"`
+		Priority    string            `json:"priority"`
+		Team        string            `json:"team"`
+		Tags        []string          `json:"tags"`
+		Details     map[string]string `json:"details"`
+		CreatedAt   looseString       `json:"createdAt"`
+	} `json:"alert"`
+	IntegrationName string `json:"integrationName"`
+}
+
+// decodeOpsgenie normalizes an Opsgenie webhook. Create is firing and Close is resolved;
+// other actions keep the lower-cased action as status and are ignored by the handler.
+// Alert details become labels.
+func decodeOpsgenie(r io.Reader) (*AlertmanagerPayload, error) {
+	var w opsgenieWebhook
+	if err := json.NewDecoder(r).Decode(&w); err != nil {
+		return nil, fmt.Errorf("decode opsgenie webhook: %w", err)
+	}
+	a := w.Alert
+
+	status := strings.ToLower(w.Action)
+	switch w.Action {
+	case "Create":
+		status = "firing"
+	case "Close":
+		status = "resolved"
+	}
+
+	labels := make(map[string]string, len(a.Details)+6)
+	for k, v := range a.Details {
+		labels[sanitizeLabelName(k)] = v
+	}
+	labels["alertname"] = a.Message
+	labels["source"] = payloadSourceOpsgenie
+	labels["priority"] = a.Priority
+	labels["entity"] = a.Entity
+	labels["team"] = a.Team
+	if len(a.Tags) > 0 {
+		labels["tags"] = strings.Join(a.Tags, ",")
+	}
+	annotations := map[string]string{
+		"summary":     a.Message,
+		"description": a.Description,
+		"tiny_id":     string(a.TinyID),
+		"origin":      a.Source,
+		"action":      w.Action,
+	}
+
+	return newVendorPayload(payloadSourceOpsgenie, firstNonEmpty(a.Alias, a.AlertID), status, Alert{
+		Labels:      labels,
+		Annotations: annotations,
+		StartsAt:    epochMillisToRFC3339(string(a.CreatedAt)),
+		Fingerprint: a.AlertID,
+	}), nil
+}
+
+// datadogWebhook is the body of a Datadog webhook whose payload template uses the keys
+// documented in docs/api.md.
+type datadogWebhook struct {
+	ID         looseString `json:"id"`
+	AlertID    looseString `json:"alert_id"`
+	AggregKey  string      `json:"aggreg_key"`
+	Title      string      `json:"title"`
+	Body       string      `json:"body"`
+	Transition string      `json:"transition"`
+	AlertType  string      `json:"alert_type"`
+	Priority   string      `json:"priority"`
+	Hostname   string      `json:"hostname"`
+	Scope      string      `json:"scope"`
+	Tags       string      `json:"tags"`
+	Link       string      `json:"link"`
+	Date       looseString `json:"date"`
+}
+
+// datadogTitlePrefix matches the transition prefix Datadog adds to event titles, such
+// as "[Triggered on {host:db1}] ".
+var datadogTitlePrefix = regexp.MustCompile(`^\[[^\]]*\]\s*`)
+
+// decodeDatadog normalizes a Datadog monitor webhook. Recovered transitions (or a
+// success alert type) are resolved, everything else is firing. Tags of the form key:value
+// become labels; a tag without a value becomes a label with the value "true".
+func decodeDatadog(r io.Reader) (*AlertmanagerPayload, error) {
+	var w datadogWebhook
+	if err := json.NewDecoder(r).Decode(&w); err != nil {
+		return nil, fmt.Errorf("decode datadog webhook: %w", err)
+	}
+
+	status := "firing"
+	if w.Transition == "Recovered" || (w.Transition == "" && w.AlertType == "success") {
+		status = "resolved"
+	}
+
+	labels := make(map[string]string)
+	for _, tag := range strings.Split(w.Tags, ",") {
+		key, value, ok := strings.Cut(strings.TrimSpace(tag), ":")
+		if !ok {
+			value = "true"
+		}
+		if key != "" {
+			labels[sanitizeLabelName(key)] = value
+		}
+	}
+	labels["alertname"] = datadogTitlePrefix.ReplaceAllString(w.Title, "")
+	labels["source"] = payloadSourceDatadog
+	labels["priority"] = w.Priority
+	labels["alert_type"] = w.AlertType
+	if w.Hostname != "" {
+		labels["host"] = w.Hostname
+	}
+	annotations := map[string]string{
+		"summary":     w.Title,
+		"description": w.Body,
+		"transition":  w.Transition,
+		"scope":       w.Scope,
+		"url":         w.Link,
+	}
+
+	// Events without a monitor, such as those posted through the events API, fall back
+	// to their own ID so that they are not merged with each other.
+	monitor := string(w.AlertID)
+	monitorScope := ""
+	if monitor != "" {
+		monitorScope = monitor + ":" + w.Scope
+	}
+	return newVendorPayload(payloadSourceDatadog, firstNonEmpty(monitor, string(w.ID)), status, Alert{
+		Labels:       labels,
+		Annotations:  annotations,
+		StartsAt:     epochMillisToRFC3339(string(w.Date)),
+		GeneratorURL: w.Link,
+		Fingerprint:  firstNonEmpty(w.AggregKey, monitorScope, string(w.ID)),
+	}), nil
+}
+
+// newVendorPayload wraps a single normalized alert in a payload whose group is the
+// vendor's incident or monitor key. Empty labels and annotations are removed.
+func newVendorPayload(source, key, status string, alert Alert) *AlertmanagerPayload {
+	dropEmpty(alert.Labels)
+	dropEmpty(alert.Annotations)
+	alert.Status = status
+
+	common := make(map[string]string, len(alert.Labels))
+	for k, v := range alert.Labels {
+		common[k] = v
+	}
+	groupLabels := map[string]string{"alertname": alert.Labels["alertname"]}
+
+	p := &AlertmanagerPayload{
+		Origin:            source,
+		Status:            status,
+		Receiver:          source,
+		Alerts:            []Alert{alert},
+		GroupLabels:       groupLabels,
+		CommonLabels:      common,
+		CommonAnnotations: alert.Annotations,
+	}
+	if key != "" {
+		p.GroupKey = source + ":" + key
+	}
+	return p
+}
+
+// dropEmpty removes entries with empty values.
+func dropEmpty(m map[string]string) {
+	for k, v := range m {
+		if v == "" {
+			delete(m, k)
+		}
+	}
+}
+
+// invalidLabelChars matches characters not allowed in label names.
+var invalidLabelChars = regexp.MustCompile(`[^a-zA-Z0-9_]`)
+
+// sanitizeLabelName turns a vendor key into a valid label name, so that it can be
+// used in route matchers.
+func sanitizeLabelName(name string) string {
+	name = invalidLabelChars.ReplaceAllString(name, "_")
+	if name != "" && name[0] >= '0' && name[0] <= '9' {
+		name = "_" + name
+	}
+	return name
+}
+
+// epochMillisToRFC3339 converts a Unix timestamp in milliseconds to RFC 3339. Values
+// that are not integers are returned unchanged.
+func epochMillisToRFC3339(v string) string {
+	ms, err := strconv.ParseInt(v, 10, 64)
+	if err != nil {
+		return v
+	}
+	return time.UnixMilli(ms).UTC().Format(time.RFC3339)
+}
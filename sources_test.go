@@ -0,0 +1,287 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+const pagerDutyWebhookBody = `{
+  "event": {
+    "id": "01BZ0JLKBPL7KHJA2S6SDTL0FN",
+    "event_type": "incident.triggered",
+    "resource_type": "incident",
+    "occurred_at": "2026-01-01T00:00:05.169Z",
+    "data": {
+      "id": "PGR0VU2",
+      "type": "incident",
+      "number": 2,
+      "title": "Checkout latency high",
+      "status": "triggered",
+      "urgency": "high",
+      "html_url": "https://acme.pagerduty.com/incidents/PGR0VU2",
+      "incident_key": "d3640fbd41094207a1c11e58e46b1662",
+      "created_at": "2026-01-01T00:00:00Z",
+      "service": {"id": "PF9KMXH", "summary": "Checkout API"},
+      "priority": {"id": "PSO75BM", "summary": "P1"},
+      "teams": [{"id": "PFCVPS0", "summary": "Payments"}]
+    }
+  }
+}`
+
+const opsgenieWebhookBody = `{
+  "action": "Create",
+  "alert": {
+    "alertId": "70413a06-38d6-4c85-92b8-5ebc900d42e2",
+    "tinyId": "1791",
+    "alias": "disk-db1",
+    "message": "Disk almost full",
+    "description": "/var is 95% full",
+    "entity": "db1",
+    "source": "zabbix",
+    "priority": "P2",
+    "team": "dba",
+    "tags": ["disk", "prod"],
+    "details": {"data-center": "eu-1"},
+    "createdAt": 1767225600000
+  },
+  "integrationName": "alertstoopenclaw"
+}`
+
+const datadogWebhookBody = `{
+  "id": "5934562881390958217",
+  "alert_id": 12345,
+  "aggreg_key": "",
+  "title": "[Triggered on {host:web1}] High error rate",
+  "body": "Error rate is above 5%",
+  "transition": "Triggered",
+  "alert_type": "error",
+  "priority": "P1",
+  "hostname": "web1",
+  "scope": "host:web1",
+  "tags": "env:prod,team:web,service.name:frontend,monitor",
+  "link": "https://app.datadoghq.com/monitors/12345",
+  "date": "1767225600000"
+}`
+
+func TestDecodeVendorWebhooks(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name        string
+		decode      payloadDecoder
+		body        string
+		status      string
+		groupKey    string
+		fingerprint string
+		labels      map[string]string
+		annotation  string
+	}{
+		{
+			name:        "pagerduty",
+			decode:      decodePagerDuty,
+			body:        pagerDutyWebhookBody,
+			status:      "firing",
+			groupKey:    "pagerduty:d3640fbd41094207a1c11e58e46b1662",
+			fingerprint: "PGR0VU2",
+			labels: map[string]string{
+				"alertname": "Checkout latency high", "service": "Checkout API",
+				"priority": "P1", "team": "Payments", "urgency": "high",
+			},
+			annotation: "https://acme.pagerduty.com/incidents/PGR0VU2",
+		},
+		{
+			name:        "pagerduty resolved",
+			decode:      decodePagerDuty,
+			body:        strings.Replace(pagerDutyWebhookBody, "incident.triggered", "incident.resolved", 1),
+			status:      "resolved",
+			groupKey:    "pagerduty:d3640fbd41094207a1c11e58e46b1662",
+			fingerprint: "PGR0VU2",
+			labels:      map[string]string{"alertname": "Checkout latency high"},
+		},
+		{
+			name:        "pagerduty other event",
+			decode:      decodePagerDuty,
+			body:        strings.Replace(pagerDutyWebhookBody, "incident.triggered", "incident.annotated", 1),
+			status:      "incident.annotated",
+			groupKey:    "pagerduty:d3640fbd41094207a1c11e58e46b1662",
+			fingerprint: "PGR0VU2",
+		},
+		{
+			name:        "opsgenie",
+			decode:      decodeOpsgenie,
+			body:        opsgenieWebhookBody,
+			status:      "firing",
+			groupKey:    "opsgenie:disk-db1",
+			fingerprint: "70413a06-38d6-4c85-92b8-5ebc900d42e2",
+			labels: map[string]string{
+				"alertname": "Disk almost full", "team": "dba", "entity": "db1",
+				"priority": "P2", "data_center": "eu-1", "tags": "disk,prod",
+			},
+		},
+		{
+			name:        "opsgenie close",
+			decode:      decodeOpsgenie,
+			body:        strings.Replace(opsgenieWebhookBody, `"Create"`, `"Close"`, 1),
+			status:      "resolved",
+			groupKey:    "opsgenie:disk-db1",
+			fingerprint: "70413a06-38d6-4c85-92b8-5ebc900d42e2",
+		},
+		{
+			name:        "datadog",
+			decode:      decodeDatadog,
+			body:        datadogWebhookBody,
+			status:      "firing",
+			groupKey:    "datadog:12345",
+			fingerprint: "12345:host:web1",
+			labels: map[string]string{
+				"alertname": "High error rate", "env": "prod", "team": "web",
+				"service_name": "frontend", "monitor": "true", "host": "web1",
+			},
+		},
+		{
+			name:        "datadog recovered",
+			decode:      decodeDatadog,
+			body:        strings.Replace(datadogWebhookBody, `"Triggered"`, `"Recovered"`, 1),
+			status:      "resolved",
+			groupKey:    "datadog:12345",
+			fingerprint: "12345:host:web1",
+			labels:      map[string]string{"alertname": "High error rate"},
+		},
+		{
+			name:   "datadog without monitor",
+			decode: decodeDatadog,
+			body: strings.NewReplacer(`"alert_id": 12345,`, "", `"scope": "host:web1"`, `"scope": ""`).
+				Replace(datadogWebhookBody),
+			status:      "firing",
+			groupKey:    "datadog:5934562881390958217",
+			fingerprint: "5934562881390958217",
+			labels:      map[string]string{"alertname": "High error rate"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			p, err := tt.decode(strings.NewReader(tt.body))
+			if err != nil {
+				t.Fatalf("decode: %v", err)
+			}
+			if p.Status != tt.status || p.GroupKey != tt.groupKey || len(p.Alerts) != 1 {
+				t.Fatalf("unexpected payload: status=%q group_key=%q alerts=%d", p.Status, p.GroupKey, len(p.Alerts))
+			}
+			a := p.Alerts[0]
+			if a.Fingerprint != tt.fingerprint || a.Status != tt.status {
+				t.Fatalf("unexpected alert: fingerprint=%q status=%q", a.Fingerprint, a.Status)
+			}
+			if a.StartsAt != "2026-01-01T00:00:00Z" {
+				t.Fatalf("unexpected startsAt %q", a.StartsAt)
+			}
+			for k, v := range tt.labels {
+				if got, ok := p.CommonLabels[k]; !ok || got != v {
+					t.Errorf("label %s: expected %q, got %q (present=%v)", k, v, got, ok)
+				}
+			}
+			if tt.annotation != "" && a.Annotations["url"] != tt.annotation {
+				t.Errorf("expected url annotation %q, got %q", tt.annotation, a.Annotations["url"])
+			}
+			if p.Source() != strings.Fields(tt.name)[0] {
+				t.Errorf("expected source %q, got %q", strings.Fields(tt.name)[0], p.Source())
+			}
+		})
+	}
+}
+
+func TestVendorWebhookEndpoints(t *testing.T) {
+	t.Parallel()
+
+	bodies := map[string]string{
+		"/webhook/pagerduty": pagerDutyWebhookBody,
+		"/webhook/opsgenie":  opsgenieWebhookBody,
+		"/webhook/datadog":   datadogWebhookBody,
+	}
+
+	client := NewOpenClawClient("http://localhost", "token", "model")
+	queue := NewAlertQueue(client)
+	defer queue.Stop()
+	mux := NewMux(queue, "secret")
+
+	for path, body := range bodies {
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, req)
+		if w.Code != http.StatusUnauthorized {
+			t.Fatalf("%s: expected 401 without token, got %d", path, w.Code)
+		}
+
+		req = httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer secret")
+		w = httptest.NewRecorder()
+		mux.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: expected 200, got %d", path, w.Code)
+		}
+	}
+
+	if depth := queue.Stats().Depth; depth != len(bodies) {
+		t.Fatalf("expected %d queued payloads, got %d", len(bodies), depth)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/webhook/opsgenie", strings.NewReader("{invalid"))
+	req.Header.Set("Authorization", "Bearer secret")
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for malformed body, got %d", w.Code)
+	}
+}
+
+func TestDatadogEventsWithoutMonitor_ForwardedSeparately(t *testing.T) {
+	t.Parallel()
+
+	forwarded := make(chan struct{}, 2)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		forwarded <- struct{}{}
+	}))
+	defer server.Close()
+
+	queue := NewAlertQueue(NewOpenClawClient(server.URL, "token", "model"))
+	defer queue.Stop()
+	mux := NewMux(queue, "")
+
+	var groupKeys []string
+	for _, id := range []string{"1001", "1002"} {
+		body := strings.NewReplacer(`"alert_id": 12345,`, "", `"5934562881390958217"`, `"`+id+`"`).
+			Replace(datadogWebhookBody)
+		p, err := decodeDatadog(strings.NewReader(body))
+		if err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		groupKeys = append(groupKeys, p.GroupKey)
+
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/webhook/datadog", strings.NewReader(body)))
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d", w.Code)
+		}
+	}
+	if groupKeys[0] == groupKeys[1] {
+		t.Fatalf("expected events without a monitor to get their own group, got %q twice", groupKeys[0])
+	}
+	if depth := queue.Stats().Depth; depth != 2 {
+		t.Fatalf("expected both events to stay queued, got %d", depth)
+	}
+
+	queue.Start()
+	for i := range 2 {
+		select {
+		case <-forwarded:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("expected both events to be forwarded, got %d", i)
+		}
+	}
+}
@@ -0,0 +1,295 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Streaming defaults: a streamed request fails after a minute without data, and progress
+// is reported at most every five seconds.
+const (
+	defaultStreamIdleTimeout = time.Minute
+	streamProgressInterval   = 5 * time.Second
+)
+
+// Stream errors. A stream that stops early or goes quiet is retried like a dropped
+// connection or a timeout; an answer longer than maxResponseSize is not retried.
+var (
+	errStreamIdle      = errors.New("no data from openclaw stream within the idle timeout")
+	errStreamTruncated = errors.New("openclaw stream ended before [DONE]")
+	errStreamTooLarge  = fmt.Errorf("openclaw stream answer exceeds %d bytes", maxResponseSize)
+)
+
+// chatStreamOptions asks for token usage in the last chunk of a streamed answer.
+type chatStreamOptions struct {
+	IncludeUsage bool `json:"include_usage"`
+}
+
+// chatChunk is one server-sent event of a streamed chat completions answer.
+type chatChunk struct {
+	ID      string            `json:"id"`
+	Model   string            `json:"model"`
+	Created int64             `json:"created"`
+	Choices []chatChunkChoice `json:"choices"`
+	Usage   *chatUsage        `json:"usage"`
+	Error   *struct {
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// chatChunkChoice is the part of one completion choice carried by a chunk.
+type chatChunkChoice struct {
+	Index        int         `json:"index"`
+	Delta        chatMessage `json:"delta"`
+	FinishReason string      `json:"finish_reason"`
+}
+
+// StreamProgress is a snapshot of a streamed answer while it arrives: the request it
+// belongs to, the chunks received so far and the response assembled from them.
+type StreamProgress struct {
+	Backend  string
+	Model    string
+	Attempt  int
+	Chunks   int
+	Response *chatResponse
+}
+
+// progressKey is the context key of the function receiving stream progress.
+type progressKey struct{}
+
+// WithStreamProgress returns a context that makes Forward pass snapshots of streamed
+// answers to fn while they arrive, at most every streamProgressInterval.
+func WithStreamProgress(ctx context.Context, fn func(StreamProgress)) context.Context {
+	return context.WithValue(ctx, progressKey{}, fn)
+}
+
+// streamProgressFrom returns the progress function of ctx, or nil.
+func streamProgressFrom(ctx context.Context) func(StreamProgress) {
+	fn, _ := ctx.Value(progressKey{}).(func(StreamProgress))
+	return fn
+}
+
+// isEventStream reports whether a response is a server-sent event stream. A server that
+// ignores the stream flag answers with plain JSON instead.
+func isEventStream(resp *http.Response) bool {
+	mediaType, _, err := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	return err == nil && mediaType == "text/event-stream"
+}
+
+// idleTimer cancels a request once no data arrived for its timeout, starting from when
+// the request is sent.
+type idleTimer struct {
+	timeout time.Duration
+	timer   *time.Timer
+}
+
+// startIdleTimer returns a context that is cancelled with errStreamIdle after timeout
+// unless the timer is touched.
+func startIdleTimer(ctx context.Context, timeout time.Duration) (context.Context, *idleTimer) {
+	ctx, cancel := context.WithCancelCause(ctx)
+	t := &idleTimer{timeout: timeout}
+	t.timer = time.AfterFunc(timeout, func() { cancel(errStreamIdle) })
+	return ctx, t
+}
+
+// stop stops the timer.
+func (t *idleTimer) stop() {
+	t.timer.Stop()
+}
+
+// reader returns a reader that restarts the timer whenever r returns data.
+func (t *idleTimer) reader(r io.Reader) io.Reader {
+	return readerFunc(func(p []byte) (int, error) {
+		n, err := r.Read(p)
+		if n > 0 {
+			t.timer.Reset(t.timeout)
+		}
+		return n, err
+	})
+}
+
+// readerFunc adapts a function to io.Reader.
+type readerFunc func(p []byte) (int, error)
+
+// Read calls f.
+func (f readerFunc) Read(p []byte) (int, error) {
+	return f(p)
+}
+
+// idleCause returns errStreamIdle, wrapping err, if ctx was cancelled by an idle timer,
+// and err otherwise.
+func idleCause(ctx context.Context, err error) error {
+	if errors.Is(context.Cause(ctx), errStreamIdle) && !errors.Is(err, errStreamIdle) {
+		return fmt.Errorf("%w: %w", errStreamIdle, err)
+	}
+	return err
+}
+
+// readEvents calls fn with the data of each server-sent event in r, joining multi-line
+// data with newlines, until fn returns false or r ends. Comments and fields other than
+// data are ignored.
+func readEvents(r io.Reader, fn func(data []byte) bool) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxResponseSize)
+	var data []byte
+	pending := false
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		switch {
+		case len(line) == 0:
+			if pending && !fn(data) {
+				return nil
+			}
+			data, pending = data[:0], false
+		case line[0] == ':':
+			// A comment, often sent to keep the connection alive.
+		default:
+			name, value, _ := bytes.Cut(line, []byte(":"))
+			if string(name) != "data" {
+				continue
+			}
+			if pending {
+				data = append(data, '\n')
+			}
+			data = append(data, bytes.TrimPrefix(value, []byte(" "))...)
+			pending = true
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	if pending {
+		fn(data)
+	}
+	return nil
+}
+
+// streamAssembler builds a chat completions response from the chunks of a stream.
+type streamAssembler struct {
+	resp    chatResponse
+	content map[int]*strings.Builder
+	size    int
+	chunks  int
+}
+
+// add merges a chunk into the response.
+func (a *streamAssembler) add(chunk *chatChunk) {
+	a.chunks++
+	a.resp.ID = firstNonEmpty(a.resp.ID, chunk.ID)
+	a.resp.Model = firstNonEmpty(a.resp.Model, chunk.Model)
+	if a.resp.Created == 0 {
+		a.resp.Created = chunk.Created
+	}
+	if chunk.Usage != nil {
+		a.resp.Usage = chunk.Usage
+	}
+	if a.content == nil {
+		a.content = make(map[int]*strings.Builder)
+	}
+	for _, c := range chunk.Choices {
+		i := slices.IndexFunc(a.resp.Choices, func(choice chatChoice) bool { return choice.Index == c.Index })
+		if i < 0 {
+			a.resp.Choices = append(a.resp.Choices, chatChoice{Index: c.Index, Message: chatMessage{Role: "assistant"}})
+			a.content[c.Index] = &strings.Builder{}
+			i = len(a.resp.Choices) - 1
+		}
+		choice := &a.resp.Choices[i]
+		choice.Message.Role = firstNonEmpty(c.Delta.Role, choice.Message.Role)
+		choice.FinishReason = firstNonEmpty(c.FinishReason, choice.FinishReason)
+		a.content[c.Index].WriteString(c.Delta.Content)
+		a.size += len(c.Delta.Content)
+	}
+}
+
+// response returns the response assembled so far. Later chunks do not change it.
+func (a *streamAssembler) response() *chatResponse {
+	resp := a.resp
+	resp.Choices = slices.Clone(a.resp.Choices)
+	slices.SortFunc(resp.Choices, func(x, y chatChoice) int { return x.Index - y.Index })
+	for i := range resp.Choices {
+		resp.Choices[i].Message.Content = a.content[resp.Choices[i].Index].String()
+	}
+	return &resp
+}
+
+// readStream reads a streamed answer until the [DONE] event and returns the assembled
+// response, passing snapshots to progress, if non-nil, while chunks arrive. Chunks that
+// cannot be parsed are skipped. An error event fails the request as a server error, and
+// an answer whose content exceeds maxResponseSize as a client error.
+func readStream(r io.Reader, progress *progressReporter) (*chatResponse, error) {
+	var a streamAssembler
+	var streamErr error
+	done := false
+	err := readEvents(r, func(data []byte) bool {
+		if string(data) == "[DONE]" {
+			done = true
+			return false
+		}
+		var chunk chatChunk
+		if err := json.Unmarshal(data, &chunk); err != nil {
+			slog.Warn("could not parse openclaw stream chunk", "error", err)
+			return true
+		}
+		if chunk.Error != nil {
+			streamErr = &requestError{kind: errorServer, err: fmt.Errorf("openclaw stream error: %s", chunk.Error.Message)}
+			return false
+		}
+		a.add(&chunk)
+		if a.size > maxResponseSize {
+			streamErr = &requestError{kind: errorClient, err: errStreamTooLarge}
+			return false
+		}
+		metrics.streamChunks.Inc()
+		progress.report(&a)
+		return true
+	})
+	switch {
+	case err != nil:
+		return nil, err
+	case streamErr != nil:
+		return nil, streamErr
+	case !done:
+		return nil, errStreamTruncated
+	}
+	return a.response(), nil
+}
+
+// progressReporter passes snapshots of a streamed answer to a progress function, on the
+// first chunk and then at most every streamProgressInterval.
+type progressReporter struct {
+	fn   func(StreamProgress)
+	base StreamProgress
+	last time.Time
+}
+
+// newProgressReporter returns a reporter for the progress function of ctx, or nil if it
+// has none.
+func newProgressReporter(ctx context.Context, b *clientBackend, attempt int) *progressReporter {
+	fn := streamProgressFrom(ctx)
+	if fn == nil {
+		return nil
+	}
+	return &progressReporter{fn: fn, base: StreamProgress{Backend: b.name, Model: b.model, Attempt: attempt}}
+}
+
+// report passes a snapshot of a's response if enough time passed since the last one.
+func (p *progressReporter) report(a *streamAssembler) {
+	if p == nil || time.Since(p.last) < streamProgressInterval {
+		return
+	}
+	p.last = time.Now()
+	snapshot := p.base
+	snapshot.Chunks, snapshot.Response = a.chunks, a.response()
+	p.fn(snapshot)
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// streamServer answers every request with the given server-sent events, waiting gap
+// between them.
+func streamServer(t *testing.T, gap time.Duration, events ...string) (*httptest.Server, *chatRequest) {
+	t.Helper()
+
+	var got chatRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewDecoder(r.Body).Decode(&got)
+		w.Header().Set("Content-Type", "text/event-stream")
+		for i, event := range events {
+			if i > 0 {
+				select {
+				case <-time.After(gap):
+				case <-r.Context().Done():
+					return
+				}
+			}
+			_, _ = fmt.Fprint(w, event)
+			w.(http.Flusher).Flush()
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server, &got
+}
+
+var streamEvents = []string{
+	"data: {\"id\":\"chatcmpl-1\",\"model\":\"test-model\"," +
+		"\"choices\":[{\"index\":0,\"delta\":{\"role\":\"assistant\"}}]}\n\n",
+	": keep-alive\n\n",
+	"data: {\"choices\":[{\"index\":0,\"delta\":{\"content\":\"Root cause: \"}}]}\n\n",
+	"data: {\"choices\":[{\"index\":0,\"delta\":{\"content\":\"disk full\"},\"finish_reason\":\"stop\"}]}\n\n",
+	"data: {\"choices\":[],\"usage\":{\"prompt_tokens\":100,\"completion_tokens\":20,\"total_tokens\":120}}\n\n",
+	"data: [DONE]\n\n",
+}
+
+func TestForward_Stream(t *testing.T) {
+	t.Parallel()
+
+	server, got := streamServer(t, 0, streamEvents...)
+	client := NewOpenClawClient(server.URL, "token", "test-model", WithStreaming(time.Second))
+
+	var progress []StreamProgress
+	ctx := WithStreamProgress(context.Background(), func(p StreamProgress) { progress = append(progress, p) })
+	result, err := client.Forward(ctx, &AlertmanagerPayload{Status: "firing"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !got.Stream || got.StreamOptions == nil || !got.StreamOptions.IncludeUsage {
+		t.Fatalf("expected a streaming request with usage, got %+v", got)
+	}
+
+	resp := result.Response
+	if resp == nil || resp.ID != "chatcmpl-1" || len(resp.Choices) != 1 {
+		t.Fatalf("unexpected response: %+v", resp)
+	}
+	choice := resp.Choices[0]
+	if choice.Message.Role != "assistant" || choice.Message.Content != "Root cause: disk full" ||
+		choice.FinishReason != "stop" {
+		t.Fatalf("unexpected choice: %+v", choice)
+	}
+	if resp.Usage == nil || resp.Usage.TotalTokens != 120 {
+		t.Fatalf("unexpected usage: %+v", resp.Usage)
+	}
+	if len(progress) != 1 || progress[0].Chunks != 1 || progress[0].Attempt != 1 || progress[0].Backend == "" {
+		t.Fatalf("expected one progress report on the first chunk, got %+v", progress)
+	}
+}
+
+func TestForward_StreamOutlastsIdleTimeout(t *testing.T) {
+	t.Parallel()
+
+	// The answer takes about 300ms, longer than the idle timeout, but never goes quiet for that long.
+	server, _ := streamServer(t, 50*time.Millisecond, streamEvents...)
+	client := NewOpenClawClient(server.URL, "token", "model", WithStreaming(200*time.Millisecond))
+
+	result, err := client.Forward(context.Background(), &AlertmanagerPayload{Status: "firing"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result.Response == nil || result.Response.Choices[0].Message.Content != "Root cause: disk full" {
+		t.Fatalf("unexpected response: %+v", result.Response)
+	}
+}
+
+// oversizedStream returns events whose content adds up to more than maxResponseSize, each
+// chunk well below the scanner's line limit.
+func oversizedStream() []string {
+	chunk := fmt.Sprintf("data: {\"choices\":[{\"index\":0,\"delta\":{\"content\":%q}}]}\n\n",
+		strings.Repeat("x", 1<<20))
+	events := make([]string, 0, maxResponseSize>>20+2)
+	for range maxResponseSize>>20 + 1 {
+		events = append(events, chunk)
+	}
+	return append(events, "data: [DONE]\n\n")
+}
+
+func TestForward_StreamFailures(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		gap      time.Duration
+		idle     time.Duration
+		events   []string
+		wantKind errorKind
+	}{
+		{name: "idle", gap: 500 * time.Millisecond, events: streamEvents, wantKind: errorTimeout},
+		{name: "truncated", events: streamEvents[:3], wantKind: errorTransport},
+		{name: "error event", events: []string{"data: {\"error\":{\"message\":\"overloaded\"}}\n\n"}, wantKind: errorServer},
+		{name: "too large", idle: 5 * time.Second, events: oversizedStream(), wantKind: errorClient},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			idle := cmp.Or(tt.idle, 100*time.Millisecond)
+			server, _ := streamServer(t, tt.gap, tt.events...)
+			client := NewOpenClawClient(server.URL, "token", "model",
+				WithStreaming(idle), WithRetryPolicy(RetryPolicy{Attempts: 1}))
+
+			result, err := client.Forward(context.Background(), &AlertmanagerPayload{Status: "firing"})
+			if err == nil {
+				t.Fatal("expected error, got nil")
+			}
+			if kind := errorKindOf(err); kind != tt.wantKind {
+				t.Fatalf("expected %s, got %s: %v", tt.wantKind, kind, err)
+			}
+			if tt.wantKind == errorTimeout && !errors.Is(err, errStreamIdle) {
+				t.Fatalf("expected idle timeout, got %v", err)
+			}
+			if tt.wantKind == errorClient && !errors.Is(err, errStreamTooLarge) {
+				t.Fatalf("expected oversized answer, got %v", err)
+			}
+			if result.Attempts != 1 || result.Response != nil {
+				t.Fatalf("unexpected result: %+v", result)
+			}
+		})
+	}
+}
+
+func TestForward_StreamIgnoredByServer(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"choices":[{"index":0,"message":{"role":"assistant","content":"done"}}]}`))
+	}))
+	defer server.Close()
+
+	client := NewOpenClawClient(server.URL, "token", "model", WithStreaming(time.Second))
+	result, err := client.Forward(context.Background(), &AlertmanagerPayload{Status: "firing"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result.Response == nil || result.Response.Choices[0].Message.Content != "done" {
+		t.Fatalf("expected the JSON answer, got %+v", result.Response)
+	}
+}
+
+func TestReadEvents(t *testing.T) {
+	t.Parallel()
+
+	input := "event: message\r\ndata: first\r\ndata: second\r\n\r\n: comment\n\nid: 7\ndata:third\n\ndata: last"
+	var got []string
+	if err := readEvents(strings.NewReader(input), func(data []byte) bool {
+		got = append(got, string(data))
+		return true
+	}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []string{"first\nsecond", "third", "last"}
+	if strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Fatalf("expected %q, got %q", want, got)
+	}
+}
+
+func TestConfig_ValidateStream(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		cfg     config
+		wantErr bool
+	}{
+		{name: "disabled", cfg: config{}},
+		{name: "enabled", cfg: config{OpenClawStream: true, OpenClawStreamIdle: time.Minute}},
+		{name: "zero idle timeout", cfg: config{OpenClawStream: true}, wantErr: true},
+		{name: "negative idle timeout", cfg: config{OpenClawStreamIdle: -1}, wantErr: true},
+		{name: "with async", cfg: config{OpenClawStream: true, OpenClawStreamIdle: time.Minute, OpenClawAsync: true},
+			wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			if err := tt.cfg.validateStream(); (err != nil) != tt.wantErr {
+				t.Fatalf("expected error=%v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
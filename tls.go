@@ -0,0 +1,164 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// errClientNotAllowed is returned when a verified client certificate matches neither
+// the subject nor the SAN allowlist.
+var errClientNotAllowed = errors.New("client certificate not in allowlist")
+
+// listenerTLSConfig holds the listener's TLS settings.
+type listenerTLSConfig struct {
+	CertFile        string
+	KeyFile         string
+	ClientCAFile    string
+	AllowedSubjects []string
+	AllowedSANs     []string
+}
+
+// files returns the certificate, key and client CA files, skipping unset ones.
+func (c listenerTLSConfig) files() []string {
+	var files []string
+	for _, f := range []string{c.CertFile, c.KeyFile, c.ClientCAFile} {
+		if f != "" {
+			files = append(files, f)
+		}
+	}
+	return files
+}
+
+// listenerTLS serves the listener's TLS configuration and reloads the certificate, key
+// and client CA bundle when they change, so that renewed certificates are picked up
+// without a restart. New connections use the new files; established ones are unaffected.
+type listenerTLS struct {
+	cfg listenerTLSConfig
+
+	mu      sync.Mutex
+	stamp   string
+	current atomic.Pointer[tls.Config]
+}
+
+// newListenerTLS loads the certificate, key and, if configured, the client CA bundle.
+func newListenerTLS(cfg listenerTLSConfig) (*listenerTLS, error) {
+	l := &listenerTLS{cfg: cfg, stamp: filesStamp(cfg.files())}
+	if err := l.Reload(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// ServerConfig returns the TLS configuration for http.Server. It hands out the most
+// recently loaded files on every handshake. The per-handshake configuration replaces the
+// one http.Server prepares, so it offers HTTP/2 itself.
+func (l *listenerTLS) ServerConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			return l.current.Load(), nil
+		},
+	}
+}
+
+// Reload reads the files again. On error the previous configuration stays in use.
+func (l *listenerTLS) Reload() error {
+	cert, err := tls.LoadX509KeyPair(l.cfg.CertFile, l.cfg.KeyFile)
+	if err != nil {
+		return fmt.Errorf("load TLS certificate: %w", err)
+	}
+	cfg := &tls.Config{
+		MinVersion:   tls.VersionTLS12,
+		Certificates: []tls.Certificate{cert},
+		NextProtos:   []string{"h2", "http/1.1"},
+	}
+
+	if l.cfg.ClientCAFile != "" {
+		pem, err := os.ReadFile(l.cfg.ClientCAFile)
+		if err != nil {
+			return fmt.Errorf("read TLS client CA file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("TLS client CA file %s: no PEM certificates found", l.cfg.ClientCAFile)
+		}
+		cfg.ClientCAs = pool
+		cfg.ClientAuth = tls.RequireAndVerifyClientCert
+		cfg.VerifyConnection = l.verifyClient
+	}
+	l.current.Store(cfg)
+	return nil
+}
+
+// verifyClient checks the verified client certificate against the allowlists. With no
+// allowlist every certificate signed by the client CA is accepted; otherwise the subject
+// common name or full subject, or any DNS, email, IP or URI SAN, must be listed.
+func (l *listenerTLS) verifyClient(cs tls.ConnectionState) error {
+	if len(l.cfg.AllowedSubjects) == 0 && len(l.cfg.AllowedSANs) == 0 {
+		return nil
+	}
+	if len(cs.PeerCertificates) == 0 {
+		return errClientNotAllowed
+	}
+	cert := cs.PeerCertificates[0]
+	if slices.Contains(l.cfg.AllowedSubjects, cert.Subject.CommonName) ||
+		slices.Contains(l.cfg.AllowedSubjects, cert.Subject.String()) {
+		return nil
+	}
+	for _, san := range certificateSANs(cert) {
+		if slices.Contains(l.cfg.AllowedSANs, san) {
+			return nil
+		}
+	}
+	slog.Warn("rejected client certificate", "subject", cert.Subject.String(), "sans", certificateSANs(cert))
+	return fmt.Errorf("%w: %s", errClientNotAllowed, cert.Subject)
+}
+
+// certificateSANs returns the subject alternative names of a certificate as strings.
+func certificateSANs(cert *x509.Certificate) []string {
+	sans := slices.Concat(cert.DNSNames, cert.EmailAddresses)
+	for _, ip := range cert.IPAddresses {
+		sans = append(sans, ip.String())
+	}
+	for _, uri := range cert.URIs {
+		sans = append(sans, uri.String())
+	}
+	return sans
+}
+
+// Run reloads the files on SIGHUP and, if interval is positive, whenever they change.
+// It returns when ctx is done.
+func (l *listenerTLS) Run(ctx context.Context, interval time.Duration) {
+	watch(ctx, interval, l.changed, l.reload)
+}
+
+// reload calls Reload and logs the outcome.
+func (l *listenerTLS) reload(trigger string) {
+	if err := l.Reload(); err != nil {
+		slog.Error("TLS reload failed, keeping previous certificate", "trigger", trigger, "error", err)
+		return
+	}
+	slog.Info("TLS certificate reloaded", "trigger", trigger)
+}
+
+// changed reports whether any of the files changed since the last check.
+func (l *listenerTLS) changed() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	stamp := filesStamp(l.cfg.files())
+	if stamp == l.stamp {
+		return false
+	}
+	l.stamp = stamp
+	return true
+}
@@ -0,0 +1,314 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// testCA is a certificate authority for issuing test certificates.
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pool *x509.CertPool
+	pem  []byte
+}
+
+func newTestCA(t *testing.T) *testCA {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("create CA certificate: %v", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("parse CA certificate: %v", err)
+	}
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+	return &testCA{
+		cert: cert,
+		key:  key,
+		pool: pool,
+		pem:  pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+	}
+}
+
+// issue creates a certificate signed by the CA and returns it as PEM certificate and key.
+func (ca *testCA) issue(t *testing.T, serial int64, cn string, dnsNames ...string) (certPEM, keyPEM []byte) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: cn},
+		DNSNames:     dnsNames,
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatalf("create certificate: %v", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("marshal key: %v", err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+}
+
+// clientCert issues a client certificate for use in a tls.Config.
+func (ca *testCA) clientCert(t *testing.T, cn string, dnsNames ...string) tls.Certificate {
+	t.Helper()
+
+	certPEM, keyPEM := ca.issue(t, 100, cn, dnsNames...)
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		t.Fatalf("load client certificate: %v", err)
+	}
+	return cert
+}
+
+func writeChangedFile(t *testing.T, path string, data []byte) {
+	t.Helper()
+
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatalf("write %s: %v", path, err)
+	}
+	// Make the change visible even on filesystems with coarse timestamps.
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(path, later, later); err != nil {
+		t.Fatalf("chtimes: %v", err)
+	}
+}
+
+// startTLSServer serves an OK handler with the listener TLS configuration.
+func startTLSServer(t *testing.T, l *listenerTLS) *httptest.Server {
+	t.Helper()
+
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	srv.TLS = l.ServerConfig()
+	srv.StartTLS()
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestListenerTLS_Reload(t *testing.T) {
+	t.Parallel()
+
+	ca := newTestCA(t)
+	dir := t.TempDir()
+	cfg := listenerTLSConfig{CertFile: filepath.Join(dir, "tls.crt"), KeyFile: filepath.Join(dir, "tls.key")}
+	certPEM, keyPEM := ca.issue(t, 2, "before")
+	writeChangedFile(t, cfg.CertFile, certPEM)
+	writeChangedFile(t, cfg.KeyFile, keyPEM)
+
+	l, err := newListenerTLS(cfg)
+	if err != nil {
+		t.Fatalf("newListenerTLS: %v", err)
+	}
+	srv := startTLSServer(t, l)
+
+	serverCN := func() string {
+		t.Helper()
+		clientCfg := &tls.Config{RootCAs: ca.pool, MinVersion: tls.VersionTLS12}
+		conn, err := tls.Dial("tcp", srv.Listener.Addr().String(), clientCfg)
+		if err != nil {
+			t.Fatalf("dial: %v", err)
+		}
+		defer conn.Close()
+		return conn.ConnectionState().PeerCertificates[0].Subject.CommonName
+	}
+	if cn := serverCN(); cn != "before" {
+		t.Fatalf("expected initial certificate, got %q", cn)
+	}
+
+	certPEM, keyPEM = ca.issue(t, 3, "after")
+	writeChangedFile(t, cfg.CertFile, certPEM)
+	writeChangedFile(t, cfg.KeyFile, keyPEM)
+	if !l.changed() {
+		t.Fatal("expected certificate change to be detected")
+	}
+	if err := l.Reload(); err != nil {
+		t.Fatalf("Reload: %v", err)
+	}
+	if cn := serverCN(); cn != "after" {
+		t.Fatalf("expected renewed certificate, got %q", cn)
+	}
+
+	// A broken key pair keeps the previous certificate.
+	writeChangedFile(t, cfg.KeyFile, []byte("not a key"))
+	if err := l.Reload(); err == nil {
+		t.Fatal("expected reload of an invalid key to fail")
+	}
+	if cn := serverCN(); cn != "after" {
+		t.Fatalf("expected previous certificate to be kept, got %q", cn)
+	}
+}
+
+func TestListenerTLS_NegotiatesHTTP2(t *testing.T) {
+	t.Parallel()
+
+	ca := newTestCA(t)
+	dir := t.TempDir()
+	cfg := listenerTLSConfig{CertFile: filepath.Join(dir, "tls.crt"), KeyFile: filepath.Join(dir, "tls.key")}
+	certPEM, keyPEM := ca.issue(t, 2, "server")
+	writeChangedFile(t, cfg.CertFile, certPEM)
+	writeChangedFile(t, cfg.KeyFile, keyPEM)
+	l, err := newListenerTLS(cfg)
+	if err != nil {
+		t.Fatalf("newListenerTLS: %v", err)
+	}
+
+	// Serve the way the service does, so http.Server sets up HTTP/2.
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	server := &http.Server{
+		Handler:           http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}),
+		TLSConfig:         l.ServerConfig(),
+		ReadHeaderTimeout: time.Second,
+	}
+	go func() { _ = server.ServeTLS(ln, "", "") }()
+	t.Cleanup(func() { _ = server.Close() })
+
+	clientCfg := &tls.Config{RootCAs: ca.pool, MinVersion: tls.VersionTLS12, NextProtos: []string{"h2", "http/1.1"}}
+	conn, err := tls.Dial("tcp", ln.Addr().String(), clientCfg)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer conn.Close()
+	if proto := conn.ConnectionState().NegotiatedProtocol; proto != "h2" {
+		t.Fatalf("expected HTTP/2 to be negotiated, got %q", proto)
+	}
+}
+
+func TestListenerTLS_ClientAuth(t *testing.T) {
+	t.Parallel()
+
+	ca := newTestCA(t)
+	other := newTestCA(t)
+	dir := t.TempDir()
+	cfg := listenerTLSConfig{
+		CertFile:        filepath.Join(dir, "tls.crt"),
+		KeyFile:         filepath.Join(dir, "tls.key"),
+		ClientCAFile:    filepath.Join(dir, "ca.crt"),
+		AllowedSubjects: []string{"grafana-prod"},
+		AllowedSANs:     []string{"grafana.staging.example"},
+	}
+	certPEM, keyPEM := ca.issue(t, 2, "bridge")
+	writeChangedFile(t, cfg.CertFile, certPEM)
+	writeChangedFile(t, cfg.KeyFile, keyPEM)
+	writeChangedFile(t, cfg.ClientCAFile, ca.pem)
+
+	l, err := newListenerTLS(cfg)
+	if err != nil {
+		t.Fatalf("newListenerTLS: %v", err)
+	}
+	srv := startTLSServer(t, l)
+
+	tests := []struct {
+		name   string
+		certs  []tls.Certificate
+		wantOK bool
+	}{
+		{name: "allowed subject", certs: []tls.Certificate{ca.clientCert(t, "grafana-prod")}, wantOK: true},
+		{
+			name:   "allowed SAN",
+			certs:  []tls.Certificate{ca.clientCert(t, "grafana", "grafana.staging.example")},
+			wantOK: true,
+		},
+		{name: "not allowed", certs: []tls.Certificate{ca.clientCert(t, "grafana-dev", "grafana.dev.example")}},
+		{name: "untrusted CA", certs: []tls.Certificate{other.clientCert(t, "grafana-prod")}},
+		{name: "no certificate"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{
+				RootCAs:      ca.pool,
+				Certificates: tt.certs,
+				MinVersion:   tls.VersionTLS12,
+			}}}
+			resp, err := client.Get(srv.URL)
+			if err == nil {
+				_ = resp.Body.Close()
+			}
+			if ok := err == nil && resp.StatusCode == http.StatusOK; ok != tt.wantOK {
+				t.Fatalf("expected success=%v, got error %v", tt.wantOK, err)
+			}
+		})
+	}
+}
+
+func TestConfig_ValidateTLS(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		cfg     config
+		wantErr bool
+	}{
+		{name: "disabled", cfg: config{}},
+		{name: "server only", cfg: config{TLSCertFile: "c", TLSKeyFile: "k"}},
+		{
+			name: "mutual",
+			cfg:  config{TLSCertFile: "c", TLSKeyFile: "k", TLSClientCAFile: "ca", TLSAllowedSANs: []string{"a"}},
+		},
+		{name: "cert without key", cfg: config{TLSCertFile: "c"}, wantErr: true},
+		{name: "client CA without cert", cfg: config{TLSClientCAFile: "ca"}, wantErr: true},
+		{
+			name:    "allowlist without client CA",
+			cfg:     config{TLSCertFile: "c", TLSKeyFile: "k", TLSAllowedSubjects: []string{"a"}},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			if err := tt.cfg.validateTLS(); (err != nil) != tt.wantErr {
+				t.Fatalf("expected error=%v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
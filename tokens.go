@@ -0,0 +1,241 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// defaultCallerName identifies senders authenticated with the single WEBHOOK_TOKEN.
+const defaultCallerName = "default"
+
+// callerLabel is the pseudo-label carrying the caller name in route matchers.
+const callerLabel = "__caller__"
+
+// WebhookTokenConfig is a named webhook token. Only the SHA-256 hash of the token is
+// configured; Routes, if set, lists the only routes the caller's alerts may reach.
+type WebhookTokenConfig struct {
+	Name   string   `json:"name"`
+	SHA256 string   `json:"sha256"`
+	Routes []string `json:"routes,omitempty"`
+}
+
+// webhookCaller is an authenticated webhook sender and its route policy.
+type webhookCaller struct {
+	name   string
+	routes map[string]bool
+}
+
+// allowsRoute reports whether the caller's alerts may be forwarded to the route.
+func (c *webhookCaller) allowsRoute(route string) bool {
+	return len(c.routes) == 0 || c.routes[route]
+}
+
+// TokenSet authenticates webhook requests by bearer token and holds the route policy
+// of each caller. Tokens are kept as SHA-256 hashes; a presented token is hashed and
+// looked up, so its bytes are never compared directly.
+type TokenSet struct {
+	byHash map[[sha256.Size]byte]*webhookCaller
+	byName map[string]*webhookCaller
+}
+
+// NewTokenSet compiles named tokens. Names and hashes must be unique, and the name
+// "default" is reserved for WEBHOOK_TOKEN.
+func NewTokenSet(tokens []WebhookTokenConfig) (*TokenSet, error) {
+	s := &TokenSet{
+		byHash: make(map[[sha256.Size]byte]*webhookCaller, len(tokens)),
+		byName: make(map[string]*webhookCaller, len(tokens)),
+	}
+	for _, t := range tokens {
+		if t.Name == "" {
+			return nil, errors.New("webhook token without a name")
+		}
+		if t.Name == defaultCallerName {
+			return nil, fmt.Errorf("webhook token name %q is reserved for webhook_token", t.Name)
+		}
+		if err := s.add(t); err != nil {
+			return nil, fmt.Errorf("webhook token %q: %w", t.Name, err)
+		}
+	}
+	return s, nil
+}
+
+// add registers a token, rejecting duplicate names and hashes.
+func (s *TokenSet) add(t WebhookTokenConfig) error {
+	sum, err := hex.DecodeString(t.SHA256)
+	if err != nil || len(sum) != sha256.Size {
+		return errors.New("sha256 must be a hex-encoded SHA-256 hash")
+	}
+	hash := [sha256.Size]byte(sum)
+	if s.byName[t.Name] != nil {
+		return errors.New("duplicate name")
+	}
+	if s.byHash[hash] != nil {
+		return fmt.Errorf("same token as %q", s.byHash[hash].name)
+	}
+
+	c := &webhookCaller{name: t.Name}
+	for _, route := range t.Routes {
+		if c.routes == nil {
+			c.routes = make(map[string]bool, len(t.Routes))
+		}
+		c.routes[route] = true
+	}
+	s.byHash[hash] = c
+	s.byName[t.Name] = c
+	return nil
+}
+
+// withDefault returns a copy of s that also accepts token as the "default" caller,
+// with no route restriction. A nil set yields a set with only that token.
+func (s *TokenSet) withDefault(token string) *TokenSet {
+	out := &TokenSet{byHash: map[[sha256.Size]byte]*webhookCaller{}, byName: map[string]*webhookCaller{}}
+	if s != nil {
+		for k, v := range s.byHash {
+			out.byHash[k] = v
+		}
+		for k, v := range s.byName {
+			out.byName[k] = v
+		}
+	}
+	c := &webhookCaller{name: defaultCallerName}
+	out.byHash[sha256.Sum256([]byte(token))] = c
+	out.byName[c.name] = c
+	return out
+}
+
+// authenticate returns the caller whose token the request carries as a bearer token.
+func (s *TokenSet) authenticate(r *http.Request) (*webhookCaller, bool) {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || token == "" {
+		return nil, false
+	}
+	c, ok := s.byHash[sha256.Sum256([]byte(token))]
+	return c, ok
+}
+
+// AllowsRoute reports whether alerts from the named caller may be forwarded to the
+// route. Anonymous alerts and those sent with WEBHOOK_TOKEN may reach every route, as
+// may named callers without a policy. A named caller the set does not know, such as one
+// whose token was removed while its alerts were journaled, may reach none.
+func (s *TokenSet) AllowsRoute(caller, route string) bool {
+	if caller == "" || caller == defaultCallerName {
+		return true
+	}
+	if s == nil {
+		return false
+	}
+	c := s.byName[caller]
+	return c != nil && c.allowsRoute(route)
+}
+
+// CheckRoutes returns an error if a caller's policy names a route the router does not
+// have, so that a typo cannot silently block the caller. A nil set has no policies.
+func (s *TokenSet) CheckRoutes(router *Router) error {
+	if s == nil {
+		return nil
+	}
+	names := router.Names()
+	for _, name := range slices.Sorted(maps.Keys(s.byName)) {
+		for _, route := range slices.Sorted(maps.Keys(s.byName[name].routes)) {
+			if !slices.Contains(names, route) {
+				return fmt.Errorf("webhook token %q: unknown route %q", name, route)
+			}
+		}
+	}
+	return nil
+}
+
+// HashToken returns the hex-encoded SHA-256 hash of a token, as used in the tokens file.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// LoadTokenFile reads named token hashes from a file with one token per line:
+// the name, the hex SHA-256 hash and optionally a comma-separated list of allowed
+// routes, separated by whitespace. Blank lines and lines starting with # are skipped.
+func LoadTokenFile(path string) ([]WebhookTokenConfig, error) {
+	data, err := os.ReadFile(path) //nolint:gosec // G304: path comes from server config.
+	if err != nil {
+		return nil, fmt.Errorf("read webhook tokens file: %w", err)
+	}
+
+	var tokens []WebhookTokenConfig
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		fields := strings.Fields(text)
+		if len(fields) < 2 || len(fields) > 3 {
+			return nil, fmt.Errorf("%s:%d: expected name, sha256 and optional routes", path, line)
+		}
+		t := WebhookTokenConfig{Name: fields[0], SHA256: fields[1]}
+		if len(fields) == 3 {
+			t.Routes = strings.Split(fields[2], ",")
+		}
+		tokens = append(tokens, t)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("read webhook tokens file: %w", err)
+	}
+	return tokens, nil
+}
+
+// callerContextKey is the request context key of the authenticated caller's name.
+type callerContextKey struct{}
+
+// callerFromContext returns the name of the authenticated caller, or "" if the request
+// was not authenticated by token.
+func callerFromContext(ctx context.Context) string {
+	name, _ := ctx.Value(callerContextKey{}).(string)
+	return name
+}
+
+// authenticateWebhook rejects requests without a known bearer token, attaches the
+// caller's name to the request context and counts requests per caller. With a nil
+// set every request is accepted anonymously.
+func authenticateWebhook(tokens *TokenSet, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if tokens == nil {
+			next(w, r)
+			return
+		}
+		caller, ok := tokens.authenticate(r)
+		if !ok {
+			//nolint:gosec // G706: structured slog key-value, not string interpolation.
+			slog.Warn("unauthorized request", "path", r.URL.Path, "remote_addr", r.RemoteAddr)
+			metrics.webhookCallers.Inc("unknown", strconv.Itoa(http.StatusUnauthorized))
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next(rec, r.WithContext(context.WithValue(r.Context(), callerContextKey{}, caller.name)))
+		metrics.webhookCallers.Inc(caller.name, strconv.Itoa(rec.status))
+	}
+}
+
+// callerMayRoute reports whether the payload's caller may reach at least one of the
+// routes the payload currently matches. Drop routes are always allowed.
+func callerMayRoute(queue *AlertQueue, tokens *TokenSet, payload *AlertmanagerPayload) bool {
+	for _, route := range queue.router.Load().Match(payload) {
+		if route.Drop || tokens.AllowsRoute(payload.Caller, route.Name) {
+			return true
+		}
+	}
+	return false
+}
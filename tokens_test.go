@@ -0,0 +1,314 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTokenSet_Authenticate(t *testing.T) {
+	t.Parallel()
+
+	tokens, err := NewTokenSet([]WebhookTokenConfig{
+		{Name: "grafana-prod", SHA256: HashToken("prod-token")},
+		{Name: "grafana-staging", SHA256: HashToken("staging-token"), Routes: []string{"staging"}},
+	})
+	if err != nil {
+		t.Fatalf("NewTokenSet: %v", err)
+	}
+	tokens = tokens.withDefault("legacy-token")
+
+	tests := []struct {
+		auth   string
+		caller string
+		ok     bool
+	}{
+		{auth: "Bearer prod-token", caller: "grafana-prod", ok: true},
+		{auth: "Bearer staging-token", caller: "grafana-staging", ok: true},
+		{auth: "Bearer legacy-token", caller: defaultCallerName, ok: true},
+		{auth: "Bearer other"},
+		{auth: "prod-token"},
+		{auth: "Bearer "},
+		{},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.auth, func(t *testing.T) {
+			t.Parallel()
+
+			r := httptest.NewRequest(http.MethodPost, "/webhook", nil)
+			r.Header.Set("Authorization", tt.auth)
+			c, ok := tokens.authenticate(r)
+			if ok != tt.ok || (ok && c.name != tt.caller) {
+				t.Fatalf("expected %q (ok=%v), got %+v (ok=%v)", tt.caller, tt.ok, c, ok)
+			}
+		})
+	}
+
+	if !tokens.AllowsRoute("grafana-prod", "production") || !tokens.AllowsRoute(defaultCallerName, "staging") {
+		t.Fatal("expected callers without a policy to reach every route")
+	}
+	if !tokens.AllowsRoute("grafana-staging", "staging") || tokens.AllowsRoute("grafana-staging", "production") {
+		t.Fatal("expected staging caller to reach only the staging route")
+	}
+	var none *TokenSet
+	if tokens.AllowsRoute("grafana-removed", "production") || none.AllowsRoute("grafana-removed", "production") {
+		t.Fatal("expected a caller whose token is gone to reach no route")
+	}
+	if !tokens.AllowsRoute("", "production") || !none.AllowsRoute(defaultCallerName, "production") {
+		t.Fatal("expected anonymous and default callers to reach every route")
+	}
+}
+
+func TestTokenSet_CheckRoutes(t *testing.T) {
+	t.Parallel()
+
+	router, err := NewRouter(RouteConfig{
+		URL: "http://localhost", Token: "t",
+		Routes: []RouteConfig{{Name: "staging", Matchers: []string{"env=staging"}}},
+	}, "", "", "model", defaultPromptTemplates)
+	if err != nil {
+		t.Fatalf("NewRouter: %v", err)
+	}
+
+	valid, err := NewTokenSet([]WebhookTokenConfig{
+		{Name: "grafana-staging", SHA256: HashToken("a"), Routes: []string{"staging", "root"}},
+		{Name: "grafana-prod", SHA256: HashToken("b")},
+	})
+	if err != nil {
+		t.Fatalf("NewTokenSet: %v", err)
+	}
+	if err := valid.CheckRoutes(router); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	typo, err := NewTokenSet([]WebhookTokenConfig{
+		{Name: "grafana-staging", SHA256: HashToken("a"), Routes: []string{"stagign"}},
+	})
+	if err != nil {
+		t.Fatalf("NewTokenSet: %v", err)
+	}
+	if err := typo.CheckRoutes(router); err == nil || !strings.Contains(err.Error(), `unknown route "stagign"`) {
+		t.Fatalf("expected unknown route error, got %v", err)
+	}
+}
+
+func TestNewTokenSet_Invalid(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name   string
+		tokens []WebhookTokenConfig
+		want   string
+	}{
+		{name: "no name", tokens: []WebhookTokenConfig{{SHA256: HashToken("a")}}, want: "without a name"},
+		{name: "reserved", tokens: []WebhookTokenConfig{{Name: "default", SHA256: HashToken("a")}}, want: "reserved"},
+		{name: "plain token", tokens: []WebhookTokenConfig{{Name: "a", SHA256: "secret"}}, want: "hex-encoded SHA-256"},
+		{
+			name:   "duplicate name",
+			tokens: []WebhookTokenConfig{{Name: "a", SHA256: HashToken("a")}, {Name: "a", SHA256: HashToken("b")}},
+			want:   "duplicate name",
+		},
+		{
+			name:   "duplicate token",
+			tokens: []WebhookTokenConfig{{Name: "a", SHA256: HashToken("a")}, {Name: "b", SHA256: HashToken("a")}},
+			want:   `same token as "a"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			if _, err := NewTokenSet(tt.tokens); err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("expected error containing %q, got %v", tt.want, err)
+			}
+		})
+	}
+}
+
+func TestLoadTokenFile(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "tokens")
+	content := "# name sha256 routes\n\ngrafana-prod " + HashToken("p") + "\n" +
+		"grafana-staging " + HashToken("s") + " staging,staging-db\n"
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("write tokens file: %v", err)
+	}
+
+	tokens, err := LoadTokenFile(path)
+	if err != nil {
+		t.Fatalf("LoadTokenFile: %v", err)
+	}
+	if len(tokens) != 2 || tokens[1].Name != "grafana-staging" || len(tokens[1].Routes) != 2 {
+		t.Fatalf("unexpected tokens %+v", tokens)
+	}
+
+	if err := os.WriteFile(path, []byte("grafana-prod\n"), 0o600); err != nil {
+		t.Fatalf("write tokens file: %v", err)
+	}
+	if _, err := LoadTokenFile(path); err == nil || !strings.Contains(err.Error(), path+":1:") {
+		t.Fatalf("expected positioned error, got %v", err)
+	}
+}
+
+func TestWebhookHandler_CallerPolicy(t *testing.T) {
+	t.Parallel()
+
+	tokens, err := NewTokenSet([]WebhookTokenConfig{
+		{Name: "grafana-prod", SHA256: HashToken("prod-token")},
+		{Name: "grafana-staging", SHA256: HashToken("staging-token"), Routes: []string{"staging"}},
+	})
+	if err != nil {
+		t.Fatalf("NewTokenSet: %v", err)
+	}
+	router, err := NewRouter(RouteConfig{
+		URL: "http://localhost", Token: "t",
+		Routes: []RouteConfig{
+			{Name: "staging", Matchers: []string{`__caller__="grafana-staging"`}},
+			{Name: "production"},
+		},
+	}, "", "", "model", defaultPromptTemplates)
+	if err != nil {
+		t.Fatalf("NewRouter: %v", err)
+	}
+	queue := NewAlertQueue(nil, WithRouter(router), WithCallerPolicy(tokens))
+	defer queue.Stop()
+	mux := NewMux(queue, "", WithWebhookTokens(tokens))
+
+	post := func(token, body string) int {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodPost, "/webhook", strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	before := metrics.webhookCallers.Value("grafana-staging", "200")
+	if code := post("staging-token", testPayload(t, "firing")); code != http.StatusOK {
+		t.Fatalf("expected staging caller to reach the staging route, got %d", code)
+	}
+	if got := metrics.webhookCallers.Value("grafana-staging", "200"); got != before+1 {
+		t.Fatalf("expected caller counter to increase by 1, got %v -> %v", before, got)
+	}
+	if code := post("prod-token", testPayload(t, "firing")); code != http.StatusOK {
+		t.Fatalf("expected prod caller to be accepted, got %d", code)
+	}
+	if code := post("unknown", testPayload(t, "firing")); code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 for an unknown token, got %d", code)
+	}
+
+	// The same group from two callers is queued twice, attributed to each caller.
+	if depth := queue.Stats().Depth; depth != 2 {
+		t.Fatalf("expected 2 queued payloads, got %d", depth)
+	}
+	routes := router.Match(&AlertmanagerPayload{Caller: "grafana-staging"})
+	if len(routes) != 1 || routes[0].Name != "staging" {
+		t.Fatalf("expected __caller__ matcher to select the staging route, got %v", routes)
+	}
+
+	// A body claiming another caller is attributed to the token's caller.
+	spoofed := strings.Replace(testPayload(t, "firing"), `"version":"4"`, `"version":"4","caller":"grafana-prod"`, 1)
+	if code := post("staging-token", spoofed); code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", code)
+	}
+	queue.mu.Lock()
+	defer queue.mu.Unlock()
+	for _, item := range queue.items {
+		if merged := item.payload.Caller == "grafana-staging"; merged != (item.merged == 1) {
+			t.Fatalf("expected the spoofed payload to merge into the staging item, got caller %q merged %d",
+				item.payload.Caller, item.merged)
+		}
+	}
+}
+
+func TestCallerMayRoute(t *testing.T) {
+	t.Parallel()
+
+	tokens, err := NewTokenSet([]WebhookTokenConfig{
+		{Name: "grafana-staging", SHA256: HashToken("staging-token"), Routes: []string{"staging"}},
+	})
+	if err != nil {
+		t.Fatalf("NewTokenSet: %v", err)
+	}
+	router, err := NewRouter(RouteConfig{URL: "http://localhost", Token: "t"}, "", "", "model", defaultPromptTemplates)
+	if err != nil {
+		t.Fatalf("NewRouter: %v", err)
+	}
+	queue := NewAlertQueue(nil, WithRouter(router), WithCallerPolicy(tokens))
+	defer queue.Stop()
+	mux := NewMux(queue, "", WithWebhookTokens(tokens))
+
+	req := httptest.NewRequest(http.MethodPost, "/webhook", strings.NewReader(testPayload(t, "firing")))
+	req.Header.Set("Authorization", "Bearer staging-token")
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, req)
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("expected 403 when only the root route matches, got %d", w.Code)
+	}
+	if depth := queue.Stats().Depth; depth != 0 {
+		t.Fatalf("expected nothing queued, got %d", depth)
+	}
+}
+
+func TestAlertQueue_CallerPolicy(t *testing.T) {
+	t.Parallel()
+
+	models := make(chan string, 4)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req chatRequest
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		models <- req.Model
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	tokens, err := NewTokenSet([]WebhookTokenConfig{
+		{Name: "grafana-staging", SHA256: HashToken("staging-token"), Routes: []string{"staging"}},
+	})
+	if err != nil {
+		t.Fatalf("NewTokenSet: %v", err)
+	}
+	router, err := NewRouter(RouteConfig{
+		URL: server.URL, Token: "t",
+		Routes: []RouteConfig{
+			{Name: "production", Model: "production", Continue: true},
+			{Name: "staging", Model: "staging"},
+		},
+	}, "", "", "model", defaultPromptTemplates)
+	if err != nil {
+		t.Fatalf("NewRouter: %v", err)
+	}
+	queue := NewAlertQueue(nil, WithRouter(router), WithCallerPolicy(tokens))
+	defer queue.Stop()
+
+	before := metrics.forbidden.Value("grafana-staging", "production")
+	payload := &AlertmanagerPayload{Status: "firing", Caller: "grafana-staging"}
+	if !queue.Enqueue(payload) {
+		t.Fatal("expected enqueue to succeed")
+	}
+	queue.Start()
+
+	select {
+	case got := <-models:
+		if got != "staging" {
+			t.Fatalf("expected only the staging route to be forwarded to, got %q", got)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for forward")
+	}
+	queue.Stop()
+	if len(models) != 0 {
+		t.Fatalf("expected a single forward, got %d more", len(models))
+	}
+	if got := metrics.forbidden.Value("grafana-staging", "production"); got != before+1 {
+		t.Fatalf("expected forbidden counter to increase by 1, got %v -> %v", before, got)
+	}
+}
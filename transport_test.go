@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+)
+
+func TestNewTransport_TLS(t *testing.T) {
+	t.Parallel()
+
+	ca := newTestCA(t)
+	dir := t.TempDir()
+	caFile, certFile, keyFile := filepath.Join(dir, "ca.crt"), filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")
+	writeChangedFile(t, caFile, ca.pem)
+	certPEM, keyPEM := ca.issue(t, 2, "alertstoopenclaw")
+	writeChangedFile(t, certFile, certPEM)
+	writeChangedFile(t, keyFile, keyPEM)
+
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	serverCert := ca.clientCert(t, "openclaw", "openclaw.internal")
+	srv.TLS = &tls.Config{
+		MinVersion:   tls.VersionTLS12,
+		Certificates: []tls.Certificate{serverCert},
+		ClientCAs:    ca.pool,
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+	}
+	srv.StartTLS()
+	t.Cleanup(srv.Close)
+
+	tests := []struct {
+		name   string
+		cfg    transportConfig
+		wantOK bool
+	}{
+		{
+			name:   "client certificate",
+			cfg:    transportConfig{CAFile: caFile, CertFile: certFile, KeyFile: keyFile},
+			wantOK: true,
+		},
+		{
+			name:   "server name",
+			cfg:    transportConfig{CAFile: caFile, CertFile: certFile, KeyFile: keyFile, ServerName: "openclaw.internal"},
+			wantOK: true,
+		},
+		{
+			name: "wrong server name",
+			cfg:  transportConfig{CAFile: caFile, CertFile: certFile, KeyFile: keyFile, ServerName: "other.internal"},
+		},
+		{name: "no client certificate", cfg: transportConfig{CAFile: caFile}},
+		{name: "system roots only", cfg: transportConfig{CertFile: certFile, KeyFile: keyFile}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			transport, err := newTransport(tt.cfg)
+			if err != nil {
+				t.Fatalf("newTransport: %v", err)
+			}
+			defer transport.CloseIdleConnections()
+			resp, err := (&http.Client{Transport: transport}).Get(srv.URL)
+			if err == nil {
+				_ = resp.Body.Close()
+			}
+			if ok := err == nil && resp.StatusCode == http.StatusOK; ok != tt.wantOK {
+				t.Fatalf("expected success=%v, got error %v", tt.wantOK, err)
+			}
+		})
+	}
+}
+
+func TestNewTransport_Proxy(t *testing.T) {
+	t.Parallel()
+
+	hosts := make(chan string, 1)
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hosts <- r.Host
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer proxy.Close()
+
+	transport, err := newTransport(transportConfig{ProxyURL: proxy.URL})
+	if err != nil {
+		t.Fatalf("newTransport: %v", err)
+	}
+	client := NewOpenClawClient("http://openclaw.invalid", "token", "model", WithTransport(transport))
+	if _, err := client.Forward(context.Background(), &AlertmanagerPayload{Status: "firing"}); err != nil {
+		t.Fatalf("Forward: %v", err)
+	}
+	if host := <-hosts; host != "openclaw.invalid" {
+		t.Fatalf("expected the request to go through the proxy, got host %q", host)
+	}
+
+	if _, err := newTransport(transportConfig{ProxyURL: "proxy:3128"}); err == nil {
+		t.Fatal("expected an error for a proxy URL without scheme")
+	}
+}
+
+func TestNewTransport_InvalidFiles(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	notPEM := filepath.Join(dir, "ca.crt")
+	writeChangedFile(t, notPEM, []byte("not a certificate"))
+
+	tests := []struct {
+		name string
+		cfg  transportConfig
+	}{
+		{name: "missing CA", cfg: transportConfig{CAFile: filepath.Join(dir, "missing.crt")}},
+		{name: "CA without certificates", cfg: transportConfig{CAFile: notPEM}},
+		{name: "invalid key pair", cfg: transportConfig{CertFile: notPEM, KeyFile: notPEM}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			if _, err := newTransport(tt.cfg); err == nil {
+				t.Fatal("expected an error")
+			}
+		})
+	}
+}
+
+func TestConfig_ValidateTransport(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		cfg     config
+		wantErr bool
+	}{
+		{name: "defaults", cfg: config{OpenClawMaxIdleConns: defaultMaxIdleConns}},
+		{name: "client certificate", cfg: config{OpenClawCertFile: "c", OpenClawKeyFile: "k"}},
+		{name: "cert without key", cfg: config{OpenClawCertFile: "c"}, wantErr: true},
+		{name: "key without cert", cfg: config{OpenClawKeyFile: "k"}, wantErr: true},
+		{name: "negative limit", cfg: config{OpenClawMaxConnsPerHost: -1}, wantErr: true},
+		{name: "negative idle timeout", cfg: config{OpenClawIdleConnTimeout: -1}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			if err := tt.cfg.validateTransport(); (err != nil) != tt.wantErr {
+				t.Fatalf("expected error=%v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}